@@ -20,8 +20,21 @@
 
 package ladon
 
+import "time"
+
 // AuditLogger tracks denied and granted authorizations.
 type AuditLogger interface {
 	LogRejectedAccessRequest(request *Request, pool Policies, deciders Policies)
 	LogGrantedAccessRequest(request *Request, pool Policies, deciders Policies)
 }
+
+// DecisionAuditLogger is an optional interface an AuditLogger can implement to receive the complete decision instead
+// of only the deciding policies. If implemented, LogDecision is called instead of LogRejectedAccessRequest and
+// LogGrantedAccessRequest.
+type DecisionAuditLogger interface {
+	AuditLogger
+
+	// LogDecision is called with the decision, the candidate policies it was made from and the time the evaluation
+	// took.
+	LogDecision(decision *Decision, pool Policies, duration time.Duration)
+}
@@ -0,0 +1,166 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// RedactedValue replaces the values of redacted context keys in the output of AuditLoggerJSON.
+const RedactedValue = "[REDACTED]"
+
+// AuditLoggerJSON writes one JSON object per access request decision, separated by new lines, which makes the audit
+// log machine readable.
+type AuditLoggerJSON struct {
+	// Writer receives the log entries. Defaults to os.Stderr.
+	Writer io.Writer
+
+	// RedactedContextKeys are the request context keys whose values are replaced by RedactedValue.
+	RedactedContextKeys []string
+
+	// Clock returns the time a decision is logged at. Defaults to time.Now.
+	Clock func() time.Time
+
+	sync.Mutex
+}
+
+// AuditLogEntry is the JSON object AuditLoggerJSON writes for every decision.
+type AuditLogEntry struct {
+	// Time is the time the decision was logged at.
+	Time time.Time `json:"time"`
+
+	// Request is the access request, with redacted context values.
+	Request *Request `json:"request"`
+
+	// Decision is either AllowAccess or DenyAccess.
+	Decision string `json:"decision"`
+
+	// Reason explains why access was denied.
+	Reason string `json:"reason,omitempty"`
+
+	// DecidingPolicy is the ID of the policy that finally decided the request.
+	DecidingPolicy string `json:"deciding_policy,omitempty"`
+
+	// Deciders are the IDs of all policies which led to the decision.
+	Deciders []string `json:"deciders"`
+
+	// Candidates is the number of candidate policies the request was evaluated against.
+	Candidates int `json:"candidates"`
+
+	// Duration is the time the evaluation took, in milliseconds. It is zero if the entry was not logged through
+	// LogDecision.
+	Duration float64 `json:"duration_ms"`
+}
+
+// LogDecision writes the decision as AuditLogEntry.
+func (a *AuditLoggerJSON) LogDecision(d *Decision, p Policies, duration time.Duration) {
+	a.log(d.Request, d.Allowed, d.Reason, d.DecidingPolicy, d.Deciders, p, duration)
+}
+
+// LogRejectedAccessRequest writes the rejected access request as AuditLogEntry.
+func (a *AuditLoggerJSON) LogRejectedAccessRequest(r *Request, p Policies, d Policies) {
+	var deciding string
+	var reason = ErrRequestDenied.Reason()
+	if len(d) > 0 {
+		deciding = d[len(d)-1].GetID()
+		reason = ErrRequestForcefullyDenied.Reason()
+	}
+	a.log(r, false, reason, deciding, d, p, 0)
+}
+
+// LogGrantedAccessRequest writes the granted access request as AuditLogEntry.
+func (a *AuditLoggerJSON) LogGrantedAccessRequest(r *Request, p Policies, d Policies) {
+	var deciding string
+	if len(d) > 0 {
+		deciding = d[0].GetID()
+	}
+	a.log(r, true, "", deciding, d, p, 0)
+}
+
+func (a *AuditLoggerJSON) log(r *Request, allowed bool, reason string, deciding string, d Policies, p Policies, duration time.Duration) {
+	var entry = &AuditLogEntry{
+		Time:           a.now(),
+		Request:        a.redact(r),
+		Decision:       DenyAccess,
+		Reason:         reason,
+		DecidingPolicy: deciding,
+		Deciders:       make([]string, len(d)),
+		Candidates:     len(p),
+		Duration:       float64(duration) / float64(time.Millisecond),
+	}
+	if allowed {
+		entry.Decision = AllowAccess
+	}
+	for k, policy := range d {
+		entry.Deciders[k] = policy.GetID()
+	}
+
+	out, err := json.Marshal(entry)
+	if err != nil {
+		// The context may hold values which can not be marshalled, the decision is still logged without it.
+		entry.Request.Context = nil
+		if out, err = json.Marshal(entry); err != nil {
+			return
+		}
+	}
+
+	a.Lock()
+	defer a.Unlock()
+	w := a.Writer
+	if w == nil {
+		w = os.Stderr
+	}
+	w.Write(append(out, '\n'))
+}
+
+func (a *AuditLoggerJSON) now() time.Time {
+	if a.Clock == nil {
+		return time.Now().UTC()
+	}
+	return a.Clock()
+}
+
+// redact returns a copy of the request whose context values are replaced by RedactedValue for all redacted keys.
+func (a *AuditLoggerJSON) redact(r *Request) *Request {
+	if r == nil {
+		return &Request{}
+	}
+
+	var rr = *r
+	if len(a.RedactedContextKeys) == 0 || len(r.Context) == 0 {
+		return &rr
+	}
+
+	rr.Context = make(Context, len(r.Context))
+	for k, v := range r.Context {
+		rr.Context[k] = v
+	}
+	for _, k := range a.RedactedContextKeys {
+		if _, ok := rr.Context[k]; ok {
+			rr.Context[k] = RedactedValue
+		}
+	}
+	return &rr
+}
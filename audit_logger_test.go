@@ -22,12 +22,16 @@ package ladon_test
 
 import (
 	"bytes"
+	"encoding/json"
 	"log"
+	"strings"
 	"testing"
+	"time"
 
 	. "github.com/ory/ladon"
 	. "github.com/ory/ladon/manager/memory"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestAuditLogger(t *testing.T) {
@@ -92,3 +96,96 @@ func TestAuditLogger(t *testing.T) {
 	assert.Nil(t, warden.IsAllowed(r))
 	assert.Equal(t, "policies yes-deletes allow access\n", output.String())
 }
+
+func TestAuditLoggerJSON(t *testing.T) {
+	var output bytes.Buffer
+	var now = time.Date(2018, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	warden := &Ladon{
+		Manager: NewMemoryManager(),
+		AuditLogger: &AuditLoggerJSON{
+			Writer:              &output,
+			RedactedContextKeys: []string{"token"},
+			Clock:               func() time.Time { return now },
+		},
+	}
+
+	warden.Manager.Create(&DefaultPolicy{
+		ID:        "yes-deletes",
+		Subjects:  []string{"<.*>"},
+		Actions:   []string{"delete"},
+		Resources: []string{"<.*>"},
+		Effect:    AllowAccess,
+	})
+	warden.Manager.Create(&DefaultPolicy{
+		ID:        "no-bob",
+		Subjects:  []string{"bob"},
+		Actions:   []string{"delete"},
+		Resources: []string{"<.*>"},
+		Effect:    DenyAccess,
+	})
+
+	for k, c := range []struct {
+		r        *Request
+		decision string
+		deciding string
+		deciders []string
+		reason   string
+		count    int
+	}{
+		{
+			r:        &Request{Subject: "alice", Action: "delete", Resource: "article", Context: Context{"token": "secret", "ip": "127.0.0.1"}},
+			decision: AllowAccess,
+			deciding: "yes-deletes",
+			deciders: []string{"yes-deletes"},
+			count:    1,
+		},
+		{
+			r:        &Request{Subject: "bob", Action: "delete", Resource: "article", Context: Context{"token": "secret", "ip": "127.0.0.1"}},
+			decision: DenyAccess,
+			deciding: "no-bob",
+			deciders: []string{"yes-deletes", "no-bob"},
+			reason:   ErrRequestForcefullyDenied.Reason(),
+			count:    2,
+		},
+		{
+			r:        &Request{Subject: "alice", Action: "update", Resource: "article", Context: Context{"token": "secret", "ip": "127.0.0.1"}},
+			decision: DenyAccess,
+			deciders: []string{},
+			reason:   ErrRequestDenied.Reason(),
+		},
+	} {
+		output.Reset()
+		warden.IsAllowed(c.r)
+
+		require.True(t, strings.HasSuffix(output.String(), "}\n"), "%d", k)
+		require.Equal(t, 1, strings.Count(output.String(), "\n"), "%d", k)
+
+		var entry AuditLogEntry
+		require.NoError(t, json.Unmarshal(output.Bytes(), &entry), "%d", k)
+		assert.True(t, now.Equal(entry.Time), "%d", k)
+		assert.Equal(t, c.decision, entry.Decision, "%d", k)
+		assert.Equal(t, c.deciding, entry.DecidingPolicy, "%d", k)
+		assert.Equal(t, c.deciders, entry.Deciders, "%d", k)
+		assert.Equal(t, c.reason, entry.Reason, "%d", k)
+		assert.Equal(t, c.count, entry.Candidates, "%d", k)
+		assert.True(t, entry.Duration > 0, "%d", k)
+		assert.Equal(t, c.r.Subject, entry.Request.Subject, "%d", k)
+		assert.Equal(t, c.r.Action, entry.Request.Action, "%d", k)
+		assert.Equal(t, c.r.Resource, entry.Request.Resource, "%d", k)
+		assert.Equal(t, Context{"token": RedactedValue, "ip": "127.0.0.1"}, entry.Request.Context, "%d", k)
+
+		// The request itself must not be modified by the redaction.
+		assert.Equal(t, "secret", c.r.Context["token"], "%d", k)
+	}
+
+	t.Run("case=unmarshalable context", func(t *testing.T) {
+		output.Reset()
+		warden.IsAllowed(&Request{Subject: "alice", Action: "delete", Context: Context{"fn": func() {}}})
+
+		var entry AuditLogEntry
+		require.NoError(t, json.Unmarshal(output.Bytes(), &entry))
+		assert.Equal(t, AllowAccess, entry.Decision)
+		assert.Nil(t, entry.Request.Context)
+	})
+}
@@ -80,6 +80,9 @@ func BenchmarkLadon(b *testing.B) {
 		})
 
 		b.Run(fmt.Sprintf("store=mysql/policies=%d", num), func(b *testing.B) {
+			if managers["mysql"] == nil {
+				b.Skip("mysql is not available")
+			}
 			benchmarkLadon(num, b, &ladon.Ladon{
 				Manager: managers["mysql"],
 				Matcher: ladon.NewRegexpMatcher(4096),
@@ -87,11 +90,21 @@ func BenchmarkLadon(b *testing.B) {
 		})
 
 		b.Run(fmt.Sprintf("store=postgres/policies=%d", num), func(b *testing.B) {
+			if managers["postgres"] == nil {
+				b.Skip("postgres is not available")
+			}
 			benchmarkLadon(num, b, &ladon.Ladon{
 				Manager: managers["postgres"],
 				Matcher: ladon.NewRegexpMatcher(4096),
 			})
 		})
+
+		b.Run(fmt.Sprintf("store=sqlite/policies=%d", num), func(b *testing.B) {
+			benchmarkLadon(num, b, &ladon.Ladon{
+				Manager: managers["sqlite"],
+				Matcher: ladon.NewRegexpMatcher(4096),
+			})
+		})
 	}
 }
 
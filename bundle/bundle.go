@@ -0,0 +1,305 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+// Package bundle defines a versioned format to move sets of policies between managers, e.g. to promote them from
+// staging to production. A bundle is a JSON document consisting of a manifest and the policies:
+//
+//	{
+//	  "manifest": {
+//	    "version": 1,
+//	    "created_at": "2018-03-01T00:00:00Z",
+//	    "policies": [{"id": "articles", "sha256": "7d8a..."}],
+//	    "digest": "b2c1..."
+//	  },
+//	  "policies": [{"id": "articles", "subjects": ["peter"], ...}]
+//	}
+//
+// The manifest lists the SHA-256 hash of every policy, and its digest is the SHA-256 hash of the manifest itself.
+// Bundles whose policies do not match their hashes are rejected.
+//
+// For tamper evidence, a bundle can be signed with an Ed25519 key, see Bundle.Sign. The signature covers the manifest
+// digest and is stored next to the manifest. A Loader only imports bundles signed by one of its trusted keys.
+package bundle
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/ory/ladon"
+	"github.com/pkg/errors"
+)
+
+// Version is the version of the bundle format written by this package.
+const Version = 1
+
+// exportPageSize is the number of policies fetched at once when exporting.
+const exportPageSize = 500
+
+// Entry lists a policy in the manifest.
+type Entry struct {
+	// ID is the ID of the policy.
+	ID string `json:"id"`
+
+	// SHA256 is the hex encoded SHA-256 hash of the policy, see Hash.
+	SHA256 string `json:"sha256"`
+}
+
+// Manifest describes the content of a bundle.
+type Manifest struct {
+	// Version is the version of the bundle format.
+	Version int `json:"version"`
+
+	// CreatedAt is when the bundle was created.
+	CreatedAt time.Time `json:"created_at"`
+
+	// Policies lists the policies of the bundle, ordered by their ID.
+	Policies []Entry `json:"policies"`
+
+	// Digest is the hex encoded SHA-256 hash of the manifest without its digest, see ComputeDigest.
+	Digest string `json:"digest"`
+}
+
+// ComputeDigest returns the hex encoded SHA-256 hash of the manifest's JSON encoding without its digest.
+func (m *Manifest) ComputeDigest() (string, error) {
+	c := *m
+	c.Digest = ""
+	out, err := json.Marshal(&c)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	sum := sha256.Sum256(out)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Bundle is a set of policies together with their manifest.
+type Bundle struct {
+	Manifest Manifest `json:"manifest"`
+
+	// Signature is the signature of the manifest digest, if the bundle is signed.
+	Signature *Signature `json:"signature,omitempty"`
+
+	Policies []*ladon.DefaultPolicy `json:"policies"`
+}
+
+// Hash returns the hex encoded SHA-256 hash of the policy's JSON encoding. The version of the policy is not part of
+// the hash, as it differs between managers.
+func Hash(p *ladon.DefaultPolicy) (string, error) {
+	c := *p
+	c.Version = 0
+	if c.Conditions == nil {
+		c.Conditions = ladon.Conditions{}
+	}
+
+	out, err := json.Marshal(&c)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	sum := sha256.Sum256(out)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// New creates a bundle of the policies.
+func New(policies ladon.Policies) (*Bundle, error) {
+	b := &Bundle{
+		Manifest: Manifest{
+			Version:   Version,
+			CreatedAt: time.Now().UTC().Truncate(time.Second),
+			Policies:  make([]Entry, len(policies)),
+		},
+		Policies: make([]*ladon.DefaultPolicy, len(policies)),
+	}
+
+	for k, p := range policies {
+		dp, err := toDefaultPolicy(p)
+		if err != nil {
+			return nil, err
+		}
+		b.Policies[k] = dp
+	}
+	sort.Slice(b.Policies, func(i, j int) bool { return b.Policies[i].ID < b.Policies[j].ID })
+
+	for k, p := range b.Policies {
+		if k > 0 && b.Policies[k-1].ID == p.ID {
+			return nil, errors.Errorf("Policy %s is contained more than once", p.ID)
+		}
+
+		sum, err := Hash(p)
+		if err != nil {
+			return nil, err
+		}
+		b.Manifest.Policies[k] = Entry{ID: p.ID, SHA256: sum}
+	}
+
+	digest, err := b.Manifest.ComputeDigest()
+	if err != nil {
+		return nil, err
+	}
+	b.Manifest.Digest = digest
+	return b, nil
+}
+
+// toDefaultPolicy converts a policy of any type to a DefaultPolicy.
+func toDefaultPolicy(p ladon.Policy) (*ladon.DefaultPolicy, error) {
+	if dp, ok := p.(*ladon.DefaultPolicy); ok {
+		return dp, nil
+	}
+
+	out, err := json.Marshal(p)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Could not encode policy %s", p.GetID())
+	}
+
+	var dp ladon.DefaultPolicy
+	if err := json.Unmarshal(out, &dp); err != nil {
+		return nil, errors.Wrapf(err, "Could not decode policy %s", p.GetID())
+	}
+	return &dp, nil
+}
+
+// Verify checks that the bundle's format version is supported, that its policies match the manifest and that they are
+// valid (see ladon.ValidatePolicy).
+func (b *Bundle) Verify() error {
+	if b.Manifest.Version != Version {
+		return errors.Errorf("Bundle format version %d is not supported, expected version %d", b.Manifest.Version, Version)
+	}
+
+	digest, err := b.Manifest.ComputeDigest()
+	if err != nil {
+		return err
+	} else if digest != b.Manifest.Digest {
+		return errors.Errorf("Manifest digest %s does not match its content, expected %s", b.Manifest.Digest, digest)
+	}
+
+	if len(b.Policies) != len(b.Manifest.Policies) {
+		return errors.Errorf("Bundle contains %d policies, but its manifest lists %d", len(b.Policies), len(b.Manifest.Policies))
+	}
+
+	for k, p := range b.Policies {
+		entry := b.Manifest.Policies[k]
+		if p.ID != entry.ID {
+			return errors.Errorf("Policy %d is %s, but the manifest lists %s", k, p.ID, entry.ID)
+		} else if k > 0 && b.Manifest.Policies[k-1].ID >= entry.ID {
+			return errors.Errorf("Manifest is not ordered by policy ID at policy %s", entry.ID)
+		}
+
+		sum, err := Hash(p)
+		if err != nil {
+			return err
+		} else if sum != entry.SHA256 {
+			return errors.Errorf("Policy %s does not match its hash %s", p.ID, entry.SHA256)
+		}
+
+		if err := ladon.ValidatePolicy(p); err != nil {
+			return errors.Wrapf(err, "Policy %s is invalid", p.ID)
+		}
+	}
+	return nil
+}
+
+// Read decodes and verifies a bundle.
+func Read(r io.Reader) (*Bundle, error) {
+	var b Bundle
+	if err := json.NewDecoder(r).Decode(&b); err != nil {
+		return nil, errors.Wrap(err, "Could not decode bundle")
+	}
+
+	if err := b.Verify(); err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// Write encodes the bundle.
+func (b *Bundle) Write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return errors.WithStack(enc.Encode(b))
+}
+
+// Export writes all policies of the manager as bundle.
+func Export(m ladon.Manager, w io.Writer) error {
+	b, err := collect(m)
+	if err != nil {
+		return err
+	}
+	return b.Write(w)
+}
+
+// collect creates a bundle of all policies of the manager.
+func collect(m ladon.Manager) (*Bundle, error) {
+	var policies ladon.Policies
+	for offset := int64(0); ; offset += exportPageSize {
+		page, err := m.GetAll(exportPageSize, offset)
+		if err != nil {
+			return nil, err
+		}
+		policies = append(policies, page...)
+		if len(page) < exportPageSize {
+			break
+		}
+	}
+
+	return New(policies)
+}
+
+// Import reads and verifies a bundle and creates its policies in the manager, or updates them if they exist already.
+// Policies of the manager which are not part of the bundle are kept.
+//
+// If the manager implements ladon.BatchManager, such as the SQL managers do, the policies are written all or nothing.
+// Otherwise they are written one by one, and an error may leave some of them written.
+func Import(r io.Reader, m ladon.Manager) error {
+	b, err := Read(r)
+	if err != nil {
+		return err
+	}
+	return b.Apply(m)
+}
+
+// Apply creates the bundle's policies in the manager, or updates them if they exist already, see Import.
+func (b *Bundle) Apply(m ladon.Manager) error {
+	policies := make(ladon.Policies, len(b.Policies))
+	for k, p := range b.Policies {
+		policies[k] = p
+	}
+
+	if bm, ok := m.(ladon.BatchManager); ok {
+		return errors.Wrap(bm.CreateOrUpdate(policies), "Could not import bundle")
+	}
+
+	for _, p := range policies {
+		if _, err := m.Get(p.GetID()); err == nil {
+			if err := m.Update(p); err != nil {
+				return errors.Wrapf(err, "Could not update policy %s", p.GetID())
+			}
+			continue
+		}
+
+		if err := m.Create(p); err != nil {
+			return errors.Wrapf(err, "Could not create policy %s", p.GetID())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,196 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package bundle_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/ory/ladon"
+	"github.com/ory/ladon/bundle"
+	"github.com/ory/ladon/manager/memory"
+	"github.com/ory/ladon/manager/rbac/store"
+	"github.com/ory/ladon/manager/sql"
+	"github.com/ory/ladon/manager/sql/sqlite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var notBefore = time.Date(2018, 3, 1, 0, 0, 0, 0, time.UTC)
+
+var testPolicies = ladon.Policies{
+	&ladon.DefaultPolicy{
+		ID:          "b",
+		Description: "b",
+		Subjects:    []string{"peter"},
+		Effect:      ladon.AllowAccess,
+		Resources:   []string{"articles:<[0-9]+>"},
+		Actions:     []string{"view"},
+		Conditions: ladon.Conditions{
+			"ip": &ladon.CIDRCondition{CIDR: "127.0.0.1/32"},
+		},
+		NotBefore: &notBefore,
+	},
+	&ladon.DefaultPolicy{
+		ID:         "a",
+		Subjects:   []string{"max"},
+		Effect:     ladon.DenyAccess,
+		Resources:  []string{"articles:1"},
+		Actions:    []string{"delete"},
+		Priority:   1,
+		Conditions: ladon.Conditions{},
+	},
+}
+
+func export(t *testing.T) []byte {
+	m := memory.NewMemoryManager()
+	for _, p := range testPolicies {
+		require.NoError(t, m.Create(p))
+	}
+
+	var out bytes.Buffer
+	require.NoError(t, bundle.Export(m, &out))
+	return out.Bytes()
+}
+
+func TestExportImport(t *testing.T) {
+	exported := export(t)
+
+	b, err := bundle.Read(bytes.NewReader(exported))
+	require.NoError(t, err)
+	assert.Equal(t, bundle.Version, b.Manifest.Version)
+	require.Len(t, b.Manifest.Policies, 2)
+	assert.Equal(t, "a", b.Manifest.Policies[0].ID)
+	assert.Equal(t, "b", b.Manifest.Policies[1].ID)
+
+	m := memory.NewMemoryManager()
+	require.NoError(t, m.Create(&ladon.DefaultPolicy{ID: "a", Effect: ladon.AllowAccess}))
+	require.NoError(t, m.Create(&ladon.DefaultPolicy{ID: "c", Effect: ladon.AllowAccess}))
+	require.NoError(t, bundle.Import(bytes.NewReader(exported), m))
+
+	all, err := m.GetAll(10, 0)
+	require.NoError(t, err)
+	require.Len(t, all, 3)
+	for _, p := range testPolicies {
+		got, err := m.Get(p.GetID())
+		require.NoError(t, err)
+		ladon.AssertPolicyEqual(t, p, got)
+	}
+
+	// Exporting the imported policies yields the same policies and hashes.
+	var out bytes.Buffer
+	require.NoError(t, bundle.Export(m, &out))
+	reexported, err := bundle.Read(&out)
+	require.NoError(t, err)
+	assert.Equal(t, b.Manifest.Policies, reexported.Manifest.Policies[:2])
+}
+
+func TestRead(t *testing.T) {
+	exported := export(t)
+
+	for k, tamper := range []func(b map[string]interface{}){
+		func(b map[string]interface{}) {
+			b["policies"].([]interface{})[0].(map[string]interface{})["effect"] = "allow"
+		},
+		func(b map[string]interface{}) {
+			b["policies"] = b["policies"].([]interface{})[:1]
+		},
+		func(b map[string]interface{}) {
+			b["manifest"].(map[string]interface{})["version"] = 2
+		},
+		func(b map[string]interface{}) {
+			b["manifest"].(map[string]interface{})["created_at"] = time.Now()
+		},
+		func(b map[string]interface{}) {
+			b["manifest"].(map[string]interface{})["digest"] = ""
+		},
+		func(b map[string]interface{}) {
+			ps := b["policies"].([]interface{})
+			ps[0], ps[1] = ps[1], ps[0]
+		},
+	} {
+		var b map[string]interface{}
+		require.NoError(t, json.Unmarshal(exported, &b))
+		tamper(b)
+
+		out, err := json.Marshal(b)
+		require.NoError(t, err)
+
+		_, err = bundle.Read(bytes.NewReader(out))
+		assert.Error(t, err, "%d", k)
+	}
+
+	_, err := bundle.Read(bytes.NewBufferString(`{`))
+	assert.Error(t, err)
+}
+
+func TestImportIsAtomic(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ladon-bundle")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"sql", "store"} {
+		t.Run("manager="+name, func(t *testing.T) {
+			db, err := sqlx.Open(sqlite.DriverName, filepath.Join(dir, name+".db"))
+			require.NoError(t, err)
+			defer db.Close()
+
+			var m ladon.Manager
+			if name == "sql" {
+				s := sql.NewSQLManager(db, nil)
+				_, err = s.CreateSchemas("", "")
+				m = s
+			} else {
+				s := store.NewStoreManager(db, nil)
+				_, err = s.CreateSchemas("", "")
+				m = s
+			}
+			require.NoError(t, err)
+
+			// Policy b is rejected after policy a was written.
+			_, err = db.Exec(`CREATE TRIGGER reject_b BEFORE INSERT ON ladon_policy WHEN NEW.id = 'b' BEGIN SELECT RAISE(ABORT, 'rejected'); END`)
+			require.NoError(t, err)
+
+			exported := export(t)
+			require.Error(t, bundle.Import(bytes.NewReader(exported), m))
+
+			all, err := m.GetAll(10, 0)
+			require.NoError(t, err)
+			assert.Empty(t, all)
+
+			_, err = db.Exec(`DROP TRIGGER reject_b`)
+			require.NoError(t, err)
+			require.NoError(t, bundle.Import(bytes.NewReader(exported), m))
+
+			for _, p := range testPolicies {
+				got, err := m.Get(p.GetID())
+				require.NoError(t, err)
+				ladon.AssertPolicyEqual(t, p, got)
+			}
+		})
+	}
+}
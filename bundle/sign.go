@@ -0,0 +1,220 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package bundle
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"io"
+	"io/ioutil"
+
+	"github.com/ory/ladon"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ed25519"
+)
+
+const (
+	privateKeyType = "ED25519 PRIVATE KEY"
+	publicKeyType  = "ED25519 PUBLIC KEY"
+)
+
+// Signature is an Ed25519 signature of a bundle's manifest digest.
+type Signature struct {
+	// KeyID identifies the public key which verifies the signature, see KeyID.
+	KeyID string `json:"key_id"`
+
+	// Value is the base64 encoded signature of the manifest digest.
+	Value string `json:"value"`
+}
+
+// KeyID returns the hex encoded first eight bytes of the SHA-256 hash of the public key.
+func KeyID(key ed25519.PublicKey) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:8])
+}
+
+// GenerateKey generates a key pair to sign and verify bundles.
+func GenerateKey() (ed25519.PublicKey, ed25519.PrivateKey, error) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	return public, private, errors.WithStack(err)
+}
+
+// Sign signs the bundle's manifest digest with the private key, replacing any previous signature. As the digest covers
+// the hash of every policy, the signature covers the policies as well.
+func (b *Bundle) Sign(key ed25519.PrivateKey) error {
+	if len(key) != ed25519.PrivateKeySize {
+		return errors.Errorf("Private key must be %d bytes long, got %d", ed25519.PrivateKeySize, len(key))
+	}
+
+	digest, err := b.Manifest.ComputeDigest()
+	if err != nil {
+		return err
+	} else if digest != b.Manifest.Digest {
+		return errors.Errorf("Manifest digest %s does not match its content, expected %s", b.Manifest.Digest, digest)
+	}
+
+	b.Signature = &Signature{
+		KeyID: KeyID(key.Public().(ed25519.PublicKey)),
+		Value: base64.StdEncoding.EncodeToString(ed25519.Sign(key, []byte(digest))),
+	}
+	return nil
+}
+
+// VerifySignature checks that the bundle is signed by one of the public keys. It returns ladon.ErrBundleUnsigned if
+// the bundle has no signature, and ladon.ErrBundleSignatureInvalid if the signature was made by another key or does
+// not match the manifest. The policies are checked against the manifest by Verify, which Read calls.
+func (b *Bundle) VerifySignature(keys ...ed25519.PublicKey) error {
+	if b.Signature == nil {
+		return errors.WithStack(ladon.ErrBundleUnsigned)
+	}
+
+	var key ed25519.PublicKey
+	for _, k := range keys {
+		if len(k) == ed25519.PublicKeySize && KeyID(k) == b.Signature.KeyID {
+			key = k
+			break
+		}
+	}
+	if key == nil {
+		return errors.Wrapf(ladon.ErrBundleSignatureInvalid, "Bundle is signed by untrusted key %s", b.Signature.KeyID)
+	}
+
+	digest, err := b.Manifest.ComputeDigest()
+	if err != nil {
+		return err
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(b.Signature.Value)
+	if err != nil || digest != b.Manifest.Digest || !ed25519.Verify(key, []byte(digest), signature) {
+		return errors.Wrapf(ladon.ErrBundleSignatureInvalid, "Signature of key %s does not match bundle %s", b.Signature.KeyID, b.Manifest.Digest)
+	}
+	return nil
+}
+
+// ExportSigned writes all policies of the manager as bundle signed with the private key.
+func ExportSigned(m ladon.Manager, w io.Writer, key ed25519.PrivateKey) error {
+	b, err := collect(m)
+	if err != nil {
+		return err
+	}
+
+	if err := b.Sign(key); err != nil {
+		return err
+	}
+	return b.Write(w)
+}
+
+// Loader imports bundles into a manager, but only those which are signed by one of its trusted keys. Unsigned
+// bundles and bundles with an invalid signature are rejected before anything is written.
+type Loader struct {
+	// Manager receives the policies of the bundles.
+	Manager ladon.Manager
+
+	// Keys are the public keys trusted to sign bundles.
+	Keys []ed25519.PublicKey
+}
+
+// NewLoader returns a loader which imports bundles signed by one of the keys into the manager.
+func NewLoader(m ladon.Manager, keys ...ed25519.PublicKey) *Loader {
+	return &Loader{Manager: m, Keys: keys}
+}
+
+// Load reads and verifies a bundle, checks its signature and imports its policies, see Import.
+func (l *Loader) Load(r io.Reader) (*Bundle, error) {
+	b, err := Read(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := b.VerifySignature(l.Keys...); err != nil {
+		return nil, err
+	}
+
+	if err := b.Apply(l.Manager); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// EncodePrivateKey encodes the private key as PEM block. Keep it secret.
+func EncodePrivateKey(key ed25519.PrivateKey) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: privateKeyType, Bytes: key})
+}
+
+// EncodePublicKey encodes the public key as PEM block.
+func EncodePublicKey(key ed25519.PublicKey) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: publicKeyType, Bytes: key})
+}
+
+// ParsePrivateKey decodes a private key encoded by EncodePrivateKey.
+func ParsePrivateKey(data []byte) (ed25519.PrivateKey, error) {
+	raw, err := decodeKey(data, privateKeyType, ed25519.PrivateKeySize)
+	if err != nil {
+		return nil, err
+	}
+	return ed25519.PrivateKey(raw), nil
+}
+
+// ParsePublicKey decodes a public key encoded by EncodePublicKey.
+func ParsePublicKey(data []byte) (ed25519.PublicKey, error) {
+	raw, err := decodeKey(data, publicKeyType, ed25519.PublicKeySize)
+	if err != nil {
+		return nil, err
+	}
+	return ed25519.PublicKey(raw), nil
+}
+
+// LoadPrivateKey reads a private key from a file, see ParsePrivateKey.
+func LoadPrivateKey(path string) (ed25519.PrivateKey, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	key, err := ParsePrivateKey(data)
+	return key, errors.Wrapf(err, "%s", path)
+}
+
+// LoadPublicKey reads a public key from a file, see ParsePublicKey.
+func LoadPublicKey(path string) (ed25519.PublicKey, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	key, err := ParsePublicKey(data)
+	return key, errors.Wrapf(err, "%s", path)
+}
+
+func decodeKey(data []byte, typ string, size int) ([]byte, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("No PEM block found")
+	} else if block.Type != typ {
+		return nil, errors.Errorf("PEM block is of type %s, expected %s", block.Type, typ)
+	} else if len(block.Bytes) != size {
+		return nil, errors.Errorf("Key must be %d bytes long, got %d", size, len(block.Bytes))
+	}
+	return block.Bytes, nil
+}
@@ -0,0 +1,156 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package bundle_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ory/ladon"
+	"github.com/ory/ladon/bundle"
+	"github.com/ory/ladon/manager/memory"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyFiles(t *testing.T) {
+	public, private, err := bundle.GenerateKey()
+	require.NoError(t, err)
+
+	dir, err := ioutil.TempDir("", "ladon-bundle")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "key"), bundle.EncodePrivateKey(private), 0600))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "key.pub"), bundle.EncodePublicKey(public), 0644))
+
+	loadedPrivate, err := bundle.LoadPrivateKey(filepath.Join(dir, "key"))
+	require.NoError(t, err)
+	assert.Equal(t, private, loadedPrivate)
+
+	loadedPublic, err := bundle.LoadPublicKey(filepath.Join(dir, "key.pub"))
+	require.NoError(t, err)
+	assert.Equal(t, public, loadedPublic)
+
+	// Keys are not interchangeable.
+	_, err = bundle.LoadPublicKey(filepath.Join(dir, "key"))
+	assert.Error(t, err)
+	_, err = bundle.LoadPrivateKey(filepath.Join(dir, "key.pub"))
+	assert.Error(t, err)
+	_, err = bundle.LoadPublicKey(filepath.Join(dir, "missing"))
+	assert.Error(t, err)
+}
+
+func TestSignedBundles(t *testing.T) {
+	public, private, err := bundle.GenerateKey()
+	require.NoError(t, err)
+	_, otherPrivate, err := bundle.GenerateKey()
+	require.NoError(t, err)
+
+	source := memory.NewMemoryManager()
+	for _, p := range testPolicies {
+		require.NoError(t, source.Create(p))
+	}
+
+	var signed bytes.Buffer
+	require.NoError(t, bundle.ExportSigned(source, &signed, private))
+
+	sign := func(t *testing.T, key []byte, tamper func(b *bundle.Bundle)) []byte {
+		b, err := bundle.Read(bytes.NewReader(signed.Bytes()))
+		require.NoError(t, err)
+		if key != nil {
+			require.NoError(t, b.Sign(key))
+		}
+		tamper(b)
+
+		out, err := json.Marshal(b)
+		require.NoError(t, err)
+		return out
+	}
+
+	for k, c := range []struct {
+		d      string
+		bundle []byte
+		err    error
+	}{
+		{d: "signed", bundle: signed.Bytes()},
+		{d: "unsigned", bundle: export(t), err: ladon.ErrBundleUnsigned},
+		{
+			d:      "untrusted key",
+			bundle: sign(t, otherPrivate, func(b *bundle.Bundle) {}),
+			err:    ladon.ErrBundleSignatureInvalid,
+		},
+		{
+			d: "forged key id",
+			bundle: sign(t, otherPrivate, func(b *bundle.Bundle) {
+				b.Signature.KeyID = bundle.KeyID(public)
+			}),
+			err: ladon.ErrBundleSignatureInvalid,
+		},
+		{
+			d: "malformed signature",
+			bundle: sign(t, nil, func(b *bundle.Bundle) {
+				b.Signature.Value = "not base64"
+			}),
+			err: ladon.ErrBundleSignatureInvalid,
+		},
+		{
+			d: "manifest changed after signing",
+			bundle: sign(t, nil, func(b *bundle.Bundle) {
+				b.Policies = b.Policies[:1]
+				b.Manifest.Policies = b.Manifest.Policies[:1]
+				digest, err := b.Manifest.ComputeDigest()
+				require.NoError(t, err)
+				b.Manifest.Digest = digest
+			}),
+			err: ladon.ErrBundleSignatureInvalid,
+		},
+	} {
+		m := memory.NewMemoryManager()
+		_, err := bundle.NewLoader(m, public).Load(bytes.NewReader(c.bundle))
+
+		all, getErr := m.GetAll(10, 0)
+		require.NoError(t, getErr)
+		if c.err == nil {
+			require.NoError(t, err, "%d: %s", k, c.d)
+			assert.Len(t, all, 2, "%d: %s", k, c.d)
+			continue
+		}
+
+		require.Error(t, err, "%d: %s", k, c.d)
+		assert.Equal(t, c.err, errors.Cause(err), "%d: %s", k, c.d)
+		assert.Empty(t, all, "%d: %s", k, c.d)
+	}
+
+	// Changing a policy after signing is caught by its hash.
+	tampered := sign(t, nil, func(b *bundle.Bundle) { b.Policies[0].Subjects = []string{"zac"} })
+	_, err = bundle.NewLoader(memory.NewMemoryManager(), public).Load(bytes.NewReader(tampered))
+	assert.Error(t, err)
+
+	// A loader without keys trusts no bundle.
+	_, err = bundle.NewLoader(memory.NewMemoryManager()).Load(bytes.NewReader(signed.Bytes()))
+	assert.Equal(t, ladon.ErrBundleSignatureInvalid, errors.Cause(err))
+}
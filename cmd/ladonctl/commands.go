@@ -0,0 +1,505 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+	"github.com/ory/ladon"
+	"github.com/ory/ladon/bundle"
+	"github.com/ory/ladon/manager/copier"
+	"github.com/ory/ladon/manager/file"
+	"github.com/ory/ladon/manager/sql"
+	"github.com/ory/ladon/manager/sql/sqlite"
+	"github.com/ory/ladon/policytest"
+	"github.com/pkg/errors"
+)
+
+var (
+	// errDenied is returned by evaluate if access was denied.
+	errDenied = errors.New("access denied")
+
+	// errTestsFailed is returned by test if a test case failed.
+	errTestsFailed = errors.New("test cases failed")
+)
+
+// exportPageSize is the number of policies fetched at once when exporting.
+const exportPageSize = 500
+
+func newFlagSet(name, args string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: ladonctl %s [FLAGS] %s\n\nFlags:\n", name, args)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+type sqlFlags struct {
+	driver string
+	dsn    string
+}
+
+func (f *sqlFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.driver, "driver", "", "The SQL driver, either postgres, mysql or sqlite3.")
+	fs.StringVar(&f.dsn, "dsn", "", "The data source name of the SQL database.")
+}
+
+func (f *sqlFlags) manager() (*sql.SQLManager, error) {
+	if f.driver == "" || f.dsn == "" {
+		return nil, errors.New("Flags -driver and -dsn are required")
+	}
+
+	driver := f.driver
+	if driver == "sqlite3" {
+		// The ladon driver adds the REGEXP function to SQLite.
+		driver = sqlite.DriverName
+	}
+
+	db, err := sqlx.Connect(driver, f.dsn)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Could not connect to %s database", f.driver)
+	}
+	return sql.NewSQLManager(db, nil), nil
+}
+
+func runValidate(args []string, stdout io.Writer) error {
+	fs := newFlagSet("validate", "POLICIES...")
+	if err := fs.Parse(args); err != nil {
+		return err
+	} else if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("No policy files given")
+	}
+
+	policies, err := file.Load(fs.Args()...)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(stdout, "%d policies are valid\n", len(policies))
+	return nil
+}
+
+func runEvaluate(args []string, stdout io.Writer) error {
+	fs := newFlagSet("evaluate", "REQUEST")
+	var policies = fs.String("policies", "", "The policy file or directory.")
+	if err := fs.Parse(args); err != nil {
+		return err
+	} else if fs.NArg() != 1 || *policies == "" {
+		fs.Usage()
+		return errors.New("Flag -policies and one request file are required")
+	}
+
+	m, err := file.NewFileManager(*policies)
+	if err != nil {
+		return err
+	}
+
+	data, err := readFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	var r ladon.Request
+	if err := json.Unmarshal(data, &r); err != nil {
+		return errors.Wrapf(err, "%s", fs.Arg(0))
+	}
+
+	d, err := (&ladon.Ladon{Manager: m}).Explain(&r)
+	if err != nil {
+		return err
+	}
+
+	out, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	fmt.Fprintf(stdout, "%s\n", out)
+
+	if !d.Allowed {
+		return errDenied
+	}
+	return nil
+}
+
+type replayResult struct {
+	Line           int            `json:"line"`
+	Request        *ladon.Request `json:"request"`
+	Allowed        bool           `json:"allowed"`
+	DecidingPolicy string         `json:"deciding_policy,omitempty"`
+	Reason         string         `json:"reason,omitempty"`
+}
+
+func runReplay(args []string, stdout io.Writer) error {
+	fs := newFlagSet("replay", "REQUESTS")
+	var sf sqlFlags
+	var policies = fs.String("policies", "", "The policy file or directory. Alternatively, policies are read from the SQL database.")
+	sf.register(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	} else if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("One requests file is required")
+	}
+
+	var m ladon.Manager
+	var err error
+	if *policies != "" {
+		m, err = file.NewFileManager(*policies)
+	} else {
+		m, err = sf.manager()
+	}
+	if err != nil {
+		return err
+	}
+
+	f, err := openFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	warden := &ladon.Ladon{Manager: m}
+	enc := json.NewEncoder(stdout)
+	return readRequests(f, func(line int, r *ladon.Request) error {
+		d, err := warden.Explain(r)
+		if err != nil {
+			return errors.Wrapf(err, "line %d", line)
+		}
+
+		return errors.WithStack(enc.Encode(&replayResult{
+			Line:           line,
+			Request:        r,
+			Allowed:        d.Allowed,
+			DecidingPolicy: d.DecidingPolicy,
+			Reason:         d.Reason,
+		}))
+	})
+}
+
+func runImport(args []string, stdout io.Writer) error {
+	fs := newFlagSet("import", "POLICIES...")
+	var sf sqlFlags
+	sf.register(fs)
+	var asBundle = fs.Bool("bundle", false, "Import a single bundle file instead of policy files, all or nothing.")
+	var verifyKey = fs.String("verify-key", "", "Only import the bundle if it is signed by the Ed25519 public key of this file.")
+	if err := fs.Parse(args); err != nil {
+		return err
+	} else if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("No policy files given")
+	} else if *asBundle && fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("Exactly one bundle file is required")
+	} else if *verifyKey != "" && !*asBundle {
+		fs.Usage()
+		return errors.New("Flag -verify-key requires flag -bundle")
+	}
+
+	if *asBundle {
+		f, err := openFile(fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		b, err := bundle.Read(f)
+		if err != nil {
+			return errors.Wrapf(err, "%s", fs.Arg(0))
+		}
+
+		if *verifyKey != "" {
+			key, err := bundle.LoadPublicKey(*verifyKey)
+			if err != nil {
+				return err
+			}
+			if err := b.VerifySignature(key); err != nil {
+				return errors.Wrapf(err, "%s", fs.Arg(0))
+			}
+		}
+
+		m, err := sf.manager()
+		if err != nil {
+			return err
+		}
+		return importBundle(m, b, stdout)
+	}
+
+	policies, err := file.Load(fs.Args()...)
+	if err != nil {
+		return err
+	}
+
+	m, err := sf.manager()
+	if err != nil {
+		return err
+	}
+
+	return importPolicies(m, policies, stdout)
+}
+
+// importPolicies creates the policies in the manager, or updates them if they already exist.
+func importPolicies(m ladon.Manager, policies []*ladon.DefaultPolicy, stdout io.Writer) error {
+	for _, p := range policies {
+		if _, err := m.Get(p.ID); err == nil {
+			if err := m.Update(p); err != nil {
+				return errors.Wrapf(err, "Could not update policy %s", p.ID)
+			}
+			fmt.Fprintf(stdout, "Updated policy %s\n", p.ID)
+			continue
+		}
+
+		if err := m.Create(p); err != nil {
+			return errors.Wrapf(err, "Could not create policy %s", p.ID)
+		}
+		fmt.Fprintf(stdout, "Created policy %s\n", p.ID)
+	}
+	return nil
+}
+
+// importBundle creates or updates the policies of the bundle in the manager.
+func importBundle(m ladon.Manager, b *bundle.Bundle, stdout io.Writer) error {
+	if err := b.Apply(m); err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "Imported %d policies of bundle %s\n", len(b.Policies), b.Manifest.Digest)
+	return nil
+}
+
+func runExport(args []string, stdout io.Writer) error {
+	fs := newFlagSet("export", "")
+	var sf sqlFlags
+	sf.register(fs)
+	var asBundle = fs.Bool("bundle", false, "Write a bundle with a manifest and content hashes instead of a JSON list.")
+	var signKey = fs.String("sign-key", "", "Sign the bundle with the Ed25519 private key of this file.")
+	if err := fs.Parse(args); err != nil {
+		return err
+	} else if *signKey != "" && !*asBundle {
+		fs.Usage()
+		return errors.New("Flag -sign-key requires flag -bundle")
+	}
+
+	m, err := sf.manager()
+	if err != nil {
+		return err
+	}
+
+	if *signKey != "" {
+		key, err := bundle.LoadPrivateKey(*signKey)
+		if err != nil {
+			return err
+		}
+		return bundle.ExportSigned(m, stdout, key)
+	} else if *asBundle {
+		return bundle.Export(m, stdout)
+	}
+	return exportPolicies(m, stdout)
+}
+
+// exportPolicies writes all policies of the manager as JSON list.
+func exportPolicies(m ladon.Manager, stdout io.Writer) error {
+	var policies = ladon.Policies{}
+	for offset := int64(0); ; offset += exportPageSize {
+		page, err := m.GetAll(exportPageSize, offset)
+		if err != nil {
+			return err
+		}
+		policies = append(policies, page...)
+		if len(page) < exportPageSize {
+			break
+		}
+	}
+
+	out, err := json.MarshalIndent(policies, "", "  ")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	fmt.Fprintf(stdout, "%s\n", out)
+	return nil
+}
+
+func runCopy(args []string, stdout io.Writer) error {
+	fs := newFlagSet("copy", "")
+	var from, to sqlFlags
+	var policies = fs.String("policies", "", "The policy file or directory to copy. Alternatively, policies are copied from the SQL database given by -from-driver and -from-dsn.")
+	fs.StringVar(&from.driver, "from-driver", "", "The SQL driver of the source database, either postgres, mysql or sqlite3.")
+	fs.StringVar(&from.dsn, "from-dsn", "", "The data source name of the source database.")
+	to.register(fs)
+	var dryRun = fs.Bool("dry-run", false, "Report what would be copied without writing to the destination.")
+	var onConflict = fs.String("on-conflict", string(copier.Fail), "What to do with policies which exist in the destination with a different content: fail, skip or overwrite.")
+	if err := fs.Parse(args); err != nil {
+		return err
+	} else if fs.NArg() != 0 {
+		fs.Usage()
+		return errors.New("Unexpected arguments")
+	}
+
+	var source ladon.Manager
+	var err error
+	if *policies != "" {
+		source, err = file.NewFileManager(*policies)
+	} else if from.driver != "" || from.dsn != "" {
+		source, err = from.manager()
+	} else {
+		fs.Usage()
+		return errors.New("Either flag -policies or flags -from-driver and -from-dsn are required")
+	}
+	if err != nil {
+		return err
+	}
+
+	destination, err := to.manager()
+	if err != nil {
+		return err
+	}
+
+	c := copier.NewCopier(source, destination)
+	c.DryRun = *dryRun
+	c.OnConflict = copier.Conflict(*onConflict)
+	return copyPolicies(c, stdout)
+}
+
+// copyPolicies runs the copier and reports its progress and result.
+func copyPolicies(c *copier.Copier, stdout io.Writer) error {
+	c.Progress = func(p copier.Progress) {
+		fmt.Fprintf(stdout, "Read %d policies\n", p.Read)
+	}
+
+	result, err := c.Copy()
+	if err != nil {
+		return err
+	}
+
+	verb := "Copied"
+	if c.DryRun {
+		verb = "Would copy"
+	}
+	fmt.Fprintf(stdout, "%s %d policies: %d created, %d updated, %d skipped, %d unchanged\n", verb, result.Read, result.Created, result.Updated, result.Skipped, result.Unchanged)
+	if result.Conflicting > 0 {
+		fmt.Fprintf(stdout, "Would fail because %d policies conflict, see -on-conflict\n", result.Conflicting)
+	}
+	for _, d := range result.Differences {
+		fmt.Fprintf(stdout, "Policy %s is %s in the destination\n", d.ID, d.Kind)
+	}
+	return nil
+}
+
+func runKeygen(args []string, stdout io.Writer) error {
+	fs := newFlagSet("keygen", "")
+	var private = fs.String("private", "", "The file to write the private key to, which must not exist yet.")
+	var public = fs.String("public", "", "The file to write the public key to, which must not exist yet.")
+	if err := fs.Parse(args); err != nil {
+		return err
+	} else if *private == "" || *public == "" {
+		fs.Usage()
+		return errors.New("Flags -private and -public are required")
+	}
+
+	publicKey, privateKey, err := bundle.GenerateKey()
+	if err != nil {
+		return err
+	}
+
+	if err := writeNewFile(*private, bundle.EncodePrivateKey(privateKey), 0600); err != nil {
+		return err
+	} else if err := writeNewFile(*public, bundle.EncodePublicKey(publicKey), 0644); err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "Generated key %s\n", bundle.KeyID(publicKey))
+	return nil
+}
+
+// writeNewFile writes data to a file which must not exist yet.
+func writeNewFile(path string, data []byte, perm os.FileMode) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(f.Close())
+}
+
+func runMigrate(args []string, stdout io.Writer) error {
+	fs := newFlagSet("migrate", "")
+	var sf sqlFlags
+	sf.register(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	m, err := sf.manager()
+	if err != nil {
+		return err
+	}
+
+	n, err := m.CreateSchemas("", "")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "Applied %d migrations\n", n)
+	return nil
+}
+
+func runTest(args []string, stdout io.Writer) error {
+	fs := newFlagSet("test", "SUITES...")
+	if err := fs.Parse(args); err != nil {
+		return err
+	} else if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("No test suites given")
+	}
+
+	var failed bool
+	for k, file := range fs.Args() {
+		s, err := policytest.Load(file)
+		if err != nil {
+			return err
+		}
+
+		report, err := policytest.Run(s)
+		if err != nil {
+			return errors.Wrapf(err, "%s", file)
+		}
+
+		if k > 0 {
+			fmt.Fprintln(stdout)
+		}
+		report.Print(stdout)
+		failed = failed || !report.Passed()
+	}
+
+	if failed {
+		return errTestsFailed
+	}
+	return nil
+}
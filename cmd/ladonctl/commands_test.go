@@ -0,0 +1,327 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ory/ladon"
+	"github.com/ory/ladon/bundle"
+	"github.com/ory/ladon/manager/copier"
+	"github.com/ory/ladon/manager/file"
+	"github.com/ory/ladon/manager/memory"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testPolicies = `[
+	{
+		"id": "articles",
+		"subjects": ["<peter|max>"],
+		"actions": ["get"],
+		"resources": ["articles:<[0-9]+>"],
+		"effect": "allow"
+	},
+	{
+		"id": "no-max",
+		"subjects": ["max"],
+		"actions": ["get"],
+		"resources": ["articles:42"],
+		"effect": "deny"
+	}
+]`
+
+func writeFiles(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "ladonctl")
+	require.NoError(t, err)
+
+	for name, content := range files {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755))
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	}
+	return dir
+}
+
+func TestValidate(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"policies/a.json":        testPolicies,
+		"policies/nested/b.json": `{"id": "single", "subjects": ["zac"], "effect": "deny", "conditions": {"ip": {"type": "CIDRCondition", "options": {"cidr": "10.0.0.0/8"}}}}`,
+		"policies/README.md":     `not a policy`,
+		"duplicate.json":         `{"id": "articles", "effect": "allow"}`,
+		"template.json":          `{"id": "broken", "effect": "allow", "resources": ["articles:<[0-9]+"]}`,
+		"condition.json":         `{"id": "broken", "effect": "allow", "conditions": {"ip": {"type": "DoesNotExist"}}}`,
+		"effect.json":            `[{"id": "broken", "effect": "permit"}]`,
+	})
+	defer os.RemoveAll(dir)
+
+	var out bytes.Buffer
+	require.NoError(t, runValidate([]string{filepath.Join(dir, "policies")}, &out))
+	assert.Equal(t, "3 policies are valid\n", out.String())
+
+	for _, file := range []string{"template.json", "condition.json", "effect.json"} {
+		err := runValidate([]string{filepath.Join(dir, file)}, &out)
+		require.Error(t, err, file)
+		assert.Contains(t, err.Error(), file)
+	}
+
+	err := runValidate([]string{filepath.Join(dir, "policies"), filepath.Join(dir, "duplicate.json")}, &out)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "already defined")
+}
+
+func TestEvaluate(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"policies.json": testPolicies,
+		"allowed.json":  `{"subject": "peter", "action": "get", "resource": "articles:42"}`,
+		"denied.json":   `{"subject": "max", "action": "get", "resource": "articles:42"}`,
+	})
+	defer os.RemoveAll(dir)
+
+	var out bytes.Buffer
+	require.NoError(t, runEvaluate([]string{"-policies", filepath.Join(dir, "policies.json"), filepath.Join(dir, "allowed.json")}, &out))
+
+	var d struct {
+		Allowed        bool   `json:"allowed"`
+		DecidingPolicy string `json:"deciding_policy"`
+	}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &d))
+	assert.True(t, d.Allowed)
+	assert.Equal(t, "articles", d.DecidingPolicy)
+
+	out.Reset()
+	assert.Equal(t, errDenied, runEvaluate([]string{"-policies", filepath.Join(dir, "policies.json"), filepath.Join(dir, "denied.json")}, &out))
+	assert.Contains(t, out.String(), `"deciding_policy": "no-max"`)
+}
+
+func TestReplay(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"policies.json": testPolicies,
+		"requests.jsonl": `{"subject": "peter", "action": "get", "resource": "articles:42"}
+
+{"subject": "max", "action": "get", "resource": "articles:42"}
+{"subject": "zac", "action": "get", "resource": "articles:42"}
+`,
+		"broken.jsonl": `{"subject": "peter"}
+{"subject":`,
+	})
+	defer os.RemoveAll(dir)
+
+	var out bytes.Buffer
+	require.NoError(t, runReplay([]string{"-policies", filepath.Join(dir, "policies.json"), filepath.Join(dir, "requests.jsonl")}, &out))
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Len(t, lines, 3)
+
+	var results []replayResult
+	for _, line := range lines {
+		var r replayResult
+		require.NoError(t, json.Unmarshal([]byte(line), &r))
+		results = append(results, r)
+	}
+
+	assert.Equal(t, 1, results[0].Line)
+	assert.True(t, results[0].Allowed)
+	assert.Equal(t, "articles", results[0].DecidingPolicy)
+	assert.Equal(t, 3, results[1].Line)
+	assert.False(t, results[1].Allowed)
+	assert.Equal(t, "no-max", results[1].DecidingPolicy)
+	assert.Equal(t, ladon.ErrRequestForcefullyDenied.Reason(), results[1].Reason)
+	assert.Equal(t, 4, results[2].Line)
+	assert.False(t, results[2].Allowed)
+	assert.Equal(t, ladon.ErrRequestDenied.Reason(), results[2].Reason)
+
+	err := runReplay([]string{"-policies", filepath.Join(dir, "policies.json"), filepath.Join(dir, "broken.jsonl")}, &out)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "line 2")
+}
+
+func TestImportExport(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"policies.json": testPolicies})
+	defer os.RemoveAll(dir)
+
+	policies, err := file.Load(filepath.Join(dir, "policies.json"))
+	require.NoError(t, err)
+
+	m := memory.NewMemoryManager()
+	var out bytes.Buffer
+	require.NoError(t, importPolicies(m, policies[:1], &out))
+	require.NoError(t, importPolicies(m, policies, &out))
+	assert.Equal(t, "Created policy articles\nUpdated policy articles\nCreated policy no-max\n", out.String())
+
+	out.Reset()
+	require.NoError(t, exportPolicies(m, &out))
+
+	var exported []*ladon.DefaultPolicy
+	require.NoError(t, json.Unmarshal(out.Bytes(), &exported))
+	assert.Len(t, exported, 2)
+
+	// The SQL database is required.
+	assert.Error(t, runImport([]string{filepath.Join(dir, "policies.json")}, &out))
+}
+
+func TestSQLite(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"policies.json": testPolicies})
+	defer os.RemoveAll(dir)
+
+	db := []string{"-driver", "sqlite3", "-dsn", filepath.Join(dir, "ladon.db")}
+	var out bytes.Buffer
+	require.NoError(t, runMigrate(db, &out))
+	require.NoError(t, runImport(append(db, filepath.Join(dir, "policies.json")), &out))
+
+	out.Reset()
+	require.NoError(t, runExport(db, &out))
+
+	var exported []*ladon.DefaultPolicy
+	require.NoError(t, json.Unmarshal(out.Bytes(), &exported))
+	assert.Len(t, exported, 2)
+}
+
+func TestImportBundle(t *testing.T) {
+	source := memory.NewMemoryManager()
+	require.NoError(t, source.Create(&ladon.DefaultPolicy{ID: "articles", Subjects: []string{"peter"}, Effect: ladon.AllowAccess}))
+
+	var exported bytes.Buffer
+	require.NoError(t, bundle.Export(source, &exported))
+	dir := writeFiles(t, map[string]string{"bundle.json": exported.String(), "policies.json": testPolicies})
+	defer os.RemoveAll(dir)
+
+	f, err := os.Open(filepath.Join(dir, "bundle.json"))
+	require.NoError(t, err)
+	defer f.Close()
+	b, err := bundle.Read(f)
+	require.NoError(t, err)
+
+	m := memory.NewMemoryManager()
+	var out bytes.Buffer
+	require.NoError(t, importBundle(m, b, &out))
+	assert.Equal(t, "Imported 1 policies of bundle "+b.Manifest.Digest+"\n", out.String())
+	_, err = m.Get("articles")
+	assert.NoError(t, err)
+
+	// Policy files are not bundles, and only a single bundle is imported at once.
+	assert.Error(t, runImport([]string{"-bundle", filepath.Join(dir, "policies.json")}, &out))
+	assert.Error(t, runImport([]string{"-bundle", filepath.Join(dir, "bundle.json"), filepath.Join(dir, "bundle.json")}, &out))
+}
+
+func TestSignedBundle(t *testing.T) {
+	dir := writeFiles(t, map[string]string{})
+	defer os.RemoveAll(dir)
+
+	var out bytes.Buffer
+	keygen := []string{"-private", filepath.Join(dir, "key"), "-public", filepath.Join(dir, "key.pub")}
+	require.NoError(t, runKeygen(keygen, &out))
+	assert.Contains(t, out.String(), "Generated key ")
+
+	// Existing keys are not overwritten.
+	require.Error(t, runKeygen(keygen, &out))
+
+	info, err := os.Stat(filepath.Join(dir, "key"))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	key, err := bundle.LoadPrivateKey(filepath.Join(dir, "key"))
+	require.NoError(t, err)
+
+	source := memory.NewMemoryManager()
+	require.NoError(t, source.Create(&ladon.DefaultPolicy{ID: "articles", Subjects: []string{"peter"}, Effect: ladon.AllowAccess}))
+
+	var signed, unsigned bytes.Buffer
+	require.NoError(t, bundle.ExportSigned(source, &signed, key))
+	require.NoError(t, bundle.Export(source, &unsigned))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "signed.json"), signed.Bytes(), 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "unsigned.json"), unsigned.Bytes(), 0644))
+
+	verify := []string{"-bundle", "-verify-key", filepath.Join(dir, "key.pub")}
+	err = runImport(append(verify, filepath.Join(dir, "unsigned.json")), &out)
+	assert.Equal(t, ladon.ErrBundleUnsigned, errors.Cause(err))
+
+	// The signature is accepted, but the SQL database is required.
+	err = runImport(append(verify, filepath.Join(dir, "signed.json")), &out)
+	require.Error(t, err)
+	assert.NotEqual(t, ladon.ErrBundleSignatureInvalid, errors.Cause(err))
+
+	assert.Error(t, runImport([]string{"-verify-key", filepath.Join(dir, "key.pub"), filepath.Join(dir, "signed.json")}, &out))
+	assert.Error(t, runExport([]string{"-sign-key", filepath.Join(dir, "key")}, &out))
+}
+
+func TestCopy(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"policies.json": testPolicies})
+	defer os.RemoveAll(dir)
+
+	source, err := file.NewFileManager(filepath.Join(dir, "policies.json"))
+	require.NoError(t, err)
+
+	destination := memory.NewMemoryManager()
+	require.NoError(t, destination.Create(&ladon.DefaultPolicy{ID: "no-max", Subjects: []string{"zac"}, Effect: ladon.DenyAccess}))
+
+	c := copier.NewCopier(source, destination)
+	c.OnConflict = copier.Skip
+
+	var out bytes.Buffer
+	require.NoError(t, copyPolicies(c, &out))
+	assert.Equal(t, "Read 2 policies\nCopied 2 policies: 1 created, 0 updated, 1 skipped, 0 unchanged\nPolicy no-max is changed in the destination\n", out.String())
+
+	// A dry run reports conflicts instead of failing.
+	c = copier.NewCopier(source, destination)
+	c.DryRun = true
+	require.NoError(t, destination.Delete("articles"))
+
+	out.Reset()
+	require.NoError(t, copyPolicies(c, &out))
+	assert.Equal(t, "Read 2 policies\nWould copy 2 policies: 1 created, 0 updated, 0 skipped, 0 unchanged\nWould fail because 1 policies conflict, see -on-conflict\nPolicy articles is missing in the destination\nPolicy no-max is changed in the destination\n", out.String())
+
+	// A source and the SQL database are required.
+	assert.Error(t, runCopy([]string{"-driver", "postgres", "-dsn", "postgres://"}, &out))
+	assert.Error(t, runCopy([]string{"-policies", filepath.Join(dir, "policies.json")}, &out))
+}
+
+func TestTest(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"passing.yaml": `
+name: passing
+policies:
+  - {id: articles, subjects: [peter], actions: [get], resources: ["<.*>"], effect: allow}
+cases:
+  - {description: peter may read, request: {subject: peter, action: get, resource: a}, expect: allow}
+`,
+		"failing.yaml": `
+name: failing
+cases:
+  - {description: peter may read, request: {subject: peter, action: get, resource: a}, expect: allow}
+`,
+	})
+	defer os.RemoveAll(dir)
+
+	var out bytes.Buffer
+	require.NoError(t, runTest([]string{filepath.Join(dir, "passing.yaml")}, &out))
+	assert.Equal(t, "Suite passing: 1 of 1 cases passed\n", out.String())
+
+	out.Reset()
+	assert.Equal(t, errTestsFailed, runTest([]string{filepath.Join(dir, "passing.yaml"), filepath.Join(dir, "failing.yaml")}, &out))
+	assert.Contains(t, out.String(), "Suite failing: 0 of 1 cases passed")
+}
@@ -0,0 +1,101 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+// Command ladonctl validates, evaluates, imports, exports and copies ladon policies.
+//
+//	ladonctl validate POLICIES...
+//	ladonctl evaluate -policies POLICIES REQUEST
+//	ladonctl replay (-policies POLICIES | -driver DRIVER -dsn DSN) REQUESTS
+//	ladonctl import -driver DRIVER -dsn DSN (POLICIES... | -bundle [-verify-key PUBLIC_KEY] BUNDLE)
+//	ladonctl export -driver DRIVER -dsn DSN [-bundle [-sign-key PRIVATE_KEY]]
+//	ladonctl keygen -private PRIVATE_KEY -public PUBLIC_KEY
+//	ladonctl migrate -driver DRIVER -dsn DSN
+//	ladonctl copy (-policies POLICIES | -from-driver DRIVER -from-dsn DSN) -driver DRIVER -dsn DSN
+//	ladonctl test SUITES...
+//
+// POLICIES are JSON files which contain either a single policy or a list of policies, or directories of such files.
+// REQUEST and REQUESTS are files which contain a single access request, or one access request per line. Use - to read
+// them from stdin. SUITES are test suites as described in package github.com/ory/ladon/policytest. BUNDLE is a policy
+// bundle as described in package github.com/ory/ladon/bundle, and PRIVATE_KEY and PUBLIC_KEY are the Ed25519 key files
+// written by keygen to sign and verify bundles.
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+type command struct {
+	usage string
+	run   func(args []string, stdout io.Writer) error
+}
+
+var commands = map[string]command{
+	"validate": {usage: "Validates policy files.", run: runValidate},
+	"evaluate": {usage: "Decides on an access request and explains the decision. Exits with 2 if access is denied.", run: runEvaluate},
+	"replay":   {usage: "Decides on every access request of a JSON lines file.", run: runReplay},
+	"import":   {usage: "Creates or updates the policies of policy files in a SQL database.", run: runImport},
+	"export":   {usage: "Writes all policies of a SQL database to stdout.", run: runExport},
+	"keygen":   {usage: "Generates an Ed25519 key pair to sign and verify bundles.", run: runKeygen},
+	"migrate":  {usage: "Creates or upgrades the SQL schema.", run: runMigrate},
+	"copy":     {usage: "Copies policies from policy files or a SQL database to a SQL database.", run: runCopy},
+	"test":     {usage: "Runs policy test suites. Exits with 1 if a test case fails.", run: runTest},
+}
+
+func usage(w io.Writer) {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(w, "Usage: ladonctl COMMAND [FLAGS] [ARGS]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, name := range names {
+		fmt.Fprintf(w, "  %-10s %s\n", name, commands[name].usage)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Run ladonctl COMMAND -h for the flags of a command.")
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage(os.Stderr)
+		os.Exit(1)
+	}
+
+	c, ok := commands[os.Args[1]]
+	if !ok {
+		usage(os.Stderr)
+		os.Exit(1)
+	}
+
+	if err := c.run(os.Args[2:], os.Stdout); err == errDenied {
+		os.Exit(2)
+	} else if err == errTestsFailed {
+		os.Exit(1)
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "%+v\n", err)
+		os.Exit(1)
+	}
+}
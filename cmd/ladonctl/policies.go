@@ -0,0 +1,78 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/ory/ladon"
+	"github.com/pkg/errors"
+)
+
+// readFile reads the file or stdin if the file is "-".
+func readFile(file string) ([]byte, error) {
+	var data []byte
+	var err error
+	if file == "-" {
+		data, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		data, err = ioutil.ReadFile(file)
+	}
+	return data, errors.WithStack(err)
+}
+
+// openFile opens the file or returns stdin if the file is "-".
+func openFile(file string) (io.ReadCloser, error) {
+	if file == "-" {
+		return ioutil.NopCloser(os.Stdin), nil
+	}
+	f, err := os.Open(file)
+	return f, errors.WithStack(err)
+}
+
+// readRequests calls fn for every access request of the reader, which contains one access request per line. Empty
+// lines are skipped.
+func readRequests(r io.Reader, fn func(line int, r *ladon.Request) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	var line int
+	for scanner.Scan() {
+		line++
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+
+		var r ladon.Request
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			return errors.Wrapf(err, "line %d", line)
+		}
+		if err := fn(line, &r); err != nil {
+			return err
+		}
+	}
+	return errors.WithStack(scanner.Err())
+}
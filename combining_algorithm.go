@@ -0,0 +1,177 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon
+
+import (
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// CombiningAlgorithm combines the effects of all policies which apply to an access request into a decision.
+type CombiningAlgorithm interface {
+	// GetName returns the algorithm's name.
+	GetName() string
+
+	// Combine receives the policies which apply to the request in the order they were evaluated. It returns the
+	// policies which decided the request and nil if access is granted, or an error otherwise.
+	Combine(r *Request, applicable Policies) (deciders Policies, err error)
+}
+
+// PriorityPolicy is implemented by policies which have a priority. Ordered combining algorithms like FirstApplicable
+// evaluate policies with a higher priority first. Policies which do not implement this interface have priority 0.
+type PriorityPolicy interface {
+	Policy
+
+	// GetPriority returns the policy's priority.
+	GetPriority() int
+}
+
+// DefaultCombiningAlgorithm is used if neither the warden nor the request specify a combining algorithm.
+var DefaultCombiningAlgorithm CombiningAlgorithm = &DenyOverrides{}
+
+// CombiningAlgorithms is where you can add custom combining algorithms. Requests select an algorithm by its name.
+var CombiningAlgorithms = map[string]CombiningAlgorithm{
+	new(DenyOverrides).GetName():     new(DenyOverrides),
+	new(PermitOverrides).GetName():   new(PermitOverrides),
+	new(FirstApplicable).GetName():   new(FirstApplicable),
+	new(OnlyOneApplicable).GetName(): new(OnlyOneApplicable),
+}
+
+// DenyOverrides denies access if any applicable policy denies it. Otherwise access is granted if at least one
+// policy allows it.
+type DenyOverrides struct{}
+
+// GetName returns the algorithm's name.
+func (a *DenyOverrides) GetName() string {
+	return "deny-overrides"
+}
+
+// Combine combines the applicable policies. If access is forcefully denied, the deciders are all allowing
+// policies followed by the first denying policy.
+func (a *DenyOverrides) Combine(r *Request, applicable Policies) (Policies, error) {
+	var allows = Policies{}
+	var deny Policy
+	for _, p := range applicable {
+		if p.AllowAccess() {
+			allows = append(allows, p)
+		} else if deny == nil {
+			deny = p
+		}
+	}
+
+	// Is the policies effect deny? If yes, this overrides all allow policies -> access denied.
+	if deny != nil {
+		return append(allows, deny), errors.WithStack(ErrRequestForcefullyDenied)
+	} else if len(allows) == 0 {
+		return allows, errors.WithStack(ErrRequestDenied)
+	}
+
+	return allows, nil
+}
+
+// PermitOverrides grants access if any applicable policy allows it. Otherwise access is denied, forcefully if at
+// least one policy denies it.
+type PermitOverrides struct{}
+
+// GetName returns the algorithm's name.
+func (a *PermitOverrides) GetName() string {
+	return "permit-overrides"
+}
+
+// Combine combines the applicable policies.
+func (a *PermitOverrides) Combine(r *Request, applicable Policies) (Policies, error) {
+	var allows, denies = Policies{}, Policies{}
+	for _, p := range applicable {
+		if p.AllowAccess() {
+			allows = append(allows, p)
+		} else {
+			denies = append(denies, p)
+		}
+	}
+
+	if len(allows) > 0 {
+		return allows, nil
+	} else if len(denies) > 0 {
+		return denies, errors.WithStack(ErrRequestForcefullyDenied)
+	}
+
+	return Policies{}, errors.WithStack(ErrRequestDenied)
+}
+
+// FirstApplicable lets the applicable policy with the highest priority decide. Policies with equal priority are
+// ordered by their ID.
+type FirstApplicable struct{}
+
+// GetName returns the algorithm's name.
+func (a *FirstApplicable) GetName() string {
+	return "first-applicable"
+}
+
+// Combine combines the applicable policies.
+func (a *FirstApplicable) Combine(r *Request, applicable Policies) (Policies, error) {
+	if len(applicable) == 0 {
+		return Policies{}, errors.WithStack(ErrRequestDenied)
+	}
+
+	ordered := make(Policies, len(applicable))
+	copy(ordered, applicable)
+	sort.Slice(ordered, func(i, j int) bool {
+		if pi, pj := priority(ordered[i]), priority(ordered[j]); pi != pj {
+			return pi > pj
+		}
+		return ordered[i].GetID() < ordered[j].GetID()
+	})
+
+	if first := ordered[0]; !first.AllowAccess() {
+		return Policies{first}, errors.WithStack(ErrRequestForcefullyDenied)
+	}
+	return Policies{ordered[0]}, nil
+}
+
+// OnlyOneApplicable lets the applicable policy decide if there is exactly one. If more than one policy applies,
+// access is denied.
+type OnlyOneApplicable struct{}
+
+// GetName returns the algorithm's name.
+func (a *OnlyOneApplicable) GetName() string {
+	return "only-one-applicable"
+}
+
+// Combine combines the applicable policies.
+func (a *OnlyOneApplicable) Combine(r *Request, applicable Policies) (Policies, error) {
+	switch {
+	case len(applicable) == 0:
+		return Policies{}, errors.WithStack(ErrRequestDenied)
+	case len(applicable) > 1:
+		return applicable, errors.WithStack(ErrRequestAmbiguous)
+	case !applicable[0].AllowAccess():
+		return applicable, errors.WithStack(ErrRequestForcefullyDenied)
+	}
+	return applicable, nil
+}
+
+func priority(p Policy) int {
+	if pp, ok := p.(PriorityPolicy); ok {
+		return pp.GetPriority()
+	}
+	return 0
+}
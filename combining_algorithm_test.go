@@ -0,0 +1,164 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon_test
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"testing"
+
+	. "github.com/ory/ladon"
+	. "github.com/ory/ladon/manager/memory"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var combiningPolicies = []Policy{
+	&DefaultPolicy{
+		ID:        "deny-all-deletes",
+		Subjects:  []string{"<.*>"},
+		Actions:   []string{"delete"},
+		Resources: []string{"<.*>"},
+		Effect:    DenyAccess,
+	},
+	&DefaultPolicy{
+		ID:        "allow-peter-delete-drafts",
+		Subjects:  []string{"peter"},
+		Actions:   []string{"delete"},
+		Resources: []string{"drafts:<.*>"},
+		Effect:    AllowAccess,
+		Priority:  10,
+	},
+	&DefaultPolicy{
+		ID:        "allow-reads",
+		Subjects:  []string{"<.*>"},
+		Actions:   []string{"get"},
+		Resources: []string{"<.*>"},
+		Effect:    AllowAccess,
+	},
+	&DefaultPolicy{
+		ID:        "allow-peter-reads",
+		Subjects:  []string{"peter"},
+		Actions:   []string{"get"},
+		Resources: []string{"<.*>"},
+		Effect:    AllowAccess,
+	},
+}
+
+func TestCombiningAlgorithms(t *testing.T) {
+	m := NewMemoryManager()
+	for _, pol := range combiningPolicies {
+		require.NoError(t, m.Create(pol))
+	}
+
+	deleteDraft := &Request{Subject: "peter", Action: "delete", Resource: "drafts:1"}
+	deleteArticle := &Request{Subject: "peter", Action: "delete", Resource: "articles:1"}
+	getArticle := &Request{Subject: "peter", Action: "get", Resource: "articles:1"}
+	updateAsKen := &Request{Subject: "ken", Action: "update", Resource: "articles:1"}
+
+	for k, c := range []struct {
+		algorithm CombiningAlgorithm
+		r         *Request
+		expect    error
+		deciding  string
+	}{
+		{algorithm: &DenyOverrides{}, r: deleteDraft, expect: ErrRequestForcefullyDenied, deciding: "deny-all-deletes"},
+		{algorithm: &DenyOverrides{}, r: deleteArticle, expect: ErrRequestForcefullyDenied, deciding: "deny-all-deletes"},
+		{algorithm: &DenyOverrides{}, r: getArticle},
+		{algorithm: &DenyOverrides{}, r: updateAsKen, expect: ErrRequestDenied},
+		{algorithm: &PermitOverrides{}, r: deleteDraft, deciding: "allow-peter-delete-drafts"},
+		{algorithm: &PermitOverrides{}, r: deleteArticle, expect: ErrRequestForcefullyDenied, deciding: "deny-all-deletes"},
+		{algorithm: &PermitOverrides{}, r: getArticle},
+		{algorithm: &PermitOverrides{}, r: updateAsKen, expect: ErrRequestDenied},
+		{algorithm: &FirstApplicable{}, r: deleteDraft, deciding: "allow-peter-delete-drafts"},
+		{algorithm: &FirstApplicable{}, r: deleteArticle, expect: ErrRequestForcefullyDenied, deciding: "deny-all-deletes"},
+		{algorithm: &FirstApplicable{}, r: getArticle, deciding: "allow-peter-reads"},
+		{algorithm: &FirstApplicable{}, r: updateAsKen, expect: ErrRequestDenied},
+		{algorithm: &OnlyOneApplicable{}, r: deleteDraft, expect: ErrRequestAmbiguous},
+		{algorithm: &OnlyOneApplicable{}, r: deleteArticle, expect: ErrRequestForcefullyDenied, deciding: "deny-all-deletes"},
+		{algorithm: &OnlyOneApplicable{}, r: getArticle, expect: ErrRequestAmbiguous},
+		{algorithm: &OnlyOneApplicable{}, r: updateAsKen, expect: ErrRequestDenied},
+	} {
+		t.Run(fmt.Sprintf("case=%d/algorithm=%s", k, c.algorithm.GetName()), func(t *testing.T) {
+			warden := &Ladon{Manager: m, CombiningAlgorithm: c.algorithm}
+			err := warden.IsAllowed(c.r)
+			assert.Equal(t, c.expect, errors.Cause(err))
+
+			// Selecting the algorithm through the request must yield the same result.
+			r := *c.r
+			r.CombiningAlgorithm = c.algorithm.GetName()
+			selectable := &Ladon{Manager: m, RequestCombiningAlgorithms: []string{c.algorithm.GetName()}}
+			assert.Equal(t, c.expect, errors.Cause(selectable.IsAllowed(&r)))
+
+			if c.deciding != "" {
+				d, err := warden.Explain(c.r)
+				require.NoError(t, err)
+				assert.Equal(t, c.deciding, d.DecidingPolicy)
+			}
+		})
+	}
+}
+
+func TestUnknownCombiningAlgorithm(t *testing.T) {
+	warden := &Ladon{Manager: NewMemoryManager(), RequestCombiningAlgorithms: []string{"does-not-exist"}}
+	err := warden.IsAllowed(&Request{CombiningAlgorithm: "does-not-exist"})
+	require.Error(t, err)
+	assert.Equal(t, ErrInvalidRequest, errors.Cause(err))
+}
+
+func TestRequestCombiningAlgorithmNotSelectable(t *testing.T) {
+	m := NewMemoryManager()
+	for _, pol := range combiningPolicies {
+		require.NoError(t, m.Create(pol))
+	}
+
+	// Selecting permit-overrides would allow this request, which the warden denies by default.
+	r := &Request{Subject: "peter", Action: "delete", Resource: "drafts:1", CombiningAlgorithm: "permit-overrides"}
+	err := (&Ladon{Manager: m}).IsAllowed(r)
+	require.Error(t, err)
+	assert.Equal(t, ErrInvalidRequest, errors.Cause(err))
+
+	err = (&Ladon{Manager: m, RequestCombiningAlgorithms: []string{"first-applicable"}}).IsAllowed(r)
+	require.Error(t, err)
+	assert.Equal(t, ErrInvalidRequest, errors.Cause(err))
+}
+
+func TestDecidersDoNotDependOnOrder(t *testing.T) {
+	deny := &DefaultPolicy{ID: "deny", Subjects: []string{"peter"}, Actions: []string{"delete"}, Resources: []string{"<.*>"}, Effect: DenyAccess}
+	allow := &DefaultPolicy{ID: "allow", Subjects: []string{"peter"}, Actions: []string{"delete"}, Resources: []string{"<.*>"}, Effect: AllowAccess}
+	r := &Request{Subject: "peter", Action: "delete", Resource: "articles:1"}
+
+	for _, policies := range [][]Policy{{deny, allow}, {allow, deny}} {
+		var output bytes.Buffer
+		warden := &Ladon{Manager: NewMemoryManager(), AuditLogger: &AuditLoggerInfo{Logger: log.New(&output, "", 0)}}
+		err := warden.DoPoliciesAllow(r, policies)
+		assert.Equal(t, ErrRequestForcefullyDenied, errors.Cause(err))
+		assert.Equal(t, "policies allow allow access, but policy deny forcefully denied it\n", output.String())
+
+		// Explanations report the same deciders as the audit log.
+		d, err := warden.ExplainPolicies(r, policies)
+		require.NoError(t, err)
+		assert.Equal(t, Policies{allow, deny}, d.Deciders)
+		assert.Equal(t, "deny", d.DecidingPolicy)
+	}
+}
@@ -21,6 +21,7 @@
 package ladon
 
 import (
+	"context"
 	"encoding/json"
 
 	"github.com/pkg/errors"
@@ -35,6 +36,46 @@ type Condition interface {
 	Fulfills(interface{}, *Request) bool
 }
 
+// ContextCondition is an optional interface a Condition can implement if it needs the context.Context of the access
+// request, for example to look up data with a deadline. Ladon calls FulfillsContext instead of Fulfills for conditions
+// implementing it.
+type ContextCondition interface {
+	Condition
+
+	// FulfillsContext returns true if the request is fulfilled by the condition.
+	FulfillsContext(context.Context, interface{}, *Request) bool
+}
+
+// NewContextCondition returns c if it implements ContextCondition. Otherwise c is wrapped in an adapter which
+// ignores the context and calls Fulfills. The adapter marshals to the same JSON as c.
+func NewContextCondition(c Condition) ContextCondition {
+	if cc, ok := c.(ContextCondition); ok {
+		return cc
+	}
+	return &contextCondition{Condition: c}
+}
+
+type contextCondition struct {
+	Condition
+}
+
+func (c *contextCondition) FulfillsContext(_ context.Context, value interface{}, r *Request) bool {
+	return c.Fulfills(value, r)
+}
+
+func (c *contextCondition) MarshalJSON() ([]byte, error) {
+	return json.Marshal(c.Condition)
+}
+
+// fulfills checks the condition against the request context value of key, passing ctx on if the condition implements
+// ContextCondition.
+func fulfills(ctx context.Context, key string, condition Condition, r *Request) bool {
+	if cc, ok := condition.(ContextCondition); ok {
+		return cc.FulfillsContext(ctx, r.Context[key], r)
+	}
+	return condition.Fulfills(r.Context[key], r)
+}
+
 // Conditions is a collection of conditions.
 type Conditions map[string]Condition
 
@@ -128,4 +169,34 @@ var ConditionFactories = map[string]func() Condition{
 	new(ResourceContainsCondition).GetName(): func() Condition {
 		return new(ResourceContainsCondition)
 	},
+	new(BooleanCondition).GetName(): func() Condition {
+		return new(BooleanCondition)
+	},
+	new(NumericGreaterThanCondition).GetName(): func() Condition {
+		return new(NumericGreaterThanCondition)
+	},
+	new(NumericLessThanCondition).GetName(): func() Condition {
+		return new(NumericLessThanCondition)
+	},
+	new(NumericBetweenCondition).GetName(): func() Condition {
+		return new(NumericBetweenCondition)
+	},
+	new(NumericEqualCondition).GetName(): func() Condition {
+		return new(NumericEqualCondition)
+	},
+	new(TimeWindowCondition).GetName(): func() Condition {
+		return new(TimeWindowCondition)
+	},
+	new(DateRangeCondition).GetName(): func() Condition {
+		return new(DateRangeCondition)
+	},
+	new(AndCondition).GetName(): func() Condition {
+		return &AndCondition{Conditions: Conditions{}}
+	},
+	new(OrCondition).GetName(): func() Condition {
+		return &OrCondition{Conditions: Conditions{}}
+	},
+	new(NotCondition).GetName(): func() Condition {
+		return &NotCondition{Conditions: Conditions{}}
+	},
 }
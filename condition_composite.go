@@ -0,0 +1,98 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon
+
+import "context"
+
+// AndCondition is a condition which is fulfilled if all of its conditions are fulfilled. Every nested condition is
+// checked against the request context value of its own key, the value of the AndCondition's key is ignored.
+type AndCondition struct {
+	Conditions Conditions `json:"conditions"`
+}
+
+// Fulfills returns true if all nested conditions are fulfilled.
+func (c *AndCondition) Fulfills(value interface{}, r *Request) bool {
+	return c.FulfillsContext(context.Background(), value, r)
+}
+
+// FulfillsContext returns true if all nested conditions are fulfilled.
+func (c *AndCondition) FulfillsContext(ctx context.Context, _ interface{}, r *Request) bool {
+	for key, condition := range c.Conditions {
+		if !fulfills(ctx, key, condition, r) {
+			return false
+		}
+	}
+	return true
+}
+
+// GetName returns the condition's name.
+func (c *AndCondition) GetName() string {
+	return "AndCondition"
+}
+
+// OrCondition is a condition which is fulfilled if at least one of its conditions is fulfilled. Every nested
+// condition is checked against the request context value of its own key, the value of the OrCondition's key is
+// ignored. An OrCondition without conditions is never fulfilled.
+type OrCondition struct {
+	Conditions Conditions `json:"conditions"`
+}
+
+// Fulfills returns true if at least one nested condition is fulfilled.
+func (c *OrCondition) Fulfills(value interface{}, r *Request) bool {
+	return c.FulfillsContext(context.Background(), value, r)
+}
+
+// FulfillsContext returns true if at least one nested condition is fulfilled.
+func (c *OrCondition) FulfillsContext(ctx context.Context, _ interface{}, r *Request) bool {
+	for key, condition := range c.Conditions {
+		if fulfills(ctx, key, condition, r) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetName returns the condition's name.
+func (c *OrCondition) GetName() string {
+	return "OrCondition"
+}
+
+// NotCondition is a condition which negates its conditions: It is fulfilled if they are not all fulfilled. Every
+// nested condition is checked against the request context value of its own key, the value of the NotCondition's key
+// is ignored. A NotCondition without conditions is never fulfilled.
+type NotCondition struct {
+	Conditions Conditions `json:"conditions"`
+}
+
+// Fulfills returns true if at least one nested condition is not fulfilled.
+func (c *NotCondition) Fulfills(value interface{}, r *Request) bool {
+	return c.FulfillsContext(context.Background(), value, r)
+}
+
+// FulfillsContext returns true if at least one nested condition is not fulfilled.
+func (c *NotCondition) FulfillsContext(ctx context.Context, value interface{}, r *Request) bool {
+	return !(&AndCondition{Conditions: c.Conditions}).FulfillsContext(ctx, value, r)
+}
+
+// GetName returns the condition's name.
+func (c *NotCondition) GetName() string {
+	return "NotCondition"
+}
@@ -0,0 +1,101 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompositeConditions(t *testing.T) {
+	officeOrMFA := &OrCondition{Conditions: Conditions{
+		"ip":  &CIDRCondition{CIDR: "10.0.0.0/8"},
+		"mfa": &BooleanCondition{BooleanValue: true},
+	}}
+
+	for k, c := range []struct {
+		condition Condition
+		ctx       Context
+		pass      bool
+	}{
+		{condition: officeOrMFA, ctx: Context{"ip": "10.1.2.3"}, pass: true},
+		{condition: officeOrMFA, ctx: Context{"ip": "192.168.1.1", "mfa": true}, pass: true},
+		{condition: officeOrMFA, ctx: Context{"ip": "192.168.1.1", "mfa": false}, pass: false},
+		{condition: officeOrMFA, ctx: Context{}, pass: false},
+		{condition: &AndCondition{Conditions: Conditions{
+			"ip":  &CIDRCondition{CIDR: "10.0.0.0/8"},
+			"mfa": &BooleanCondition{BooleanValue: true},
+		}}, ctx: Context{"ip": "10.1.2.3", "mfa": true}, pass: true},
+		{condition: &AndCondition{Conditions: Conditions{
+			"ip":  &CIDRCondition{CIDR: "10.0.0.0/8"},
+			"mfa": &BooleanCondition{BooleanValue: true},
+		}}, ctx: Context{"ip": "10.1.2.3", "mfa": false}, pass: false},
+		{condition: &NotCondition{Conditions: Conditions{
+			"ip": &CIDRCondition{CIDR: "10.0.0.0/8"},
+		}}, ctx: Context{"ip": "10.1.2.3"}, pass: false},
+		{condition: &NotCondition{Conditions: Conditions{
+			"ip": &CIDRCondition{CIDR: "10.0.0.0/8"},
+		}}, ctx: Context{"ip": "192.168.1.1"}, pass: true},
+		{condition: &NotCondition{Conditions: Conditions{"any": officeOrMFA}}, ctx: Context{"mfa": true}, pass: false},
+		{condition: &AndCondition{Conditions: Conditions{}}, ctx: Context{}, pass: true},
+		{condition: &OrCondition{Conditions: Conditions{}}, ctx: Context{}, pass: false},
+		{condition: &NotCondition{Conditions: Conditions{}}, ctx: Context{}, pass: false},
+	} {
+		assert.Equal(t, c.pass, c.condition.Fulfills(nil, &Request{Context: c.ctx}), "%d", k)
+	}
+}
+
+func TestCompositeConditionsMarshalUnmarshal(t *testing.T) {
+	css := Conditions{
+		"access": &OrCondition{Conditions: Conditions{
+			"ip": &CIDRCondition{CIDR: "10.0.0.0/8"},
+			"trusted": &AndCondition{Conditions: Conditions{
+				"mfa":    &StringEqualCondition{Equals: "yes"},
+				"remote": &NotCondition{Conditions: Conditions{"country": &StringEqualCondition{Equals: "xx"}}},
+			}},
+		}},
+	}
+
+	out, err := json.Marshal(css)
+	require.NoError(t, err)
+
+	cs := Conditions{}
+	require.NoError(t, json.Unmarshal(out, &cs))
+	assert.EqualValues(t, css, cs)
+
+	cs = Conditions{}
+	require.NoError(t, json.Unmarshal([]byte(`{
+	"access": {
+		"type": "OrCondition",
+		"options": {
+			"conditions": {
+				"ip": {"type": "CIDRCondition", "options": {"cidr": "10.0.0.0/8"}},
+				"mfa": {"type": "StringEqualCondition", "options": {"equals": "yes"}}
+			}
+		}
+	}
+}`), &cs))
+	require.IsType(t, &OrCondition{}, cs["access"])
+	assert.IsType(t, &CIDRCondition{}, cs["access"].(*OrCondition).Conditions["ip"])
+}
@@ -0,0 +1,136 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon
+
+import "encoding/json"
+
+// NumericGreaterThanCondition is a condition which is fulfilled if the given
+// value is a number greater than NumericGreaterThanCondition.Value
+type NumericGreaterThanCondition struct {
+	Value float64 `json:"value"`
+}
+
+// Fulfills returns true if the given value is a number and greater than
+// NumericGreaterThanCondition.Value
+func (c *NumericGreaterThanCondition) Fulfills(value interface{}, _ *Request) bool {
+	f, ok := toFloat64(value)
+
+	return ok && f > c.Value
+}
+
+// GetName returns the condition's name.
+func (c *NumericGreaterThanCondition) GetName() string {
+	return "NumericGreaterThanCondition"
+}
+
+// NumericLessThanCondition is a condition which is fulfilled if the given
+// value is a number less than NumericLessThanCondition.Value
+type NumericLessThanCondition struct {
+	Value float64 `json:"value"`
+}
+
+// Fulfills returns true if the given value is a number and less than
+// NumericLessThanCondition.Value
+func (c *NumericLessThanCondition) Fulfills(value interface{}, _ *Request) bool {
+	f, ok := toFloat64(value)
+
+	return ok && f < c.Value
+}
+
+// GetName returns the condition's name.
+func (c *NumericLessThanCondition) GetName() string {
+	return "NumericLessThanCondition"
+}
+
+// NumericBetweenCondition is a condition which is fulfilled if the given
+// value is a number between NumericBetweenCondition.Min and NumericBetweenCondition.Max,
+// both inclusive
+type NumericBetweenCondition struct {
+	Min float64 `json:"min"`
+	Max float64 `json:"max"`
+}
+
+// Fulfills returns true if the given value is a number and neither less than
+// NumericBetweenCondition.Min nor greater than NumericBetweenCondition.Max
+func (c *NumericBetweenCondition) Fulfills(value interface{}, _ *Request) bool {
+	f, ok := toFloat64(value)
+
+	return ok && f >= c.Min && f <= c.Max
+}
+
+// GetName returns the condition's name.
+func (c *NumericBetweenCondition) GetName() string {
+	return "NumericBetweenCondition"
+}
+
+// NumericEqualCondition is a condition which is fulfilled if the given
+// value is a number equal to NumericEqualCondition.Value
+type NumericEqualCondition struct {
+	Value float64 `json:"value"`
+}
+
+// Fulfills returns true if the given value is a number and equal to
+// NumericEqualCondition.Value
+func (c *NumericEqualCondition) Fulfills(value interface{}, _ *Request) bool {
+	f, ok := toFloat64(value)
+
+	return ok && f == c.Value
+}
+
+// GetName returns the condition's name.
+func (c *NumericEqualCondition) GetName() string {
+	return "NumericEqualCondition"
+}
+
+// toFloat64 converts the numeric types a request context might hold to float64. Besides float64, which is what
+// encoding/json decodes numbers to, all integer types and json.Number are supported.
+func toFloat64(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int8:
+		return float64(v), true
+	case int16:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint:
+		return float64(v), true
+	case uint8:
+		return float64(v), true
+	case uint16:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
@@ -0,0 +1,76 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNumericConditions(t *testing.T) {
+	for k, c := range []struct {
+		condition Condition
+		value     interface{}
+		pass      bool
+	}{
+		{condition: &NumericGreaterThanCondition{Value: 100}, value: 100.5, pass: true},
+		{condition: &NumericGreaterThanCondition{Value: 100}, value: 100, pass: false},
+		{condition: &NumericGreaterThanCondition{Value: 100}, value: int64(101), pass: true},
+		{condition: &NumericGreaterThanCondition{Value: 100}, value: json.Number("1e3"), pass: true},
+		{condition: &NumericGreaterThanCondition{Value: 100}, value: json.Number("abc"), pass: false},
+		{condition: &NumericGreaterThanCondition{Value: 100}, value: "1000", pass: false},
+		{condition: &NumericGreaterThanCondition{Value: 100}, value: nil, pass: false},
+		{condition: &NumericLessThanCondition{Value: 0.5}, value: float32(0.25), pass: true},
+		{condition: &NumericLessThanCondition{Value: 0.5}, value: 0.5, pass: false},
+		{condition: &NumericLessThanCondition{Value: 0}, value: -1, pass: true},
+		{condition: &NumericLessThanCondition{Value: 10}, value: uint8(9), pass: true},
+		{condition: &NumericBetweenCondition{Min: 1, Max: 10}, value: 1, pass: true},
+		{condition: &NumericBetweenCondition{Min: 1, Max: 10}, value: 10.0, pass: true},
+		{condition: &NumericBetweenCondition{Min: 1, Max: 10}, value: 10.01, pass: false},
+		{condition: &NumericBetweenCondition{Min: 1, Max: 10}, value: json.Number("0"), pass: false},
+		{condition: &NumericEqualCondition{Value: 42}, value: int32(42), pass: true},
+		{condition: &NumericEqualCondition{Value: 42}, value: 42.0, pass: true},
+		{condition: &NumericEqualCondition{Value: 42}, value: 41, pass: false},
+		{condition: &NumericEqualCondition{Value: 42}, value: true, pass: false},
+	} {
+		assert.Equal(t, c.pass, c.condition.Fulfills(c.value, new(Request)), "%d", k)
+	}
+}
+
+func TestNumericConditionsMarshalUnmarshal(t *testing.T) {
+	css := Conditions{
+		"amount": &NumericBetweenCondition{Min: 0, Max: 1000.5},
+		"risk":   &NumericLessThanCondition{Value: 0.7},
+		"quota":  &NumericGreaterThanCondition{Value: -1},
+		"tier":   &NumericEqualCondition{Value: 3},
+		"mfa":    &BooleanCondition{BooleanValue: true},
+	}
+
+	out, err := json.Marshal(css)
+	require.NoError(t, err)
+
+	cs := Conditions{}
+	require.NoError(t, json.Unmarshal(out, &cs))
+	assert.EqualValues(t, css, cs)
+}
@@ -0,0 +1,233 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// locations caches the time zones of time window conditions, as loading them may read the zoneinfo database.
+var locations sync.Map
+
+// TimeWindowCondition is a condition which is fulfilled if the time of the request lies within a daily time window
+// and on one of the given weekdays, for example during business hours.
+//
+// The time of the request is taken from the request's context if it holds a time.Time or an RFC3339 string under the
+// condition's key. Otherwise the condition's clock is used, which defaults to the warden's clock (see Ladon.Clock).
+type TimeWindowCondition struct {
+	// After is the inclusive start of the window in the 24-hour format "15:04". If empty, the window starts at midnight.
+	After string `json:"after,omitempty"`
+
+	// Before is the exclusive end of the window in the 24-hour format "15:04". If empty, the window ends at midnight.
+	// If Before is earlier than After, the window spans midnight, e.g. from "22:00" to "06:00".
+	Before string `json:"before,omitempty"`
+
+	// Weekdays the window applies to, e.g. "Monday" or "Mon". If empty, the window applies to every day. A window which
+	// spans midnight belongs to the day it starts on, e.g. Friday from "22:00" to "02:00" includes Saturday 01:00.
+	Weekdays []string `json:"weekdays,omitempty"`
+
+	// Location is the IANA time zone, e.g. "Europe/Berlin", the window is defined in. Defaults to UTC.
+	Location string `json:"location,omitempty"`
+
+	// Clock returns the current time. Defaults to the time the request is evaluated at, see EvaluationTime.
+	Clock func() time.Time `json:"-"`
+
+	// location is Location resolved when the condition is unmarshalled.
+	location *time.Location
+}
+
+// UnmarshalJSON decodes the condition and resolves its location once, so that it is not loaded on every evaluation.
+// Unknown locations are rejected.
+func (c *TimeWindowCondition) UnmarshalJSON(data []byte) error {
+	type condition TimeWindowCondition
+	var cc condition
+	if err := json.Unmarshal(data, &cc); err != nil {
+		return errors.WithStack(err)
+	}
+
+	loc, err := loadLocation(cc.Location)
+	if err != nil {
+		return errors.Wrapf(err, "Could not load location %s", cc.Location)
+	}
+
+	*c = TimeWindowCondition(cc)
+	c.location = loc
+	return nil
+}
+
+// Fulfills returns true if the time of the request lies within the time window.
+func (c *TimeWindowCondition) Fulfills(value interface{}, r *Request) bool {
+	return c.FulfillsContext(context.Background(), value, r)
+}
+
+// FulfillsContext is like Fulfills, but defaults to the time the request is evaluated at according to ctx.
+func (c *TimeWindowCondition) FulfillsContext(ctx context.Context, value interface{}, _ *Request) bool {
+	now, ok := conditionTime(ctx, value, c.Clock)
+	if !ok {
+		return false
+	}
+
+	loc := c.location
+	if loc == nil {
+		var err error
+		if loc, err = loadLocation(c.Location); err != nil {
+			return false
+		}
+	}
+	now = now.In(loc)
+
+	var start, end = time.Duration(0), 24 * time.Hour
+	if c.After != "" {
+		if start, ok = parseTimeOfDay(c.After); !ok {
+			return false
+		}
+	}
+	if c.Before != "" {
+		if end, ok = parseTimeOfDay(c.Before); !ok {
+			return false
+		}
+	}
+
+	// The weekday is the one the window started on, which is the previous day after midnight if the window spans it.
+	var t = time.Duration(now.Hour())*time.Hour + time.Duration(now.Minute())*time.Minute + time.Duration(now.Second())*time.Second
+	var weekday = now.Weekday()
+	if end < start {
+		if t < end {
+			weekday = now.AddDate(0, 0, -1).Weekday()
+		} else if t < start {
+			return false
+		}
+	} else if t < start || t >= end {
+		return false
+	}
+
+	if len(c.Weekdays) == 0 {
+		return true
+	}
+	for _, d := range c.Weekdays {
+		if wd, ok := parseWeekday(d); ok && wd == weekday {
+			return true
+		}
+	}
+	return false
+}
+
+// GetName returns the condition's name.
+func (c *TimeWindowCondition) GetName() string {
+	return "TimeWindowCondition"
+}
+
+// DateRangeCondition is a condition which is fulfilled if the time of the request lies between two points in time,
+// for example to grant temporary access.
+//
+// The time of the request is taken from the request's context if it holds a time.Time or an RFC3339 string under the
+// condition's key. Otherwise the condition's clock is used, which defaults to the warden's clock (see Ladon.Clock).
+type DateRangeCondition struct {
+	// NotBefore is the inclusive start of the range. The zero value means the range has no start.
+	NotBefore time.Time `json:"not_before"`
+
+	// NotAfter is the inclusive end of the range. The zero value means the range has no end.
+	NotAfter time.Time `json:"not_after"`
+
+	// Clock returns the current time. Defaults to the time the request is evaluated at, see EvaluationTime.
+	Clock func() time.Time `json:"-"`
+}
+
+// Fulfills returns true if the time of the request lies within the date range.
+func (c *DateRangeCondition) Fulfills(value interface{}, r *Request) bool {
+	return c.FulfillsContext(context.Background(), value, r)
+}
+
+// FulfillsContext is like Fulfills, but defaults to the time the request is evaluated at according to ctx.
+func (c *DateRangeCondition) FulfillsContext(ctx context.Context, value interface{}, _ *Request) bool {
+	now, ok := conditionTime(ctx, value, c.Clock)
+	if !ok {
+		return false
+	}
+
+	if !c.NotBefore.IsZero() && now.Before(c.NotBefore) {
+		return false
+	}
+	if !c.NotAfter.IsZero() && now.After(c.NotAfter) {
+		return false
+	}
+	return true
+}
+
+// GetName returns the condition's name.
+func (c *DateRangeCondition) GetName() string {
+	return "DateRangeCondition"
+}
+
+// conditionTime returns the time a time based condition is checked against: value if it is a time.Time or an RFC3339
+// string, the clock's time if value is nil, or the time the request is evaluated at if there is no clock either.
+func conditionTime(ctx context.Context, value interface{}, clock func() time.Time) (time.Time, bool) {
+	switch v := value.(type) {
+	case nil:
+		if clock == nil {
+			return EvaluationTime(ctx), true
+		}
+		return clock(), true
+	case time.Time:
+		return v, true
+	case string:
+		t, err := time.Parse(time.RFC3339, v)
+		return t, err == nil
+	}
+	return time.Time{}, false
+}
+
+// loadLocation is like time.LoadLocation, but caches the locations it loaded.
+func loadLocation(name string) (*time.Location, error) {
+	if loc, ok := locations.Load(name); ok {
+		return loc.(*time.Location), nil
+	}
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	locations.Store(name, loc)
+	return loc, nil
+}
+
+func parseTimeOfDay(s string) (time.Duration, bool) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, false
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, true
+}
+
+func parseWeekday(s string) (time.Weekday, bool) {
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		if strings.EqualFold(s, d.String()) || strings.EqualFold(s, d.String()[:3]) {
+			return d, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,174 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimeWindowCondition(t *testing.T) {
+	// 2018-03-05 is a Monday.
+	at := func(s string) func() time.Time {
+		return func() time.Time {
+			t, _ := time.Parse(time.RFC3339, s)
+			return t
+		}
+	}
+
+	businessHours := func(clock func() time.Time) *TimeWindowCondition {
+		return &TimeWindowCondition{
+			After:    "09:00",
+			Before:   "17:00",
+			Weekdays: []string{"Mon", "tuesday", "Wednesday", "Thu", "Fri"},
+			Location: "Europe/Berlin",
+			Clock:    clock,
+		}
+	}
+
+	for k, c := range []struct {
+		condition *TimeWindowCondition
+		value     interface{}
+		pass      bool
+	}{
+		{condition: businessHours(at("2018-03-05T08:00:00Z")), pass: true},
+		{condition: businessHours(at("2018-03-05T07:59:59Z")), pass: false},
+		{condition: businessHours(at("2018-03-05T16:00:00Z")), pass: false},
+		{condition: businessHours(at("2018-03-05T15:59:00Z")), pass: true},
+		{condition: businessHours(at("2018-03-04T12:00:00Z")), pass: false},
+		{condition: businessHours(at("2018-03-04T12:00:00Z")), value: "2018-03-05T10:00:00+01:00", pass: true},
+		{condition: businessHours(at("2018-03-05T12:00:00Z")), value: time.Date(2018, 3, 10, 12, 0, 0, 0, time.UTC), pass: false},
+		{condition: businessHours(at("2018-03-05T12:00:00Z")), value: "tomorrow", pass: false},
+		{condition: businessHours(at("2018-03-05T12:00:00Z")), value: 1234, pass: false},
+		{condition: &TimeWindowCondition{After: "22:00", Before: "06:00", Clock: at("2018-03-05T23:30:00Z")}, pass: true},
+		{condition: &TimeWindowCondition{After: "22:00", Before: "06:00", Clock: at("2018-03-05T05:59:00Z")}, pass: true},
+		{condition: &TimeWindowCondition{After: "22:00", Before: "06:00", Clock: at("2018-03-05T12:00:00Z")}, pass: false},
+		{condition: &TimeWindowCondition{After: "12:00", Clock: at("2018-03-05T23:59:59Z")}, pass: true},
+		// A window spanning midnight belongs to the day it starts on.
+		{condition: &TimeWindowCondition{After: "22:00", Before: "02:00", Weekdays: []string{"Fri"}, Clock: at("2018-03-09T23:00:00Z")}, pass: true},
+		{condition: &TimeWindowCondition{After: "22:00", Before: "02:00", Weekdays: []string{"Fri"}, Clock: at("2018-03-10T01:00:00Z")}, pass: true},
+		{condition: &TimeWindowCondition{After: "22:00", Before: "02:00", Weekdays: []string{"Fri"}, Clock: at("2018-03-09T01:00:00Z")}, pass: false},
+		{condition: &TimeWindowCondition{After: "22:00", Before: "02:00", Weekdays: []string{"Sat"}, Clock: at("2018-03-10T01:00:00Z")}, pass: false},
+		{condition: &TimeWindowCondition{Weekdays: []string{"Sunday"}, Clock: at("2018-03-05T12:00:00Z")}, pass: false},
+		{condition: &TimeWindowCondition{After: "25:00", Clock: at("2018-03-05T12:00:00Z")}, pass: false},
+		{condition: &TimeWindowCondition{Location: "Nowhere/Special", Clock: at("2018-03-05T12:00:00Z")}, pass: false},
+		{condition: &TimeWindowCondition{}, pass: true},
+	} {
+		assert.Equal(t, c.pass, c.condition.Fulfills(c.value, new(Request)), "%d", k)
+	}
+}
+
+func TestDateRangeCondition(t *testing.T) {
+	start := time.Date(2018, 3, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2018, 3, 31, 23, 59, 59, 0, time.UTC)
+	clock := func(t time.Time) func() time.Time {
+		return func() time.Time { return t }
+	}
+
+	for k, c := range []struct {
+		condition *DateRangeCondition
+		value     interface{}
+		pass      bool
+	}{
+		{condition: &DateRangeCondition{NotBefore: start, NotAfter: end, Clock: clock(start)}, pass: true},
+		{condition: &DateRangeCondition{NotBefore: start, NotAfter: end, Clock: clock(end)}, pass: true},
+		{condition: &DateRangeCondition{NotBefore: start, NotAfter: end, Clock: clock(end.Add(time.Second))}, pass: false},
+		{condition: &DateRangeCondition{NotBefore: start, NotAfter: end, Clock: clock(start.Add(-time.Second))}, pass: false},
+		{condition: &DateRangeCondition{NotBefore: start, Clock: clock(end.AddDate(10, 0, 0))}, pass: true},
+		{condition: &DateRangeCondition{NotAfter: end, Clock: clock(start.AddDate(-10, 0, 0))}, pass: true},
+		{condition: &DateRangeCondition{NotBefore: start, NotAfter: end}, value: "2018-03-01T00:30:00+01:00", pass: false},
+		{condition: &DateRangeCondition{NotBefore: start, NotAfter: end}, value: "2018-04-01T00:30:00+01:00", pass: true},
+		{condition: &DateRangeCondition{NotBefore: start, NotAfter: end}, value: false, pass: false},
+	} {
+		assert.Equal(t, c.pass, c.condition.Fulfills(c.value, new(Request)), "%d", k)
+	}
+}
+
+func TestTimeConditionsMarshalUnmarshal(t *testing.T) {
+	css := Conditions{
+		"hours": &TimeWindowCondition{After: "09:00", Before: "17:00", Weekdays: []string{"Mon"}, Location: "Europe/Berlin"},
+		"contract": &DateRangeCondition{
+			NotBefore: time.Date(2018, 3, 1, 0, 0, 0, 0, time.UTC),
+			NotAfter:  time.Date(2018, 3, 31, 0, 0, 0, 0, time.UTC),
+		},
+	}
+
+	out, err := json.Marshal(css)
+	require.NoError(t, err)
+
+	cs := Conditions{}
+	require.NoError(t, json.Unmarshal(out, &cs))
+	require.IsType(t, &TimeWindowCondition{}, cs["hours"])
+	hours := cs["hours"].(*TimeWindowCondition)
+	assert.Equal(t, "09:00", hours.After)
+	assert.Equal(t, "17:00", hours.Before)
+	assert.Equal(t, []string{"Mon"}, hours.Weekdays)
+	assert.Equal(t, "Europe/Berlin", hours.Location)
+	assert.Equal(t, "Europe/Berlin", hours.location.String())
+	require.IsType(t, &DateRangeCondition{}, cs["contract"])
+	assert.True(t, css["contract"].(*DateRangeCondition).NotBefore.Equal(cs["contract"].(*DateRangeCondition).NotBefore))
+	assert.True(t, css["contract"].(*DateRangeCondition).NotAfter.Equal(cs["contract"].(*DateRangeCondition).NotAfter))
+
+	cs = Conditions{}
+	require.NoError(t, json.Unmarshal([]byte(`{
+	"contract": {
+		"type": "DateRangeCondition",
+		"options": {"not_before": "2018-03-01T09:00:00+01:00"}
+	}
+}`), &cs))
+	require.IsType(t, &DateRangeCondition{}, cs["contract"])
+	assert.True(t, time.Date(2018, 3, 1, 8, 0, 0, 0, time.UTC).Equal(cs["contract"].(*DateRangeCondition).NotBefore))
+	assert.True(t, cs["contract"].(*DateRangeCondition).NotAfter.IsZero())
+
+	// Unknown locations are rejected when the condition is decoded, not when it is evaluated.
+	require.Error(t, json.Unmarshal([]byte(`{
+	"hours": {"type": "TimeWindowCondition", "options": {"location": "Nowhere/Special"}}
+}`), &Conditions{}))
+}
+
+func TestTimeConditionsUseWardenClock(t *testing.T) {
+	p := &DefaultPolicy{
+		ID:        "1",
+		Subjects:  []string{"peter"},
+		Actions:   []string{"view"},
+		Resources: []string{"articles:1"},
+		Effect:    AllowAccess,
+		Conditions: Conditions{
+			"hours":    &TimeWindowCondition{After: "09:00", Before: "17:00"},
+			"contract": &DateRangeCondition{NotAfter: time.Date(2018, 3, 31, 0, 0, 0, 0, time.UTC)},
+		},
+	}
+	r := &Request{Subject: "peter", Action: "view", Resource: "articles:1"}
+
+	for at, allowed := range map[time.Time]bool{
+		time.Date(2018, 3, 5, 12, 0, 0, 0, time.UTC): true,
+		time.Date(2018, 3, 5, 20, 0, 0, 0, time.UTC): false,
+		time.Date(2018, 4, 2, 12, 0, 0, 0, time.UTC): false,
+	} {
+		at := at
+		warden := &Ladon{Clock: func() time.Time { return at }}
+		assert.Equal(t, allowed, warden.DoPoliciesAllow(r, []Policy{p}) == nil, "%s", at)
+	}
+}
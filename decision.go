@@ -0,0 +1,109 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon
+
+// Decision explains how the warden decided on an access request.
+type Decision struct {
+	// Request is the access request that was evaluated.
+	Request *Request `json:"request"`
+
+	// Allowed is true if access was granted.
+	Allowed bool `json:"allowed"`
+
+	// Err is the error that IsAllowed returns for this request, or nil if access was granted.
+	Err error `json:"-"`
+
+	// Reason is a human readable explanation of Err.
+	Reason string `json:"reason,omitempty"`
+
+	// Deciders are the policies which led to the decision. This is the same list that is passed to the AuditLogger.
+	Deciders Policies `json:"-"`
+
+	// DecidingPolicy is the ID of the policy that finally decided the request. If access was denied, this is the
+	// last of Deciders (e.g. the denying policy), otherwise the first. It is empty if no policy decided the request.
+	DecidingPolicy string `json:"deciding_policy,omitempty"`
+
+	// Candidates contains the evaluation of every candidate policy, in the order they were evaluated.
+	Candidates []*PolicyEvaluation `json:"candidates"`
+}
+
+// PolicyEvaluation explains how a single policy was evaluated against an access request.
+type PolicyEvaluation struct {
+	// Policy is the evaluated policy.
+	Policy Policy `json:"policy"`
+
+	// Action explains if the request's action matched one of the policy's actions.
+	Action *FieldMatch `json:"action"`
+
+	// Subject explains if the request's subject matched one of the policy's subjects.
+	Subject *FieldMatch `json:"subject"`
+
+	// Resource explains if the request's resource matched one of the policy's resources.
+	Resource *FieldMatch `json:"resource"`
+
+	// Conditions explains the outcome of every condition of the policy, sorted by key.
+	Conditions []*ConditionEvaluation `json:"conditions"`
+
+	// Inactive is true if the policy was outside of its validity period, see ValidityPolicy.
+	Inactive bool `json:"inactive,omitempty"`
+
+	// Applicable is true if the policy was active, actions, subjects and resources matched and all conditions were
+	// fulfilled.
+	Applicable bool `json:"applicable"`
+}
+
+// FieldMatch explains if a request field matched a policy.
+type FieldMatch struct {
+	// Value is the request's value.
+	Value string `json:"value"`
+
+	// Matches is true if the value matched one of the policy's patterns.
+	Matches bool `json:"matches"`
+
+	// Pattern is the first pattern which matched the value.
+	Pattern string `json:"pattern,omitempty"`
+}
+
+// ConditionEvaluation explains the outcome of a single condition.
+type ConditionEvaluation struct {
+	// Key is the condition's key in the policy and the request's context.
+	Key string `json:"key"`
+
+	// Type is the condition's name.
+	Type string `json:"type"`
+
+	// Value is the value of the request's context for Key.
+	Value interface{} `json:"value"`
+
+	// Fulfilled is true if the condition was fulfilled.
+	Fulfilled bool `json:"fulfilled"`
+}
+
+// FailedConditions returns the conditions which were not fulfilled.
+func (e *PolicyEvaluation) FailedConditions() []*ConditionEvaluation {
+	var failed []*ConditionEvaluation
+	for _, c := range e.Conditions {
+		if !c.Fulfilled {
+			failed = append(failed, c)
+		}
+	}
+	return failed
+}
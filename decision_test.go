@@ -0,0 +1,105 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon_test
+
+import (
+	"fmt"
+	"testing"
+
+	. "github.com/ory/ladon"
+	. "github.com/ory/ladon/manager/memory"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExplainMatchesIsAllowed(t *testing.T) {
+	warden := &Ladon{Manager: NewMemoryManager()}
+	for _, pol := range pols {
+		require.Nil(t, warden.Manager.Create(pol))
+	}
+
+	for k, c := range cases {
+		t.Run(fmt.Sprintf("case=%d-%s", k, c.description), func(t *testing.T) {
+			err := warden.IsAllowed(c.accessRequest)
+
+			d, explainErr := warden.Explain(c.accessRequest)
+			require.NoError(t, explainErr)
+			assert.Equal(t, err == nil, d.Allowed)
+			assert.Equal(t, errors.Cause(err), errors.Cause(d.Err))
+
+			candidates, findErr := warden.Manager.FindRequestCandidates(c.accessRequest)
+			require.NoError(t, findErr)
+			assert.Len(t, d.Candidates, len(candidates))
+		})
+	}
+}
+
+func TestExplain(t *testing.T) {
+	warden := &Ladon{Manager: NewMemoryManager()}
+	for _, pol := range pols {
+		require.Nil(t, warden.Manager.Create(pol))
+	}
+
+	d, err := warden.Explain(&Request{
+		Subject:  "peter",
+		Action:   "delete",
+		Resource: "myrn:some.domain.com:resource:123",
+		Context: Context{
+			"owner":    "peter",
+			"clientIP": "0.0.0.0",
+		},
+	})
+	require.NoError(t, err)
+	assert.False(t, d.Allowed)
+	assert.Equal(t, ErrRequestDenied, errors.Cause(d.Err))
+	assert.Equal(t, ErrRequestDenied.Reason(), d.Reason)
+	assert.Empty(t, d.DecidingPolicy)
+
+	var e *PolicyEvaluation
+	for _, c := range d.Candidates {
+		if c.Policy.GetID() == "1" {
+			e = c
+		}
+	}
+	require.NotNil(t, e)
+	assert.False(t, e.Applicable)
+	assert.Equal(t, &FieldMatch{Value: "delete", Matches: true, Pattern: "<create|delete>"}, e.Action)
+	assert.Equal(t, &FieldMatch{Value: "peter", Matches: true, Pattern: "peter"}, e.Subject)
+	assert.Equal(t, &FieldMatch{Value: "myrn:some.domain.com:resource:123", Matches: true, Pattern: "myrn:some.domain.com:resource:123"}, e.Resource)
+	require.Len(t, e.Conditions, 2)
+	require.Len(t, e.FailedConditions(), 1)
+	assert.Equal(t, "clientIP", e.FailedConditions()[0].Key)
+	assert.Equal(t, "CIDRCondition", e.FailedConditions()[0].Type)
+	assert.Equal(t, "0.0.0.0", e.FailedConditions()[0].Value)
+
+	d, err = warden.Explain(&Request{Subject: "max", Action: "broadcast"})
+	require.NoError(t, err)
+	assert.False(t, d.Allowed)
+	assert.Equal(t, ErrRequestForcefullyDenied, errors.Cause(d.Err))
+	assert.Equal(t, "3", d.DecidingPolicy)
+
+	d, err = warden.Explain(&Request{Subject: "max", Action: "update"})
+	require.NoError(t, err)
+	assert.True(t, d.Allowed)
+	assert.Nil(t, d.Err)
+	assert.Equal(t, "2", d.DecidingPolicy)
+}
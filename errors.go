@@ -43,12 +43,63 @@ var (
 		reason: "The request was denied because a policy denied request.",
 	}
 
+	// ErrRequestAmbiguous is returned when more than one policy applies to an access request, but the combining
+	// algorithm requires exactly one.
+	ErrRequestAmbiguous = &errorWithContext{
+		error:  errors.New("Request is ambiguous"),
+		code:   http.StatusForbidden,
+		status: http.StatusText(http.StatusForbidden),
+		reason: "The request was denied because more than one policy applied to it.",
+	}
+
+	// ErrInvalidRequest is returned when an access request can not be evaluated as it was made, for example because it
+	// selects a combining algorithm which is unknown or may not be selected.
+	ErrInvalidRequest = &errorWithContext{
+		error:  errors.New("Request is invalid"),
+		code:   http.StatusBadRequest,
+		status: http.StatusText(http.StatusBadRequest),
+		reason: "The request could not be evaluated because it is invalid.",
+	}
+
 	// ErrNotFound is returned when a resource can not be found.
 	ErrNotFound = &errorWithContext{
 		error:  errors.New("Resource could not be found"),
 		code:   http.StatusNotFound,
 		status: http.StatusText(http.StatusNotFound),
 	}
+
+	// ErrConflict is returned when a policy can not be updated because it was modified in the meantime.
+	ErrConflict = &errorWithContext{
+		error:  errors.New("Resource was modified in the meantime"),
+		code:   http.StatusConflict,
+		status: http.StatusText(http.StatusConflict),
+		reason: "The policy was not updated because its version does not match the expected version.",
+	}
+
+	// ErrReadOnly is returned when policies are written to a manager which serves them read-only.
+	ErrReadOnly = &errorWithContext{
+		error:  errors.New("Policies are read-only"),
+		code:   http.StatusForbidden,
+		status: http.StatusText(http.StatusForbidden),
+		reason: "The policies can not be changed because the manager serves them read-only.",
+	}
+
+	// ErrBundleUnsigned is returned when a policy bundle is required to be signed, but has no signature.
+	ErrBundleUnsigned = &errorWithContext{
+		error:  errors.New("Bundle is not signed"),
+		code:   http.StatusBadRequest,
+		status: http.StatusText(http.StatusBadRequest),
+		reason: "The bundle was rejected because it is not signed.",
+	}
+
+	// ErrBundleSignatureInvalid is returned when the signature of a policy bundle does not match its content, or was
+	// not made by a trusted key.
+	ErrBundleSignatureInvalid = &errorWithContext{
+		error:  errors.New("Bundle signature is invalid"),
+		code:   http.StatusBadRequest,
+		status: http.StatusText(http.StatusBadRequest),
+		reason: "The bundle was rejected because it is not signed by a trusted key or was modified after signing.",
+	}
 )
 
 func NewErrResourceNotFound(err error) error {
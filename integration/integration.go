@@ -41,6 +41,16 @@ func KillAll() {
 	resources = []*dockertest.Resource{}
 }
 
+// DockerAvailable returns an error if the docker daemon, which runs the MySQL and PostgreSQL databases, can not be
+// reached.
+func DockerAvailable() error {
+	p, err := dockertest.NewPool("")
+	if err != nil {
+		return err
+	}
+	return p.Client.Ping()
+}
+
 func ConnectToMySQL() *sqlx.DB {
 	var db *sqlx.DB
 	var err error
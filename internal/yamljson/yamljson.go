@@ -0,0 +1,71 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+// Package yamljson converts YAML documents to JSON, so that they can be decoded by types which implement
+// json.Unmarshaler, such as ladon.Conditions, and back.
+package yamljson
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// ToJSON converts a YAML document to JSON.
+func ToJSON(data []byte) ([]byte, error) {
+	var v interface{}
+	if err := yaml.Unmarshal(data, &v); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	out, err := json.Marshal(convert(v))
+	return out, errors.WithStack(err)
+}
+
+// FromJSON converts a JSON document to YAML.
+func FromJSON(data []byte) ([]byte, error) {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	out, err := yaml.Marshal(v)
+	return out, errors.WithStack(err)
+}
+
+// convert replaces the map[interface{}]interface{} values the YAML decoder produces with map[string]interface{}.
+func convert(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for k, v := range t {
+			m[fmt.Sprintf("%v", k)] = convert(v)
+		}
+		return m
+	case []interface{}:
+		for i, v := range t {
+			t[i] = convert(v)
+		}
+		return t
+	}
+	return v
+}
@@ -0,0 +1,67 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package yamljson
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestToJSON(t *testing.T) {
+	out, err := ToJSON([]byte(`
+id: 1
+subjects: [peter, "<zac|ken>"]
+conditions:
+  ip:
+    type: CIDRCondition
+    options:
+      cidr: 127.0.0.1/32
+  nested:
+    - 1: true
+`))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"id": 1,
+		"subjects": ["peter", "<zac|ken>"],
+		"conditions": {
+			"ip": {"type": "CIDRCondition", "options": {"cidr": "127.0.0.1/32"}},
+			"nested": [{"1": true}]
+		}
+	}`, string(out))
+
+	_, err = ToJSON([]byte("id: [1"))
+	assert.Error(t, err)
+}
+
+func TestFromJSON(t *testing.T) {
+	in := `{"id": 1, "subjects": ["peter", "<zac|ken>"], "conditions": {"ip": {"type": "CIDRCondition"}}}`
+	out, err := FromJSON([]byte(in))
+	require.NoError(t, err)
+
+	back, err := ToJSON(out)
+	require.NoError(t, err)
+	assert.JSONEq(t, in, string(back))
+
+	_, err = FromJSON([]byte("{"))
+	assert.Error(t, err)
+}
@@ -21,23 +21,68 @@
 package ladon
 
 import (
+	"context"
+	"sort"
+	"time"
+
 	"github.com/pkg/errors"
 )
 
 // Ladon is an implementation of Warden.
 type Ladon struct {
 	Manager     Manager
-	Matcher     matcher
+	Matcher     Matcher
 	AuditLogger AuditLogger
+
+	// CombiningAlgorithm decides how the effects of multiple applicable policies are combined, unless the request
+	// asks for a specific algorithm. Defaults to DefaultCombiningAlgorithm.
+	CombiningAlgorithm CombiningAlgorithm
+
+	// RequestCombiningAlgorithms lists the names of the combining algorithms a request may select using
+	// Request.CombiningAlgorithm. By default requests can not select an algorithm, because a caller could otherwise
+	// turn an explicit deny into an allow, e.g. by selecting permit-overrides.
+	RequestCombiningAlgorithms []string
+
+	// Clock returns the current time, which decides whether a policy is within its validity period (see
+	// ValidityPolicy) and is used by time based conditions such as TimeWindowCondition. Defaults to time.Now.
+	Clock func() time.Time
 }
 
-func (l *Ladon) matcher() matcher {
+func (l *Ladon) matcher() Matcher {
 	if l.Matcher == nil {
 		l.Matcher = DefaultMatcher
 	}
 	return l.Matcher
 }
 
+func (l *Ladon) combiningAlgorithm(r *Request) (CombiningAlgorithm, error) {
+	if r.CombiningAlgorithm != "" {
+		a, ok := CombiningAlgorithms[r.CombiningAlgorithm]
+		if !ok {
+			return nil, errors.Wrapf(ErrInvalidRequest, "Combining algorithm %s is not supported", r.CombiningAlgorithm)
+		}
+
+		for _, name := range l.RequestCombiningAlgorithms {
+			if name == r.CombiningAlgorithm {
+				return a, nil
+			}
+		}
+		return nil, errors.Wrapf(ErrInvalidRequest, "Combining algorithm %s may not be selected by the request", r.CombiningAlgorithm)
+	}
+
+	if l.CombiningAlgorithm == nil {
+		return DefaultCombiningAlgorithm, nil
+	}
+	return l.CombiningAlgorithm, nil
+}
+
+func (l *Ladon) now() time.Time {
+	if l.Clock == nil {
+		return time.Now()
+	}
+	return l.Clock()
+}
+
 func (l *Ladon) auditLogger() AuditLogger {
 	if l.AuditLogger == nil {
 		l.AuditLogger = DefaultAuditLogger
@@ -47,7 +92,13 @@ func (l *Ladon) auditLogger() AuditLogger {
 
 // IsAllowed returns nil if subject s has permission p on resource r with context c or an error otherwise.
 func (l *Ladon) IsAllowed(r *Request) (err error) {
-	policies, err := l.Manager.FindRequestCandidates(r)
+	return l.IsAllowedContext(context.Background(), r)
+}
+
+// IsAllowedContext is like IsAllowed, but passes ctx to the manager and to conditions implementing
+// ContextCondition. It aborts with ctx's error as soon as ctx is done.
+func (l *Ladon) IsAllowedContext(ctx context.Context, r *Request) (err error) {
+	policies, err := NewContextManager(l.Manager).FindRequestCandidatesContext(WithEvaluationTime(ctx, l.now()), r)
 	if err != nil {
 		return err
 	}
@@ -55,77 +106,258 @@ func (l *Ladon) IsAllowed(r *Request) (err error) {
 	// Although the manager is responsible of matching the policies, it might decide to just scan for
 	// subjects, it might return all policies, or it might have a different pattern matching than Golang.
 	// Thus, we need to make sure that we actually matched the right policies.
-	return l.DoPoliciesAllow(r, policies)
+	return l.DoPoliciesAllowContext(ctx, r, policies)
 }
 
 // DoPoliciesAllow returns nil if subject s has permission p on resource r with context c for a given policy list or an error otherwise.
 // The IsAllowed interface should be preferred since it uses the manager directly. This is a lower level interface for when you don't want to use the ladon manager.
 func (l *Ladon) DoPoliciesAllow(r *Request, policies []Policy) (err error) {
-	var allowed = false
-	var deciders = Policies{}
+	return l.DoPoliciesAllowContext(context.Background(), r, policies)
+}
+
+// DoPoliciesAllowContext is like DoPoliciesAllow, but passes ctx to conditions implementing ContextCondition.
+func (l *Ladon) DoPoliciesAllowContext(ctx context.Context, r *Request, policies []Policy) (err error) {
+	start := time.Now()
+	d, err := l.evaluate(ctx, r, policies, false)
+	if err != nil {
+		return err
+	}
+
+	if dl, ok := l.auditLogger().(DecisionAuditLogger); ok {
+		dl.LogDecision(d, policies, time.Since(start))
+		return d.Err
+	}
+
+	if !d.Allowed {
+		l.auditLogger().LogRejectedAccessRequest(r, policies, d.Deciders)
+		return d.Err
+	}
+
+	l.auditLogger().LogGrantedAccessRequest(r, policies, d.Deciders)
+	return nil
+}
+
+// Explain evaluates the request exactly like IsAllowed does, but returns a Decision which describes how every
+// candidate policy was evaluated instead of just an error. The returned error is only set if the candidates could
+// not be fetched or matched, a denied request is reported through Decision.Err.
+func (l *Ladon) Explain(r *Request) (*Decision, error) {
+	return l.ExplainContext(context.Background(), r)
+}
+
+// ExplainContext is like Explain, but passes ctx on like IsAllowedContext does.
+func (l *Ladon) ExplainContext(ctx context.Context, r *Request) (*Decision, error) {
+	policies, err := NewContextManager(l.Manager).FindRequestCandidatesContext(WithEvaluationTime(ctx, l.now()), r)
+	if err != nil {
+		return nil, err
+	}
+
+	return l.evaluate(ctx, r, policies, true)
+}
+
+// ExplainPolicies is the lower level counterpart of Explain, like DoPoliciesAllow is for IsAllowed.
+func (l *Ladon) ExplainPolicies(r *Request, policies []Policy) (*Decision, error) {
+	return l.evaluate(context.Background(), r, policies, true)
+}
+
+// evaluate is shared by DoPoliciesAllow and ExplainPolicies so that an explanation can never differ from the actual
+// decision. If explain is false, policies are not explained.
+func (l *Ladon) evaluate(ctx context.Context, r *Request, policies []Policy, explain bool) (*Decision, error) {
+	var d = &Decision{Request: r}
+	var applicable = Policies{}
+
+	algorithm, err := l.combiningAlgorithm(r)
+	if err != nil {
+		return nil, err
+	}
+
+	subjects, err := l.subjects(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Conditions depending on the time, e.g. TimeWindowCondition, are checked against the same time as the validity
+	// periods of the policies.
+	now := l.now()
+	ctx = WithEvaluationTime(ctx, now)
 
 	// Iterate through all policies
 	for _, p := range policies {
-		// Does the action match with one of the policies?
-		// This is the first check because usually actions are a superset of get|update|delete|set
-		// and thus match faster.
-		if pm, err := l.matcher().Matches(p, p.GetActions(), r.Action); err != nil {
-			return errors.WithStack(err)
-		} else if !pm {
-			// no, continue to next policy
-			continue
+		if err := ctx.Err(); err != nil {
+			return nil, errors.WithStack(err)
 		}
 
-		// Does the subject match with one of the policies?
-		// There are usually less subjects than resources which is why this is checked
-		// before checking for resources.
-		if sm, err := l.matcher().Matches(p, p.GetSubjects(), r.Subject); err != nil {
-			return err
-		} else if !sm {
-			// no, continue to next policy
-			continue
+		var e *PolicyEvaluation
+		if explain {
+			e = &PolicyEvaluation{Policy: p}
+			d.Candidates = append(d.Candidates, e)
 		}
 
-		// Does the resource match with one of the policies?
-		if rm, err := l.matcher().Matches(p, p.GetResources(), r.Resource); err != nil {
-			return errors.WithStack(err)
-		} else if !rm {
-			// no, continue to next policy
-			continue
+		if applies, err := l.policyApplies(ctx, p, r, subjects, now, e); err != nil {
+			return nil, err
+		} else if applies {
+			applicable = append(applicable, p)
 		}
+	}
 
-		// Are the policies conditions met?
-		// This is checked first because it usually has a small complexity.
-		if !l.passesConditions(p, r) {
-			// no, continue to next policy
-			continue
+	d.Deciders, d.Err = algorithm.Combine(r, applicable)
+	d.Allowed = d.Err == nil
+	if len(d.Deciders) > 0 {
+		if d.Allowed {
+			d.DecidingPolicy = d.Deciders[0].GetID()
+		} else {
+			d.DecidingPolicy = d.Deciders[len(d.Deciders)-1].GetID()
 		}
+	}
 
-		// Is the policies effect deny? If yes, this overrides all allow policies -> access denied.
-		if !p.AllowAccess() {
-			deciders = append(deciders, p)
-			l.auditLogger().LogRejectedAccessRequest(r, policies, deciders)
-			return errors.WithStack(ErrRequestForcefullyDenied)
+	if e, ok := errors.Cause(d.Err).(*errorWithContext); ok {
+		d.Reason = e.Reason()
+	}
+
+	return d, nil
+}
+
+// subjects returns the request's subject followed by the names it was expanded to if the manager implements
+// SubjectExpander.
+func (l *Ladon) subjects(r *Request) ([]string, error) {
+	var subjects = []string{r.Subject}
+	if se, ok := l.Manager.(SubjectExpander); ok {
+		expanded, err := se.ExpandSubject(r)
+		if err != nil {
+			return nil, errors.WithStack(err)
 		}
+		subjects = append(subjects, expanded...)
+	}
+	return subjects, nil
+}
 
-		allowed = true
-		deciders = append(deciders, p)
+// policyApplies returns true if the policy is active at the given time, its actions, subjects and resources match the
+// request and all of its conditions are fulfilled. If e is not nil, every check is executed and its outcome is
+// recorded in e.
+func (l *Ladon) policyApplies(ctx context.Context, p Policy, r *Request, subjects []string, now time.Time, e *PolicyEvaluation) (bool, error) {
+	var applies = true
+	var action, subject, resource *FieldMatch
+	if e != nil {
+		e.Action = &FieldMatch{Value: r.Action}
+		e.Subject = &FieldMatch{Value: r.Subject}
+		e.Resource = &FieldMatch{Value: r.Resource}
+		action, subject, resource = e.Action, e.Subject, e.Resource
 	}
 
-	if !allowed {
-		l.auditLogger().LogRejectedAccessRequest(r, policies, deciders)
-		return errors.WithStack(ErrRequestDenied)
+	// Is the policy within its validity period?
+	if !IsPolicyActive(p, now) {
+		if e == nil {
+			return false, nil
+		}
+		e.Inactive = true
+		applies = false
 	}
 
-	l.auditLogger().LogGrantedAccessRequest(r, policies, deciders)
-	return nil
+	// Does the action match with one of the policies?
+	// This is the first check because usually actions are a superset of get|update|delete|set
+	// and thus match faster.
+	if am, err := l.matches(p, p.GetActions(), r.Action, action); err != nil {
+		return false, err
+	} else if !am {
+		if e == nil {
+			return false, nil
+		}
+		applies = false
+	}
+
+	// Does the subject, or one of the names it expands to, match with one of the policies?
+	// There are usually less subjects than resources which is why this is checked
+	// before checking for resources.
+	var sm bool
+	for _, s := range subjects {
+		var err error
+		if sm, err = l.matches(p, p.GetSubjects(), s, subject); err != nil {
+			return false, err
+		} else if sm {
+			break
+		}
+	}
+	if !sm {
+		if e == nil {
+			return false, nil
+		}
+		applies = false
+	}
+
+	// Does the resource match with one of the policies?
+	if rm, err := l.matches(p, p.GetResources(), r.Resource, resource); err != nil {
+		return false, err
+	} else if !rm {
+		if e == nil {
+			return false, nil
+		}
+		applies = false
+	}
+
+	// Are the policies conditions met?
+	if !l.passesConditions(ctx, p, r, e) {
+		applies = false
+	}
+
+	if e != nil {
+		e.Applicable = applies
+	}
+	return applies, nil
 }
 
-func (l *Ladon) passesConditions(p Policy, r *Request) bool {
-	for key, condition := range p.GetConditions() {
-		if pass := condition.Fulfills(r.Context[key], r); !pass {
-			return false
+// matches asks the matcher if the needle matches the haystack. If m is not nil and the needle matched, the
+// matcher is asked again for every single pattern in order to find out which one matched.
+func (l *Ladon) matches(p Policy, haystack []string, needle string, m *FieldMatch) (bool, error) {
+	matches, err := l.matcher().Matches(p, haystack, needle)
+	if err != nil {
+		return false, errors.WithStack(err)
+	} else if m == nil {
+		return matches, nil
+	}
+
+	m.Matches = matches
+	if !matches {
+		return false, nil
+	}
+
+	for _, h := range haystack {
+		if hm, err := l.matcher().Matches(p, []string{h}, needle); err != nil {
+			return false, errors.WithStack(err)
+		} else if hm {
+			m.Pattern = h
+			break
+		}
+	}
+	return true, nil
+}
+
+func (l *Ladon) passesConditions(ctx context.Context, p Policy, r *Request, e *PolicyEvaluation) bool {
+	if e == nil {
+		for key, condition := range p.GetConditions() {
+			if pass := fulfills(ctx, key, condition, r); !pass {
+				return false
+			}
+		}
+		return true
+	}
+
+	var passes = true
+	var conditions = p.GetConditions()
+	var keys = make([]string, 0, len(conditions))
+	for key := range conditions {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	e.Conditions = make([]*ConditionEvaluation, len(keys))
+	for i, key := range keys {
+		pass := fulfills(ctx, key, conditions[key], r)
+		e.Conditions[i] = &ConditionEvaluation{
+			Key:       key,
+			Type:      conditions[key].GetName(),
+			Value:     r.Context[key],
+			Fulfilled: pass,
 		}
+		passes = passes && pass
 	}
-	return true
+	return passes
 }
@@ -21,11 +21,14 @@
 package ladon_test
 
 import (
+	"context"
 	"fmt"
 	"testing"
+	"time"
 
 	. "github.com/ory/ladon"
 	. "github.com/ory/ladon/manager/memory"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -172,3 +175,108 @@ func TestLadonEmpty(t *testing.T) {
 	warden := &Ladon{Manager: NewMemoryManager()}
 	assert.NotNil(t, warden.IsAllowed(&Request{}))
 }
+
+type tenantKey struct{}
+
+// tenantCondition is fulfilled if the request's context value equals the tenant stored in the context.Context.
+type tenantCondition struct{}
+
+func (c *tenantCondition) GetName() string { return "tenantCondition" }
+
+func (c *tenantCondition) Fulfills(value interface{}, _ *Request) bool { return false }
+
+func (c *tenantCondition) FulfillsContext(ctx context.Context, value interface{}, _ *Request) bool {
+	tenant, ok := ctx.Value(tenantKey{}).(string)
+	return ok && tenant == value
+}
+
+func TestLadonContext(t *testing.T) {
+	warden := &Ladon{Manager: NewMemoryManager()}
+	require.Nil(t, warden.Manager.Create(&DefaultPolicy{
+		ID:         "tenant",
+		Subjects:   []string{"max"},
+		Actions:    []string{"get"},
+		Resources:  []string{"article"},
+		Effect:     AllowAccess,
+		Conditions: Conditions{"tenant": &tenantCondition{}},
+	}))
+
+	var _ ContextWarden = warden
+	r := &Request{Subject: "max", Action: "get", Resource: "article", Context: Context{"tenant": "acme"}}
+
+	t.Run("case=condition receives context", func(t *testing.T) {
+		ctx := context.WithValue(context.Background(), tenantKey{}, "acme")
+		assert.Nil(t, warden.IsAllowedContext(ctx, r))
+		assert.NotNil(t, warden.IsAllowedContext(context.WithValue(context.Background(), tenantKey{}, "other"), r))
+		assert.NotNil(t, warden.IsAllowed(r))
+	})
+
+	t.Run("case=canceled context aborts", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.WithValue(context.Background(), tenantKey{}, "acme"))
+		cancel()
+
+		err := warden.IsAllowedContext(ctx, r)
+		assert.Equal(t, context.Canceled, errors.Cause(err))
+
+		_, err = warden.ExplainContext(ctx, r)
+		assert.Equal(t, context.Canceled, errors.Cause(err))
+	})
+
+	t.Run("case=adapters", func(t *testing.T) {
+		c := NewContextCondition(&StringEqualCondition{Equals: "foo"})
+		assert.True(t, c.FulfillsContext(context.Background(), "foo", r))
+		assert.Equal(t, ContextCondition(&tenantCondition{}), NewContextCondition(&tenantCondition{}))
+
+		out, err := c.(interface{ MarshalJSON() ([]byte, error) }).MarshalJSON()
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"equals":"foo"}`, string(out))
+
+		m := NewContextManager(warden.Manager)
+		policies, err := m.FindRequestCandidatesContext(context.Background(), r)
+		require.NoError(t, err)
+		assert.Len(t, policies, 1)
+	})
+}
+
+func TestLadonValidityPeriod(t *testing.T) {
+	notBefore := time.Date(2018, 3, 1, 0, 0, 0, 0, time.UTC)
+	notAfter := time.Date(2018, 3, 31, 0, 0, 0, 0, time.UTC)
+
+	var now time.Time
+	warden := &Ladon{
+		Manager: NewMemoryManager(),
+		Clock:   func() time.Time { return now },
+	}
+	require.Nil(t, warden.Manager.Create(&DefaultPolicy{
+		ID:        "temporary",
+		Subjects:  []string{"contractor"},
+		Actions:   []string{"get"},
+		Resources: []string{"<.*>"},
+		Effect:    AllowAccess,
+		NotBefore: &notBefore,
+		NotAfter:  &notAfter,
+	}))
+
+	r := &Request{Subject: "contractor", Action: "get", Resource: "article"}
+	policies, err := warden.Manager.GetAll(10, 0)
+	require.NoError(t, err)
+
+	for k, c := range []struct {
+		now   time.Time
+		allow bool
+	}{
+		{now: notBefore.Add(-time.Second), allow: false},
+		{now: notBefore, allow: true},
+		{now: notAfter, allow: true},
+		{now: notAfter.Add(time.Second), allow: false},
+	} {
+		now = c.now
+		assert.Equal(t, c.allow, warden.DoPoliciesAllow(r, policies) == nil, "%d", k)
+
+		d, err := warden.ExplainPolicies(r, policies)
+		require.NoError(t, err)
+		require.Len(t, d.Candidates, 1)
+		assert.Equal(t, !c.allow, d.Candidates[0].Inactive, "%d", k)
+		assert.True(t, d.Candidates[0].Subject.Matches, "%d", k)
+	}
+}
@@ -20,6 +20,13 @@
 
 package ladon
 
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
 // Manager is responsible for managing and persisting policies.
 type Manager interface {
 
@@ -43,3 +50,114 @@ type Manager interface {
 	// the error.
 	FindRequestCandidates(r *Request) (Policies, error)
 }
+
+// VersionedManager is an optional interface a Manager can implement to support optimistic concurrency control. The
+// manager stores a version with every policy, which is 1 after the policy was created and increased by every update.
+// Policies implementing VersionedPolicy, such as DefaultPolicy, carry their version when they are retrieved.
+type VersionedManager interface {
+	Manager
+
+	// UpdateIfMatch updates an existing policy, but only if its stored version equals version. Otherwise ErrConflict
+	// is returned, or an error with status code 404 if the policy does not exist.
+	UpdateIfMatch(policy Policy, version int64) error
+}
+
+// BatchManager is an optional interface a Manager can implement to write several policies at once, all or nothing.
+type BatchManager interface {
+	Manager
+
+	// CreateOrUpdate creates the policies which do not exist yet and updates the others. If an error occurs, none of
+	// the policies are written.
+	CreateOrUpdate(policies Policies) error
+}
+
+// PolicyEventType is the kind of change a PolicyEvent reports.
+type PolicyEventType string
+
+const (
+	// PolicyCreated is reported when a policy was created.
+	PolicyCreated PolicyEventType = "created"
+
+	// PolicyUpdated is reported when a policy was updated.
+	PolicyUpdated PolicyEventType = "updated"
+
+	// PolicyDeleted is reported when a policy was deleted.
+	PolicyDeleted PolicyEventType = "deleted"
+)
+
+// PolicyEvent reports a change of a policy.
+type PolicyEvent struct {
+	// Type is the kind of change.
+	Type PolicyEventType `json:"type"`
+
+	// ID is the ID of the policy which was changed.
+	ID string `json:"id"`
+
+	// Policy is the policy after the change. It is nil if the policy was deleted, or if the manager can not tell
+	// anymore because the policy was deleted in the meantime.
+	Policy Policy `json:"policy,omitempty"`
+}
+
+// Watcher is an optional interface a Manager can implement to report changes of its policies, so that caches and
+// indexes built from the policies can be kept up to date.
+type Watcher interface {
+	// Watch returns a channel which receives an event for every change made after Watch returned, in the order the
+	// changes were made. The channel is closed once ctx is done. Events are not dropped: Consume them quickly, as a
+	// slow consumer delays or queues up the events of the watch. An error is returned if the watch can not be
+	// started.
+	Watch(ctx context.Context) (<-chan PolicyEvent, error)
+}
+
+// SubjectExpander is an optional interface a Manager can implement if a subject is known under additional names,
+// for example the roles it is a member of. Ladon considers a policy's subjects to be matched if either the request's
+// subject or one of the expanded names matches.
+type SubjectExpander interface {
+	// ExpandSubject returns the additional names of the request's subject.
+	ExpandSubject(r *Request) ([]string, error)
+}
+
+// ContextManager is an optional interface a Manager can implement to support cancellation, deadlines and request
+// scoped values such as trace spans when looking up candidates.
+type ContextManager interface {
+	Manager
+
+	// FindRequestCandidatesContext is like FindRequestCandidates, but aborts as soon as ctx is done.
+	FindRequestCandidatesContext(ctx context.Context, r *Request) (Policies, error)
+}
+
+// NewContextManager returns m if it implements ContextManager. Otherwise m is wrapped in an adapter which checks
+// whether ctx is done before calling FindRequestCandidates.
+func NewContextManager(m Manager) ContextManager {
+	if cm, ok := m.(ContextManager); ok {
+		return cm
+	}
+	return &contextManager{Manager: m}
+}
+
+type contextManager struct {
+	Manager
+}
+
+func (m *contextManager) FindRequestCandidatesContext(ctx context.Context, r *Request) (Policies, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return m.FindRequestCandidates(r)
+}
+
+type evaluationTimeKey struct{}
+
+// WithEvaluationTime returns a copy of ctx which carries the time a request is evaluated at. The warden passes the
+// time of its Clock to the manager and to the conditions this way, so that managers which exclude policies outside of
+// their validity period (see ValidityPolicy) and time based conditions such as TimeWindowCondition agree with it.
+func WithEvaluationTime(ctx context.Context, t time.Time) context.Context {
+	return context.WithValue(ctx, evaluationTimeKey{}, t)
+}
+
+// EvaluationTime returns the time set by WithEvaluationTime or the current time if ctx does not carry one.
+func EvaluationTime(ctx context.Context) time.Time {
+	if t, ok := ctx.Value(evaluationTimeKey{}).(time.Time); ok {
+		return t
+	}
+	return time.Now()
+}
@@ -0,0 +1,308 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+// Package cache provides a Manager decorator which caches policies and request candidates.
+package cache
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/golang-lru"
+	. "github.com/ory/ladon"
+	"github.com/pkg/errors"
+)
+
+// SubjectKey caches candidates by the request's subject only. This is only correct for managers whose candidates do
+// not depend on the request's action and resource, but yields more cache hits.
+func SubjectKey(r *Request) string {
+	return r.Subject
+}
+
+// RequestKey caches candidates by the request's subject, action and resource. This is correct for managers whose
+// candidates only depend on these values, such as the memory and SQL managers. If the decorated manager implements
+// SubjectExpander, such as RbacManager, whose candidates depend on role assignments and the request's context as
+// well, CacheManager appends the expanded subjects to the key.
+func RequestKey(r *Request) string {
+	return strings.Join([]string{r.Subject, r.Action, r.Resource}, "\x00")
+}
+
+type entry struct {
+	value   interface{}
+	subject string
+	expires time.Time
+}
+
+// CacheManager decorates a Manager and caches the results of Get and FindRequestCandidates for a limited amount of
+// time. Errors are not cached.
+//
+// Create, Update and Delete invalidate the cached policy and all cached candidates the policy might be part of.
+// Changes made to the decorated manager directly, for example by other processes sharing the same database, are not
+// noticed. Either accept that they become visible once the cached entries expire, or call Invalidate or
+// InvalidatePolicy when you learn about them.
+//
+// Cached candidates might contain policies which expired in the meantime, which the warden skips, and lack policies
+// which became valid in the meantime if the decorated manager leaves out inactive policies (see ladon.ValidityPolicy).
+type CacheManager struct {
+	Manager Manager
+
+	// TTL is the time entries are cached for.
+	TTL time.Duration
+
+	// Key returns the key candidates are cached by. It must contain everything the decorated manager's candidates
+	// depend on. Defaults to RequestKey, followed by the expanded subjects if the decorated manager implements
+	// SubjectExpander.
+	Key func(r *Request) string
+
+	// Clock returns the current time. Defaults to time.Now.
+	Clock func() time.Time
+
+	policies   *lru.Cache
+	candidates *lru.Cache
+
+	// generation is increased by every invalidation. Results fetched while an invalidation happened are not cached,
+	// as they might be outdated already.
+	generation uint64
+	sync.Mutex
+}
+
+// NewCacheManager returns a CacheManager caching up to size policies and size candidate sets for ttl each.
+func NewCacheManager(m Manager, size int, ttl time.Duration) *CacheManager {
+	if size <= 0 {
+		size = 1024
+	}
+
+	// golang-lru only returns an error if the cache's size is 0. This, we can safely ignore this error.
+	policies, _ := lru.New(size)
+	candidates, _ := lru.New(size)
+	return &CacheManager{
+		Manager:    m,
+		TTL:        ttl,
+		policies:   policies,
+		candidates: candidates,
+	}
+}
+
+func (m *CacheManager) now() time.Time {
+	if m.Clock == nil {
+		return time.Now()
+	}
+	return m.Clock()
+}
+
+func (m *CacheManager) key(r *Request) (string, error) {
+	if m.Key != nil {
+		return m.Key(r), nil
+	}
+
+	// The subject is expanded on every lookup, so that changed role assignments result in a different key.
+	se, ok := m.Manager.(SubjectExpander)
+	if !ok {
+		return RequestKey(r), nil
+	}
+
+	expanded, err := se.ExpandSubject(r)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	return strings.Join(append([]string{RequestKey(r)}, expanded...), "\x00"), nil
+}
+
+func (m *CacheManager) currentGeneration() uint64 {
+	m.Lock()
+	defer m.Unlock()
+	return m.generation
+}
+
+func (m *CacheManager) get(c *lru.Cache, key string) (interface{}, bool) {
+	v, ok := c.Get(key)
+	if !ok {
+		return nil, false
+	}
+
+	e := v.(*entry)
+	if !m.now().Before(e.expires) {
+		c.Remove(key)
+		return nil, false
+	}
+	return e.value, true
+}
+
+// add caches the value unless an invalidation happened since generation was read.
+func (m *CacheManager) add(c *lru.Cache, key, subject string, value interface{}, generation uint64) {
+	m.Lock()
+	defer m.Unlock()
+	if m.generation != generation {
+		return
+	}
+	c.Add(key, &entry{value: value, subject: subject, expires: m.now().Add(m.TTL)})
+}
+
+// Invalidate removes all cached entries.
+func (m *CacheManager) Invalidate() {
+	m.Lock()
+	defer m.Unlock()
+	m.generation++
+	m.policies.Purge()
+	m.candidates.Purge()
+}
+
+// InvalidatePolicy removes the cached policy and all cached candidates the policy might be part of. Call it with the
+// old and the new version of a policy which was changed without going through the CacheManager.
+func (m *CacheManager) InvalidatePolicy(policy Policy) {
+	m.Lock()
+	defer m.Unlock()
+	m.generation++
+	m.policies.Remove(policy.GetID())
+
+	// Subjects might be expanded to the policy's subjects, and a template might match any subject.
+	if _, ok := m.Manager.(SubjectExpander); ok {
+		m.candidates.Purge()
+		return
+	}
+
+	subjects := map[string]bool{}
+	for _, s := range policy.GetSubjects() {
+		if IsTemplated(s, policy.GetStartDelimiter()) {
+			m.candidates.Purge()
+			return
+		}
+		subjects[s] = true
+	}
+
+	for _, key := range m.candidates.Keys() {
+		if v, ok := m.candidates.Peek(key); ok && subjects[v.(*entry).subject] {
+			m.candidates.Remove(key)
+		}
+	}
+}
+
+// stored returns the policy currently stored under id, or nil if it can not be retrieved.
+func (m *CacheManager) stored(id string) Policy {
+	p, err := m.Manager.Get(id)
+	if err != nil {
+		return nil
+	}
+	return p
+}
+
+// invalidate invalidates the cache after policy was written. previous is the policy stored before, if any. If the
+// previous policy is unknown, everything is invalidated.
+func (m *CacheManager) invalidate(previous, policy Policy) {
+	if previous == nil {
+		m.Invalidate()
+		return
+	}
+
+	m.InvalidatePolicy(previous)
+	if policy != nil {
+		m.InvalidatePolicy(policy)
+	}
+}
+
+// Create persists the policy.
+func (m *CacheManager) Create(policy Policy) error {
+	defer m.InvalidatePolicy(policy)
+	return m.Manager.Create(policy)
+}
+
+// Update updates an existing policy.
+func (m *CacheManager) Update(policy Policy) error {
+	defer m.invalidate(m.stored(policy.GetID()), policy)
+	return m.Manager.Update(policy)
+}
+
+// UpdateIfMatch updates an existing policy if its stored version equals version. The decorated manager must implement
+// VersionedManager. The version is compared by the decorated manager, so conflicts are detected even if the cached
+// policy is outdated.
+func (m *CacheManager) UpdateIfMatch(policy Policy, version int64) error {
+	vm, ok := m.Manager.(VersionedManager)
+	if !ok {
+		return errors.Errorf("Manager %T does not support versions", m.Manager)
+	}
+
+	defer m.invalidate(m.stored(policy.GetID()), policy)
+	return vm.UpdateIfMatch(policy, version)
+}
+
+// Delete removes a policy.
+func (m *CacheManager) Delete(id string) error {
+	defer m.invalidate(m.stored(id), nil)
+	return m.Manager.Delete(id)
+}
+
+// Get retrieves a policy.
+func (m *CacheManager) Get(id string) (Policy, error) {
+	if v, ok := m.get(m.policies, id); ok {
+		return v.(Policy), nil
+	}
+
+	generation := m.currentGeneration()
+	p, err := m.Manager.Get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	m.add(m.policies, id, "", p, generation)
+	return p, nil
+}
+
+// GetAll retrieves all policies. The result is not cached.
+func (m *CacheManager) GetAll(limit, offset int64) (Policies, error) {
+	return m.Manager.GetAll(limit, offset)
+}
+
+// ExpandSubject returns the additional names of the request's subject if the decorated manager implements
+// SubjectExpander. The result is not cached.
+func (m *CacheManager) ExpandSubject(r *Request) ([]string, error) {
+	if se, ok := m.Manager.(SubjectExpander); ok {
+		return se.ExpandSubject(r)
+	}
+	return nil, nil
+}
+
+// FindRequestCandidates returns candidates that could match the request object.
+func (m *CacheManager) FindRequestCandidates(r *Request) (Policies, error) {
+	return m.FindRequestCandidatesContext(context.Background(), r)
+}
+
+// FindRequestCandidatesContext returns candidates that could match the request object. If they are not cached,
+// ctx is passed to the decorated manager.
+func (m *CacheManager) FindRequestCandidatesContext(ctx context.Context, r *Request) (Policies, error) {
+	key, err := m.key(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if v, ok := m.get(m.candidates, key); ok {
+		return append(Policies{}, v.(Policies)...), nil
+	}
+
+	generation := m.currentGeneration()
+	ps, err := NewContextManager(m.Manager).FindRequestCandidatesContext(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+
+	m.add(m.candidates, key, r.Subject, append(Policies{}, ps...), generation)
+	return ps, nil
+}
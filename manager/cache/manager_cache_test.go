@@ -0,0 +1,199 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/ory/ladon"
+	"github.com/ory/ladon/manager/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingManager counts the calls reaching the decorated manager.
+type countingManager struct {
+	*memory.MemoryManager
+	gets, finds int
+}
+
+func (m *countingManager) Get(id string) (Policy, error) {
+	m.gets++
+	return m.MemoryManager.Get(id)
+}
+
+func (m *countingManager) FindRequestCandidates(r *Request) (Policies, error) {
+	m.finds++
+	return m.MemoryManager.FindRequestCandidates(r)
+}
+
+func ids(t *testing.T, m Manager, subject string) []string {
+	ps, err := m.FindRequestCandidates(&Request{Subject: subject, Action: "get", Resource: "articles"})
+	require.NoError(t, err)
+
+	ids := []string{}
+	for _, p := range ps {
+		ids = append(ids, p.GetID())
+	}
+	return ids
+}
+
+func TestCacheManager(t *testing.T) {
+	now := time.Now()
+	underlying := &countingManager{MemoryManager: memory.NewMemoryManager()}
+	m := NewCacheManager(underlying, 10, time.Minute)
+	m.Clock = func() time.Time { return now }
+
+	require.NoError(t, m.Create(&DefaultPolicy{ID: "1", Subjects: []string{"peter"}, Actions: []string{"get"}, Resources: []string{"articles"}}))
+	require.NoError(t, m.Create(&DefaultPolicy{ID: "2", Subjects: []string{"ken"}, Actions: []string{"get"}, Resources: []string{"articles"}}))
+
+	t.Run("case=get is cached", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			p, err := m.Get("1")
+			require.NoError(t, err)
+			assert.Equal(t, "1", p.GetID())
+		}
+		assert.Equal(t, 1, underlying.gets)
+
+		for i := 0; i < 2; i++ {
+			_, err := m.Get("3")
+			assert.Error(t, err)
+		}
+		assert.Equal(t, 3, underlying.gets)
+	})
+
+	t.Run("case=candidates are cached", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			assert.Equal(t, []string{"1"}, ids(t, m, "peter"))
+		}
+		assert.Equal(t, []string{"2"}, ids(t, m, "ken"))
+		assert.Equal(t, 2, underlying.finds)
+	})
+
+	t.Run("case=writes invalidate affected entries", func(t *testing.T) {
+		underlying.finds = 0
+		require.NoError(t, m.Update(&DefaultPolicy{ID: "1", Subjects: []string{"max"}, Actions: []string{"get"}, Resources: []string{"articles"}}))
+		assert.Empty(t, ids(t, m, "peter"))
+		assert.Equal(t, []string{"1"}, ids(t, m, "max"))
+		assert.Equal(t, []string{"2"}, ids(t, m, "ken"))
+		assert.Equal(t, 2, underlying.finds)
+
+		p, err := m.Get("1")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"max"}, p.GetSubjects())
+
+		require.NoError(t, m.Create(&DefaultPolicy{ID: "3", Subjects: []string{"<.*>"}, Actions: []string{"get"}, Resources: []string{"articles"}}))
+		assert.Equal(t, []string{"2", "3"}, ids(t, m, "ken"))
+
+		require.NoError(t, m.Delete("3"))
+		assert.Equal(t, []string{"2"}, ids(t, m, "ken"))
+		_, err = m.Get("3")
+		assert.Error(t, err)
+	})
+
+	t.Run("case=entries expire", func(t *testing.T) {
+		require.NoError(t, underlying.Delete("2"))
+		assert.Equal(t, []string{"2"}, ids(t, m, "ken"))
+
+		now = now.Add(time.Minute)
+		assert.Empty(t, ids(t, m, "ken"))
+	})
+
+	t.Run("case=explicit invalidation", func(t *testing.T) {
+		p := &DefaultPolicy{ID: "4", Subjects: []string{"ken"}, Actions: []string{"get"}, Resources: []string{"articles"}}
+		require.NoError(t, underlying.Create(p))
+		assert.Empty(t, ids(t, m, "ken"))
+
+		m.InvalidatePolicy(p)
+		assert.Equal(t, []string{"4"}, ids(t, m, "ken"))
+
+		require.NoError(t, underlying.Delete("4"))
+		assert.Equal(t, []string{"4"}, ids(t, m, "ken"))
+
+		m.Invalidate()
+		assert.Empty(t, ids(t, m, "ken"))
+
+		// Glob patterns might match any subject as well.
+		p = &DefaultPolicy{ID: "5", Subjects: []string{"k*"}, Actions: []string{"get"}, Resources: []string{"articles"}}
+		require.NoError(t, underlying.Create(p))
+		assert.Empty(t, ids(t, m, "ken"))
+
+		m.InvalidatePolicy(p)
+		assert.Equal(t, []string{"5"}, ids(t, m, "ken"))
+	})
+
+	t.Run("case=size is bounded", func(t *testing.T) {
+		for _, s := range []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j", "k"} {
+			ids(t, m, s)
+		}
+		assert.Equal(t, 10, m.candidates.Len())
+	})
+}
+
+// expandingManager expands subjects to the roles assigned to them.
+type expandingManager struct {
+	*countingManager
+	roles map[string][]string
+}
+
+func (m *expandingManager) ExpandSubject(r *Request) ([]string, error) {
+	return m.roles[r.Subject], nil
+}
+
+func (m *expandingManager) FindRequestCandidates(r *Request) (Policies, error) {
+	var candidates = Policies{}
+	for _, s := range append([]string{r.Subject}, m.roles[r.Subject]...) {
+		req := *r
+		req.Subject = s
+		ps, err := m.countingManager.FindRequestCandidates(&req)
+		if err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, ps...)
+	}
+	return candidates, nil
+}
+
+func TestCacheManagerSubjectExpander(t *testing.T) {
+	underlying := &expandingManager{countingManager: &countingManager{MemoryManager: memory.NewMemoryManager()}, roles: map[string][]string{}}
+	m := NewCacheManager(underlying, 10, time.Minute)
+	require.NoError(t, m.Create(&DefaultPolicy{ID: "editors", Subjects: []string{"role:editor"}, Actions: []string{"get"}, Resources: []string{"articles"}}))
+
+	assert.Empty(t, ids(t, m, "peter"))
+	assert.Empty(t, ids(t, m, "peter"))
+	assert.Equal(t, 1, underlying.finds)
+
+	// Assigning a role changes the key, so the outdated candidates are not returned.
+	underlying.roles["peter"] = []string{"role:editor"}
+	assert.Equal(t, []string{"editors"}, ids(t, m, "peter"))
+	assert.Equal(t, []string{"editors"}, ids(t, m, "peter"))
+}
+
+func TestCacheManagerContext(t *testing.T) {
+	m := NewCacheManager(memory.NewMemoryManager(), 0, time.Minute)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := m.FindRequestCandidatesContext(ctx, &Request{Subject: "peter"})
+	assert.Error(t, err)
+}
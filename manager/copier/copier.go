@@ -0,0 +1,369 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+// Package copier copies the policies of one Manager to another, e.g. to move from the memory to the SQL manager, from
+// MySQL to PostgreSQL, or between environments.
+package copier
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	. "github.com/ory/ladon"
+	"github.com/pkg/errors"
+)
+
+// DefaultPageSize is the number of policies read at once if PageSize is not set.
+const DefaultPageSize = 500
+
+// Conflict decides what happens to a policy which exists in the destination with a different content.
+type Conflict string
+
+const (
+	// Fail aborts the copy before anything was written.
+	Fail Conflict = "fail"
+
+	// Skip keeps the policy of the destination.
+	Skip Conflict = "skip"
+
+	// Overwrite replaces the policy of the destination with the one of the source.
+	Overwrite Conflict = "overwrite"
+)
+
+// ErrConflictingPolicy is returned if a policy exists in the destination with a different content and conflicts fail.
+// Its cause is ladon.ErrConflict.
+var ErrConflictingPolicy = errors.WithMessage(ErrConflict, "Policy exists in the destination with a different content")
+
+// Progress counts the policies copied so far.
+type Progress struct {
+	// Read is the number of policies read from the source.
+	Read int `json:"read"`
+
+	// Created is the number of policies which did not exist in the destination.
+	Created int `json:"created"`
+
+	// Updated is the number of policies which were overwritten in the destination.
+	Updated int `json:"updated"`
+
+	// Skipped is the number of conflicting policies which were kept in the destination.
+	Skipped int `json:"skipped"`
+
+	// Unchanged is the number of policies which were equal in the destination already.
+	Unchanged int `json:"unchanged"`
+
+	// Conflicting is the number of policies which would fail the copy. Only dry runs count them, the copy itself fails
+	// instead.
+	Conflicting int `json:"conflicting"`
+}
+
+// The kinds of differences between the source and the destination.
+const (
+	// Missing policies exist in the source, but not in the destination.
+	Missing = "missing"
+
+	// Changed policies exist in both, but differ.
+	Changed = "changed"
+
+	// Extra policies exist in the destination, but not in the source.
+	Extra = "extra"
+)
+
+// Difference is a policy which differs between the source and the destination.
+type Difference struct {
+	// ID is the ID of the policy.
+	ID string `json:"id"`
+
+	// Kind is one of Missing, Changed and Extra.
+	Kind string `json:"kind"`
+}
+
+// Result is the result of a copy.
+type Result struct {
+	Progress
+
+	// Differences are the differences between the source and the destination after the copy. For a dry run, these
+	// are the differences the copy would have resolved, and those it would not have.
+	Differences []Difference `json:"differences"`
+}
+
+// Copier copies the policies of the source to the destination. Policies are compared by their content, the policy's
+// version (see ladon.VersionedPolicy) and the order of its subjects, actions and resources are ignored. Policies which
+// only exist in the destination are kept.
+type Copier struct {
+	Source      Manager
+	Destination Manager
+
+	// OnConflict decides what happens to a policy which exists in the destination with a different content. Defaults
+	// to Fail.
+	OnConflict Conflict
+
+	// DryRun reports what would be copied without writing to the destination. Conflicts which would fail the copy are
+	// counted and reported as differences instead.
+	DryRun bool
+
+	// PageSize is the number of policies read from the source at once. Defaults to DefaultPageSize.
+	PageSize int64
+
+	// Progress, if set, is called after each page of policies.
+	Progress func(p Progress)
+}
+
+// NewCopier returns a Copier which copies the policies of source to destination and fails on conflicts.
+func NewCopier(source, destination Manager) *Copier {
+	return &Copier{
+		Source:      source,
+		Destination: destination,
+		OnConflict:  Fail,
+		PageSize:    DefaultPageSize,
+	}
+}
+
+func (c *Copier) pageSize() int64 {
+	if c.PageSize <= 0 {
+		return DefaultPageSize
+	}
+	return c.PageSize
+}
+
+// Copy copies the policies and checks the differences between the source and the destination afterwards. If conflicts
+// fail, all policies are checked for conflicts before the first one is written. If an error occurs, the result counts
+// the policies copied until then.
+func (c *Copier) Copy() (*Result, error) {
+	switch c.OnConflict {
+	case "", Fail:
+		if !c.DryRun {
+			if err := each(c.Source, c.pageSize(), func(p Policy) error {
+				_, err := c.plan(p)
+				return err
+			}, nil); err != nil {
+				return nil, err
+			}
+		}
+	case Skip, Overwrite:
+	default:
+		return nil, errors.Errorf("Unknown conflict handling %s", c.OnConflict)
+	}
+
+	var result Result
+	if err := each(c.Source, c.pageSize(), func(p Policy) error {
+		action, err := c.plan(p)
+		if err != nil {
+			return err
+		}
+
+		result.Read++
+		switch action {
+		case Missing:
+			if !c.DryRun {
+				if err := c.Destination.Create(p); err != nil {
+					return errors.Wrapf(err, "Could not create policy %s", p.GetID())
+				}
+			}
+			result.Created++
+		case Changed:
+			if c.OnConflict == "" || c.OnConflict == Fail {
+				result.Conflicting++
+				return nil
+			} else if c.OnConflict == Skip {
+				result.Skipped++
+				return nil
+			}
+
+			if !c.DryRun {
+				if err := c.Destination.Update(p); err != nil {
+					return errors.Wrapf(err, "Could not update policy %s", p.GetID())
+				}
+			}
+			result.Updated++
+		default:
+			result.Unchanged++
+		}
+		return nil
+	}, func() {
+		if c.Progress != nil {
+			c.Progress(result.Progress)
+		}
+	}); err != nil {
+		return &result, err
+	}
+
+	differences, err := Diff(c.Source, c.Destination, c.pageSize())
+	if err != nil {
+		return &result, err
+	}
+	result.Differences = differences
+	return &result, nil
+}
+
+// plan returns Missing if the policy does not exist in the destination, Changed if it differs and conflicts do not fail
+// or this is a dry run, and an empty string if it is equal.
+func (c *Copier) plan(p Policy) (string, error) {
+	kind, err := compare(p, c.Destination)
+	if err != nil {
+		return "", err
+	} else if kind == Changed && (c.OnConflict == "" || c.OnConflict == Fail) && !c.DryRun {
+		return "", errors.Wrapf(ErrConflictingPolicy, "Could not copy policy %s", p.GetID())
+	}
+	return kind, nil
+}
+
+// Diff returns the policies which differ between source and destination, reading pageSize policies at once.
+func Diff(source, destination Manager, pageSize int64) ([]Difference, error) {
+	var differences []Difference
+	var ids = map[string]bool{}
+	if err := each(source, pageSize, func(p Policy) error {
+		ids[p.GetID()] = true
+		kind, err := compare(p, destination)
+		if err != nil {
+			return err
+		} else if kind != "" {
+			differences = append(differences, Difference{ID: p.GetID(), Kind: kind})
+		}
+		return nil
+	}, nil); err != nil {
+		return nil, err
+	}
+
+	if err := each(destination, pageSize, func(p Policy) error {
+		if !ids[p.GetID()] {
+			differences = append(differences, Difference{ID: p.GetID(), Kind: Extra})
+		}
+		return nil
+	}, nil); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(differences, func(i, j int) bool { return differences[i].ID < differences[j].ID })
+	return differences, nil
+}
+
+// compare returns Missing if the policy does not exist in m, Changed if it differs and an empty string if it is equal.
+func compare(p Policy, m Manager) (string, error) {
+	existing, err := m.Get(p.GetID())
+	if err != nil {
+		if sc, ok := errors.Cause(err).(interface {
+			StatusCode() int
+		}); ok && sc.StatusCode() == http.StatusNotFound {
+			return Missing, nil
+		}
+		return "", errors.Wrapf(err, "Could not get policy %s", p.GetID())
+	}
+
+	equal, err := Equal(p, existing)
+	if err != nil {
+		return "", err
+	} else if !equal {
+		return Changed, nil
+	}
+	return "", nil
+}
+
+// each calls fn for every policy of m, reading pageSize policies at once, and page after every page.
+func each(m Manager, pageSize int64, fn func(p Policy) error, page func()) error {
+	for offset := int64(0); ; offset += pageSize {
+		ps, err := m.GetAll(pageSize, offset)
+		if err != nil {
+			return errors.Wrapf(err, "Could not get policies %d to %d", offset, offset+pageSize)
+		}
+
+		for _, p := range ps {
+			if err := fn(p); err != nil {
+				return err
+			}
+		}
+
+		if page != nil {
+			page()
+		}
+		if int64(len(ps)) < pageSize {
+			return nil
+		}
+	}
+}
+
+// content is the part of a policy which is compared.
+type content struct {
+	ID          string     `json:"id"`
+	Description string     `json:"description"`
+	Subjects    []string   `json:"subjects"`
+	Effect      string     `json:"effect"`
+	Resources   []string   `json:"resources"`
+	Actions     []string   `json:"actions"`
+	Conditions  Conditions `json:"conditions"`
+	Priority    int        `json:"priority"`
+	NotBefore   *int64     `json:"not_before"`
+	NotAfter    *int64     `json:"not_after"`
+}
+
+func newContent(p Policy) *content {
+	sorted := func(values []string) []string {
+		values = append([]string{}, values...)
+		sort.Strings(values)
+		return values
+	}
+
+	c := &content{
+		ID:          p.GetID(),
+		Description: p.GetDescription(),
+		Subjects:    sorted(p.GetSubjects()),
+		Effect:      p.GetEffect(),
+		Resources:   sorted(p.GetResources()),
+		Actions:     sorted(p.GetActions()),
+		Conditions:  p.GetConditions(),
+	}
+	if c.Conditions == nil {
+		c.Conditions = Conditions{}
+	}
+
+	if pp, ok := p.(PriorityPolicy); ok {
+		c.Priority = pp.GetPriority()
+	}
+
+	// The validity period is compared as unix time in microseconds, so that its time zone does not matter. The SQL
+	// managers store it with the same precision.
+	if vp, ok := p.(ValidityPolicy); ok {
+		if t := vp.GetNotBefore(); t != nil {
+			u := t.Unix()*1e6 + int64(t.Nanosecond()/1e3)
+			c.NotBefore = &u
+		}
+		if t := vp.GetNotAfter(); t != nil {
+			u := t.Unix()*1e6 + int64(t.Nanosecond()/1e3)
+			c.NotAfter = &u
+		}
+	}
+	return c
+}
+
+// Equal returns true if both policies have the same content. Their versions and the order of their subjects, actions
+// and resources are ignored.
+func Equal(a, b Policy) (bool, error) {
+	ac, err := json.Marshal(newContent(a))
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+
+	bc, err := json.Marshal(newContent(b))
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	return bytes.Equal(ac, bc), nil
+}
@@ -0,0 +1,199 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package copier_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ory/ladon"
+	"github.com/ory/ladon/manager/copier"
+	"github.com/ory/ladon/manager/memory"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func policy(id, description string, subjects ...string) *ladon.DefaultPolicy {
+	return &ladon.DefaultPolicy{
+		ID:          id,
+		Description: description,
+		Subjects:    subjects,
+		Effect:      ladon.AllowAccess,
+		Resources:   []string{"articles:<.*>"},
+		Actions:     []string{"view"},
+	}
+}
+
+func setup(t *testing.T) (source, destination *memory.MemoryManager) {
+	source, destination = memory.NewMemoryManager(), memory.NewMemoryManager()
+	for _, p := range []*ladon.DefaultPolicy{
+		policy("a", "a", "peter"),
+		policy("b", "b", "peter", "max"),
+		policy("c", "c", "peter"),
+		policy("e", "e", "peter"),
+	} {
+		require.NoError(t, source.Create(p))
+	}
+
+	for _, p := range []*ladon.DefaultPolicy{
+		policy("b", "b", "max", "peter"),
+		policy("c", "changed", "peter"),
+		policy("d", "d", "peter"),
+	} {
+		require.NoError(t, destination.Create(p))
+	}
+	return source, destination
+}
+
+func TestCopy(t *testing.T) {
+	t.Run("case=fail", func(t *testing.T) {
+		source, destination := setup(t)
+		c := copier.NewCopier(source, destination)
+
+		_, err := c.Copy()
+		require.Error(t, err)
+		assert.Equal(t, ladon.ErrConflict, errors.Cause(err))
+		assert.Contains(t, err.Error(), "policy c")
+
+		// Nothing was written, not even the policies before the conflict.
+		_, err = destination.Get("a")
+		assert.Error(t, err)
+	})
+
+	t.Run("case=dry run", func(t *testing.T) {
+		source, destination := setup(t)
+		c := copier.NewCopier(source, destination)
+		c.OnConflict = copier.Overwrite
+		c.DryRun = true
+
+		result, err := c.Copy()
+		require.NoError(t, err)
+		assert.Equal(t, copier.Progress{Read: 4, Created: 2, Updated: 1, Unchanged: 1}, result.Progress)
+		assert.Equal(t, []copier.Difference{
+			{ID: "a", Kind: copier.Missing},
+			{ID: "c", Kind: copier.Changed},
+			{ID: "d", Kind: copier.Extra},
+			{ID: "e", Kind: copier.Missing},
+		}, result.Differences)
+
+		all, err := destination.GetAll(10, 0)
+		require.NoError(t, err)
+		assert.Len(t, all, 3)
+	})
+
+	t.Run("case=dry run fail", func(t *testing.T) {
+		source, destination := setup(t)
+		c := copier.NewCopier(source, destination)
+		c.DryRun = true
+
+		result, err := c.Copy()
+		require.NoError(t, err)
+		assert.Equal(t, copier.Progress{Read: 4, Created: 2, Unchanged: 1, Conflicting: 1}, result.Progress)
+		assert.Equal(t, []copier.Difference{
+			{ID: "a", Kind: copier.Missing},
+			{ID: "c", Kind: copier.Changed},
+			{ID: "d", Kind: copier.Extra},
+			{ID: "e", Kind: copier.Missing},
+		}, result.Differences)
+
+		all, err := destination.GetAll(10, 0)
+		require.NoError(t, err)
+		assert.Len(t, all, 3)
+	})
+
+	t.Run("case=skip", func(t *testing.T) {
+		source, destination := setup(t)
+		c := copier.NewCopier(source, destination)
+		c.OnConflict = copier.Skip
+		c.PageSize = 3
+
+		var progress []copier.Progress
+		c.Progress = func(p copier.Progress) {
+			progress = append(progress, p)
+		}
+
+		result, err := c.Copy()
+		require.NoError(t, err)
+		assert.Equal(t, copier.Progress{Read: 4, Created: 2, Skipped: 1, Unchanged: 1}, result.Progress)
+		assert.Equal(t, []copier.Progress{
+			{Read: 3, Created: 1, Skipped: 1, Unchanged: 1},
+			{Read: 4, Created: 2, Skipped: 1, Unchanged: 1},
+		}, progress)
+		assert.Equal(t, []copier.Difference{
+			{ID: "c", Kind: copier.Changed},
+			{ID: "d", Kind: copier.Extra},
+		}, result.Differences)
+
+		p, err := destination.Get("c")
+		require.NoError(t, err)
+		assert.Equal(t, "changed", p.GetDescription())
+	})
+
+	t.Run("case=overwrite", func(t *testing.T) {
+		source, destination := setup(t)
+		c := copier.NewCopier(source, destination)
+		c.OnConflict = copier.Overwrite
+
+		result, err := c.Copy()
+		require.NoError(t, err)
+		assert.Equal(t, copier.Progress{Read: 4, Created: 2, Updated: 1, Unchanged: 1}, result.Progress)
+		assert.Equal(t, []copier.Difference{{ID: "d", Kind: copier.Extra}}, result.Differences)
+
+		p, err := destination.Get("c")
+		require.NoError(t, err)
+		assert.Equal(t, "c", p.GetDescription())
+	})
+
+	t.Run("case=unknown conflict handling", func(t *testing.T) {
+		source, destination := setup(t)
+		c := copier.NewCopier(source, destination)
+		c.OnConflict = "merge"
+
+		_, err := c.Copy()
+		assert.Error(t, err)
+	})
+}
+
+func TestEqual(t *testing.T) {
+	now := time.Now()
+	a, b := policy("a", "a", "peter", "max"), policy("a", "a", "max", "peter")
+	a.NotBefore, a.Version = &now, 1
+	utc := now.UTC()
+	b.NotBefore, b.Version, b.Conditions = &utc, 2, ladon.Conditions{}
+
+	equal, err := copier.Equal(a, b)
+	require.NoError(t, err)
+	assert.True(t, equal)
+
+	b.Priority = 1
+	equal, err = copier.Equal(a, b)
+	require.NoError(t, err)
+	assert.False(t, equal)
+
+	// Sub-second differences of the validity period are not ignored.
+	b.Priority = 0
+	truncated := now.Truncate(time.Second).Add(-time.Nanosecond)
+	b.NotBefore = &truncated
+	equal, err = copier.Equal(a, b)
+	require.NoError(t, err)
+	assert.False(t, equal)
+}
@@ -0,0 +1,267 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package file
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ory/ladon"
+	"github.com/ory/ladon/internal/yamljson"
+	"github.com/pkg/errors"
+)
+
+// isYAML returns true if the file's extension is .yml or .yaml.
+func isYAML(file string) bool {
+	ext := strings.ToLower(filepath.Ext(file))
+	return ext == ".yml" || ext == ".yaml"
+}
+
+// isPolicyFile returns true if the file's extension is .json, .yml or .yaml.
+func isPolicyFile(file string) bool {
+	return isYAML(file) || strings.ToLower(filepath.Ext(file)) == ".json"
+}
+
+// policySet is a validated set of policies and the files they were loaded from.
+type policySet struct {
+	// files contains the policies of each file in the order they are defined in.
+	files map[string][]*ladon.DefaultPolicy
+
+	// sources maps policy IDs to the file defining them.
+	sources map[string]string
+
+	// order contains the files in the order they were read.
+	order []string
+}
+
+func (s *policySet) policies() []*ladon.DefaultPolicy {
+	var policies []*ladon.DefaultPolicy
+	for _, file := range s.order {
+		policies = append(policies, s.files[file]...)
+	}
+	return policies
+}
+
+// replace returns a copy of the set in which the policies of file are replaced. A new file is added after the
+// others, and a file without policies is removed from the set.
+func (s *policySet) replace(file string, policies []*ladon.DefaultPolicy) *policySet {
+	next := &policySet{
+		files:   map[string][]*ladon.DefaultPolicy{},
+		sources: map[string]string{},
+	}
+
+	order := s.order
+	if _, ok := s.files[file]; !ok {
+		order = append(order[:len(order):len(order)], file)
+	}
+
+	for _, f := range order {
+		ps := s.files[f]
+		if f == file {
+			ps = policies
+		}
+		if len(ps) == 0 {
+			continue
+		}
+
+		next.files[f] = ps
+		next.order = append(next.order, f)
+		for _, p := range ps {
+			next.sources[p.ID] = f
+		}
+	}
+	return next
+}
+
+// Load reads and validates the policies of all given files and directories. Directories are searched for files ending
+// with .json, .yml or .yaml, which are read in lexical order. A file contains either a single policy or a list of
+// policies. Policy IDs must be unique across all files.
+func Load(paths ...string) ([]*ladon.DefaultPolicy, error) {
+	s, err := load(paths)
+	if err != nil {
+		return nil, err
+	}
+	return s.policies(), nil
+}
+
+func load(paths []string) (*policySet, error) {
+	s := &policySet{
+		files:   map[string][]*ladon.DefaultPolicy{},
+		sources: map[string]string{},
+	}
+
+	for _, path := range paths {
+		files, err := policyFiles(path)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, file := range files {
+			if _, ok := s.files[file]; ok {
+				continue
+			}
+
+			ps, err := loadFile(file)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, p := range ps {
+				if other, ok := s.sources[p.ID]; ok {
+					return nil, errors.Errorf("%s: Policy %s is already defined in %s", file, p.ID, other)
+				}
+				s.sources[p.ID] = file
+			}
+			s.files[file] = ps
+			s.order = append(s.order, file)
+		}
+	}
+
+	return s, nil
+}
+
+// policyFiles returns path if it is a file, and the policy files contained in path if it is a directory.
+func policyFiles(path string) ([]string, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	} else if !fi.IsDir() {
+		return []string{path}, nil
+	}
+
+	var files []string
+	err = filepath.Walk(path, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !fi.IsDir() && isPolicyFile(p) {
+			files = append(files, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	sort.Strings(files)
+	return files, nil
+}
+
+// loadFile reads a file which contains either a single policy or a list of policies.
+func loadFile(file string) ([]*ladon.DefaultPolicy, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if isYAML(file) {
+		if data, err = yamljson.ToJSON(data); err != nil {
+			return nil, errors.Wrapf(err, "%s", file)
+		}
+	}
+
+	var policies []*ladon.DefaultPolicy
+	if data = bytes.TrimSpace(data); len(data) > 0 && data[0] == '[' {
+		err = json.Unmarshal(data, &policies)
+	} else {
+		var p ladon.DefaultPolicy
+		err = json.Unmarshal(data, &p)
+		policies = []*ladon.DefaultPolicy{&p}
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "%s", file)
+	}
+
+	for k, p := range policies {
+		if err := ladon.ValidatePolicy(p); err != nil {
+			return nil, errors.Wrapf(err, "%s: policy %d", file, k)
+		}
+	}
+	return policies, nil
+}
+
+// writeFile atomically replaces the file with the policies, or removes it if there are none. A single policy is
+// written as object, multiple policies as list.
+func writeFile(file string, policies []*ladon.DefaultPolicy) error {
+	if len(policies) == 0 {
+		return errors.WithStack(os.Remove(file))
+	}
+
+	var v interface{} = policies
+	if len(policies) == 1 {
+		v = policies[0]
+	}
+
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if isYAML(file) {
+		if data, err = yamljson.FromJSON(data); err != nil {
+			return err
+		}
+	} else {
+		data = append(data, '\n')
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(file), "."+filepath.Base(file))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return errors.WithStack(err)
+	}
+	if err := tmp.Close(); err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(os.Rename(tmp.Name(), file))
+}
+
+// fingerprint describes the names, sizes and modification times of the policy files found in the paths. It changes
+// whenever a policy file is added, removed or modified.
+func fingerprint(paths []string) (string, error) {
+	var b bytes.Buffer
+	for _, path := range paths {
+		files, err := policyFiles(path)
+		if err != nil {
+			return "", err
+		}
+
+		for _, file := range files {
+			fi, err := os.Stat(file)
+			if err != nil {
+				return "", errors.WithStack(err)
+			}
+			fmt.Fprintf(&b, "%s\x00%d\x00%d\n", file, fi.Size(), fi.ModTime().UnixNano())
+		}
+	}
+	return b.String(), nil
+}
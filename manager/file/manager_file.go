@@ -0,0 +1,309 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+// Package file provides a Manager serving policies from JSON and YAML files.
+package file
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	. "github.com/ory/ladon"
+	"github.com/ory/ladon/manager/memory"
+	"github.com/pkg/errors"
+)
+
+// state is an immutable set of policies.
+type state struct {
+	set         *policySet
+	manager     *memory.MemoryManager
+	fingerprint string
+}
+
+// FileManager is a Manager serving the policies defined in a set of files and directories (see Load).
+//
+// The policies are kept in memory. Reload, or AutoReload, reads all files again. If all of them are valid, the
+// policies are replaced at once, otherwise the error is logged and the previous policies are kept. Requests being
+// evaluated keep using the policies they started with.
+//
+// By default, policies are read-only and writes return ladon.ErrReadOnly. If WriteBack is set, changes are written to the files: Updated and deleted
+// policies are changed in the file defining them, created policies are written to a new file named after the
+// policy's ID in the first path, which must be a directory.
+//
+// FileManager does not implement ladon.VersionedManager, as the files may be changed without going through it.
+type FileManager struct {
+	// Paths are the files and directories the policies are loaded from.
+	Paths []string
+
+	// WriteBack enables writing changes back to the files.
+	WriteBack bool
+
+	// Logger logs rejected reloads. Defaults to a logger writing to stderr.
+	Logger *log.Logger
+
+	// current holds the current *state.
+	current atomic.Value
+
+	// rejected is the fingerprint of the files which were rejected last, so the error is only logged once.
+	rejected string
+
+	sync.Mutex
+}
+
+// NewFileManager loads the policies of the given files and directories.
+func NewFileManager(paths ...string) (*FileManager, error) {
+	m := &FileManager{Paths: paths}
+	if err := m.Reload(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (m *FileManager) logger() *log.Logger {
+	if m.Logger == nil {
+		m.Logger = log.New(os.Stderr, "", log.LstdFlags)
+	}
+	return m.Logger
+}
+
+func (m *FileManager) state() *state {
+	s, _ := m.current.Load().(*state)
+	if s == nil {
+		return &state{set: &policySet{}, manager: memory.NewMemoryManager()}
+	}
+	return s
+}
+
+// Reload reads all files again and replaces the policies if all of them are valid.
+func (m *FileManager) Reload() error {
+	m.Lock()
+	defer m.Unlock()
+	return m.reload()
+}
+
+// reload replaces the current state. The lock must be held.
+func (m *FileManager) reload() error {
+	fp, err := fingerprint(m.Paths)
+	if err != nil {
+		return err
+	}
+
+	set, err := load(m.Paths)
+	if err != nil {
+		return err
+	}
+
+	mm, err := newMemoryManager(set)
+	if err != nil {
+		return err
+	}
+
+	m.current.Store(&state{set: set, manager: mm, fingerprint: fp})
+	m.rejected = ""
+	return nil
+}
+
+// newMemoryManager returns a memory manager holding the policies of the set.
+func newMemoryManager(set *policySet) (*memory.MemoryManager, error) {
+	mm := memory.NewMemoryManager()
+	for _, p := range set.policies() {
+		if err := mm.Create(p); err != nil {
+			return nil, err
+		}
+	}
+	return mm, nil
+}
+
+// AutoReload checks the files for changes every interval and reloads them until ctx is done. Changes are detected by
+// the files' names, sizes and modification times. Call it in a goroutine.
+func (m *FileManager) AutoReload(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.reloadIfChanged()
+		}
+	}
+}
+
+// reloadIfChanged reloads the files if they changed since they were loaded, or rejected, last.
+func (m *FileManager) reloadIfChanged() {
+	m.Lock()
+	defer m.Unlock()
+
+	fp, err := fingerprint(m.Paths)
+	if err == nil && (fp == m.state().fingerprint || fp == m.rejected) {
+		return
+	}
+
+	if err == nil {
+		err = m.reload()
+	}
+	if err != nil {
+		m.rejected = fp
+		m.logger().Printf("Rejected changes to policies, keeping the previous ones: %s", err)
+	}
+}
+
+// toDefaultPolicy validates the policy and converts it to a DefaultPolicy, which is the only type that can be
+// written to files.
+func toDefaultPolicy(policy Policy) (*DefaultPolicy, error) {
+	p, ok := policy.(*DefaultPolicy)
+	if !ok {
+		data, err := json.Marshal(policy)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		p = new(DefaultPolicy)
+		if err := json.Unmarshal(data, p); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := ValidatePolicy(p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// write replaces the policy with the given id by policy, or removes it if policy is nil, and writes the affected file.
+// If create is true, the policy must not exist yet.
+//
+// The new policies are built in memory before the file is written, and replace the current ones only once the file
+// was written. If any step fails, neither the files nor the policies in memory are changed.
+func (m *FileManager) write(id string, policy Policy, create bool) error {
+	if !m.WriteBack {
+		return errors.WithStack(ErrReadOnly)
+	}
+
+	var p *DefaultPolicy
+	if policy != nil {
+		var err error
+		if p, err = toDefaultPolicy(policy); err != nil {
+			return err
+		}
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	// Pick up changes made to the files since they were loaded, so they are neither overwritten nor masked by the
+	// fingerprint stored below. If the files are invalid now, nothing is written.
+	if fp, err := fingerprint(m.Paths); err != nil {
+		return err
+	} else if fp != m.state().fingerprint {
+		if err := m.reload(); err != nil {
+			return err
+		}
+	}
+
+	set := m.state().set
+	file, ok := set.sources[id]
+	if ok && create {
+		return errors.New("Policy exists")
+	} else if !ok && p == nil {
+		return nil
+	} else if !ok {
+		if len(m.Paths) == 0 {
+			return errors.New("No path to write policies to")
+		} else if fi, err := os.Stat(m.Paths[0]); err != nil {
+			return errors.WithStack(err)
+		} else if !fi.IsDir() {
+			return errors.Errorf("Can not create policy %s because %s is not a directory", id, m.Paths[0])
+		}
+
+		file = filepath.Join(m.Paths[0], url.PathEscape(id)+".json")
+		if _, err := os.Stat(file); err == nil {
+			return errors.Errorf("Can not create policy %s because %s exists", id, file)
+		}
+	}
+
+	var policies []*DefaultPolicy
+	var replaced bool
+	for _, existing := range set.files[file] {
+		if existing.ID != id {
+			policies = append(policies, existing)
+		} else if p != nil {
+			policies = append(policies, p)
+			replaced = true
+		}
+	}
+	if p != nil && !replaced {
+		policies = append(policies, p)
+	}
+
+	next := set.replace(file, policies)
+	mm, err := newMemoryManager(next)
+	if err != nil {
+		return err
+	}
+
+	if err := writeFile(file, policies); err != nil {
+		return err
+	}
+
+	// If the fingerprint can not be determined, the files are reloaded by the next AutoReload.
+	fp, _ := fingerprint(m.Paths)
+	m.current.Store(&state{set: next, manager: mm, fingerprint: fp})
+	m.rejected = ""
+	return nil
+}
+
+// Create persists the policy.
+func (m *FileManager) Create(policy Policy) error {
+	return m.write(policy.GetID(), policy, true)
+}
+
+// Update updates an existing policy.
+func (m *FileManager) Update(policy Policy) error {
+	return m.write(policy.GetID(), policy, false)
+}
+
+// Delete removes a policy.
+func (m *FileManager) Delete(id string) error {
+	return m.write(id, nil, false)
+}
+
+// Get retrieves a policy.
+func (m *FileManager) Get(id string) (Policy, error) {
+	return m.state().manager.Get(id)
+}
+
+// GetAll returns all policies.
+func (m *FileManager) GetAll(limit, offset int64) (Policies, error) {
+	return m.state().manager.GetAll(limit, offset)
+}
+
+// FindRequestCandidates returns candidates that could match the request object.
+func (m *FileManager) FindRequestCandidates(r *Request) (Policies, error) {
+	return m.state().manager.FindRequestCandidates(r)
+}
@@ -0,0 +1,256 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package file
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	. "github.com/ory/ladon"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const articlesPolicy = `{
+	"id": "articles",
+	"subjects": ["<peter|ken>"],
+	"actions": ["get"],
+	"resources": ["articles:<.*>"],
+	"effect": "allow"
+}`
+
+const commentsPolicies = `
+- id: comments
+  subjects: [peter]
+  actions: [create]
+  resources: ["comments:<.*>"]
+  effect: allow
+- id: no-max
+  subjects: [max]
+  actions: ["<.*>"]
+  resources: ["<.*>"]
+  effect: deny
+`
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755))
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	}
+}
+
+func tempDir(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "ladon-file")
+	require.NoError(t, err)
+	writeFiles(t, dir, files)
+	return dir
+}
+
+func policyIDs(t *testing.T, m Manager) []string {
+	ps, err := m.GetAll(100, 0)
+	require.NoError(t, err)
+
+	ids := []string{}
+	for _, p := range ps {
+		ids = append(ids, p.GetID())
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func TestLoad(t *testing.T) {
+	dir := tempDir(t, map[string]string{
+		"articles.json":        articlesPolicy,
+		"nested/comments.yaml": commentsPolicies,
+		"README.md":            "not a policy",
+	})
+	defer os.RemoveAll(dir)
+
+	policies, err := Load(dir)
+	require.NoError(t, err)
+	require.Len(t, policies, 3)
+	assert.Equal(t, "articles", policies[0].ID)
+	assert.Equal(t, "comments", policies[1].ID)
+	assert.Equal(t, []string{"comments:<.*>"}, policies[1].Resources)
+	assert.Equal(t, DenyAccess, policies[2].Effect)
+
+	for name, content := range map[string]string{
+		"template.json":  `{"id": "1", "effect": "allow", "subjects": ["<[>"]}`,
+		"effect.yml":     "id: 1\neffect: maybe",
+		"malformed.json": `{"id": `,
+	} {
+		broken := tempDir(t, map[string]string{name: content})
+		_, err := Load(broken)
+		require.Error(t, err, name)
+		assert.Contains(t, err.Error(), name)
+		os.RemoveAll(broken)
+	}
+
+	_, err = Load(dir, filepath.Join(dir, "articles.json"), filepath.Join(dir, "nested"))
+	require.NoError(t, err, "files given twice are only read once")
+
+	duplicate := tempDir(t, map[string]string{"articles.json": articlesPolicy})
+	defer os.RemoveAll(duplicate)
+	_, err = Load(dir, duplicate)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "already defined")
+}
+
+func TestFileManagerReadOnly(t *testing.T) {
+	dir := tempDir(t, map[string]string{"articles.json": articlesPolicy, "comments.yml": commentsPolicies})
+	defer os.RemoveAll(dir)
+
+	m, err := NewFileManager(dir)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"articles", "comments", "no-max"}, policyIDs(t, m))
+
+	warden := &Ladon{Manager: m}
+	assert.NoError(t, warden.IsAllowed(&Request{Subject: "ken", Action: "get", Resource: "articles:1"}))
+	assert.Error(t, warden.IsAllowed(&Request{Subject: "ken", Action: "create", Resource: "comments:1"}))
+
+	p, err := m.Get("articles")
+	require.NoError(t, err)
+	assert.Equal(t, ErrReadOnly, m.Update(p).(interface{ Cause() error }).Cause())
+	assert.Error(t, m.Create(&DefaultPolicy{ID: "new", Effect: AllowAccess}))
+	assert.Error(t, m.Delete("articles"))
+
+	_, err = NewFileManager(filepath.Join(dir, "missing"))
+	assert.Error(t, err)
+}
+
+func TestFileManagerReload(t *testing.T) {
+	dir := tempDir(t, map[string]string{"articles.json": articlesPolicy})
+	defer os.RemoveAll(dir)
+
+	var logs bytes.Buffer
+	m, err := NewFileManager(dir)
+	require.NoError(t, err)
+	m.Logger = log.New(&logs, "", 0)
+
+	writeFiles(t, dir, map[string]string{"comments.yaml": commentsPolicies})
+	m.reloadIfChanged()
+	assert.Equal(t, []string{"articles", "comments", "no-max"}, policyIDs(t, m))
+
+	// An invalid file is rejected as a whole, the previous policies are kept.
+	writeFiles(t, dir, map[string]string{"articles.json": `{"id": "articles", "effect": "allow"}`, "broken.json": `{"id": "broken", "effect": "allow", "resources": ["<[>"]}`})
+	m.reloadIfChanged()
+	m.reloadIfChanged()
+	assert.Equal(t, []string{"articles", "comments", "no-max"}, policyIDs(t, m))
+	p, err := m.Get("articles")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"<peter|ken>"}, p.GetSubjects())
+	assert.Contains(t, logs.String(), "broken.json")
+	assert.Equal(t, 1, bytes.Count(logs.Bytes(), []byte("Rejected")), "the error is only logged once")
+	assert.Error(t, m.Reload())
+
+	require.NoError(t, os.Remove(filepath.Join(dir, "broken.json")))
+	m.reloadIfChanged()
+	p, err = m.Get("articles")
+	require.NoError(t, err)
+	assert.Empty(t, p.GetSubjects())
+}
+
+func TestFileManagerAutoReload(t *testing.T) {
+	dir := tempDir(t, map[string]string{"articles.json": articlesPolicy})
+	defer os.RemoveAll(dir)
+
+	m, err := NewFileManager(dir)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go m.AutoReload(ctx, 10*time.Millisecond)
+
+	writeFiles(t, dir, map[string]string{"comments.yaml": commentsPolicies})
+	expected := []string{"articles", "comments", "no-max"}
+	for i := 0; i < 200 && !assert.ObjectsAreEqual(expected, policyIDs(t, m)); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, expected, policyIDs(t, m))
+}
+
+func TestFileManagerWriteBack(t *testing.T) {
+	dir := tempDir(t, map[string]string{"articles.json": articlesPolicy, "comments.yml": commentsPolicies})
+	defer os.RemoveAll(dir)
+
+	m, err := NewFileManager(dir)
+	require.NoError(t, err)
+	m.WriteBack = true
+
+	require.NoError(t, m.Create(&DefaultPolicy{ID: "users:new", Subjects: []string{"zac"}, Actions: []string{"get"}, Resources: []string{"users"}, Effect: AllowAccess}))
+	assert.Error(t, m.Create(&DefaultPolicy{ID: "users:new", Effect: AllowAccess}))
+	assert.Error(t, m.Create(&DefaultPolicy{ID: "invalid", Effect: "maybe"}))
+
+	require.NoError(t, m.Update(&DefaultPolicy{ID: "comments", Subjects: []string{"ken"}, Actions: []string{"create"}, Resources: []string{"comments:<.*>"}, Effect: AllowAccess}))
+	require.NoError(t, m.Delete("articles"))
+	require.NoError(t, m.Delete("unknown"))
+	assert.Equal(t, []string{"comments", "no-max", "users:new"}, policyIDs(t, m))
+
+	// The changes are in the files.
+	_, err = os.Stat(filepath.Join(dir, "articles.json"))
+	assert.True(t, os.IsNotExist(err))
+
+	policies, err := Load(dir)
+	require.NoError(t, err)
+	require.Len(t, policies, 3)
+	assert.Equal(t, "comments", policies[0].ID)
+	assert.Equal(t, []string{"ken"}, policies[0].Subjects)
+	assert.Equal(t, "no-max", policies[1].ID)
+	assert.Equal(t, "users:new", policies[2].ID)
+
+	files, err := filepath.Glob(filepath.Join(dir, "*"))
+	require.NoError(t, err)
+	assert.Len(t, files, 2)
+
+	readOnly, err := NewFileManager(filepath.Join(dir, "comments.yml"))
+	require.NoError(t, err)
+	readOnly.WriteBack = true
+	assert.Error(t, readOnly.Create(&DefaultPolicy{ID: "other", Effect: AllowAccess}), "new policies need a directory")
+}
+
+func TestFileManagerWriteBackInvalidFiles(t *testing.T) {
+	dir := tempDir(t, map[string]string{"articles.json": articlesPolicy})
+	defer os.RemoveAll(dir)
+
+	m, err := NewFileManager(dir)
+	require.NoError(t, err)
+	m.WriteBack = true
+
+	// A write neither changes the files nor the policies in memory while the files are invalid.
+	writeFiles(t, dir, map[string]string{"broken.json": `{"id": "broken", "effect": "allow", "resources": ["<[>"]}`})
+	assert.Error(t, m.Create(&DefaultPolicy{ID: "new", Subjects: []string{"zac"}, Effect: AllowAccess}))
+	assert.Equal(t, []string{"articles"}, policyIDs(t, m))
+
+	_, err = os.Stat(filepath.Join(dir, "new.json"))
+	assert.True(t, os.IsNotExist(err))
+
+	// Once the files are valid again, writes pick up the changes made to them.
+	writeFiles(t, dir, map[string]string{"broken.json": `{"id": "fixed", "effect": "allow"}`})
+	require.NoError(t, m.Create(&DefaultPolicy{ID: "new", Subjects: []string{"zac"}, Effect: AllowAccess}))
+	assert.Equal(t, []string{"articles", "fixed", "new"}, policyIDs(t, m))
+}
@@ -0,0 +1,211 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+// Package index provides a Manager decorator which finds request candidates using a precompiled index instead of
+// asking the decorated manager.
+package index
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	. "github.com/ory/ladon"
+	"github.com/pkg/errors"
+)
+
+// rebuildPageSize is the number of policies fetched at once when the index is rebuilt.
+const rebuildPageSize = 10000
+
+// IndexedManager decorates a Manager and answers FindRequestCandidates from an immutable, precompiled snapshot of all
+// policies. The subjects, actions and resources of the policies are each stored in a radix trie: Literal values and
+// templates matching everything after a literal prefix (e.g. "articles:<.*>") are looked up without evaluating any
+// regular expression, all other templates are grouped by their literal prefix and combined into a few automata.
+// Looking up the candidates of a request therefore takes time proportional to the length of the requested values
+// and the number of candidates, not to the number of policies.
+//
+// The candidates returned are exactly the policies whose subjects, actions and resources match the request, their
+// validity period is checked by the warden. Templates are interpreted like DefaultMatcher does, so IndexedManager should not
+// be combined with a different Matcher.
+//
+// Writes go to the decorated manager. Each write builds a new snapshot, which takes time proportional to the number of
+// policies, and publishes it atomically once the decorated manager accepted the change. Requests being evaluated keep
+// using the snapshot they started with. Changes made to the decorated manager directly, e.g. by another process
+// sharing the same database, are only picked up by Rebuild. Like with MemoryManager, policies must not be modified
+// after they have been passed to the manager.
+type IndexedManager struct {
+	Manager Manager
+
+	// snapshot holds the current *snapshot.
+	snapshot atomic.Value
+
+	// writes serializes writes and rebuilds.
+	writes sync.Mutex
+}
+
+// NewIndexedManager builds the index of all policies in m.
+func NewIndexedManager(m Manager) (*IndexedManager, error) {
+	im := &IndexedManager{Manager: m}
+	if err := im.Rebuild(); err != nil {
+		return nil, err
+	}
+	return im, nil
+}
+
+func (m *IndexedManager) current() *snapshot {
+	s, _ := m.snapshot.Load().(*snapshot)
+	return s
+}
+
+// Rebuild fetches all policies from the decorated manager and replaces the index.
+func (m *IndexedManager) Rebuild() error {
+	m.writes.Lock()
+	defer m.writes.Unlock()
+
+	var policies Policies
+	var seen = map[string]bool{}
+	for offset := int64(0); ; offset += rebuildPageSize {
+		ps, err := m.Manager.GetAll(rebuildPageSize, offset)
+		if err != nil {
+			return err
+		}
+
+		for _, p := range ps {
+			if !seen[p.GetID()] {
+				seen[p.GetID()] = true
+				policies = append(policies, p)
+			}
+		}
+
+		if len(ps) < rebuildPageSize {
+			break
+		}
+	}
+
+	s, err := newSnapshot(policies, m.current())
+	if err != nil {
+		return err
+	}
+
+	m.snapshot.Store(s)
+	return nil
+}
+
+// apply builds a snapshot in which the policy with the given id is replaced by policy, or removed if policy is nil,
+// and publishes it if write succeeds. A policy which can not be indexed is rejected before write is called.
+func (m *IndexedManager) apply(id string, policy Policy, write func() error) error {
+	m.writes.Lock()
+	defer m.writes.Unlock()
+
+	current := m.current()
+	policies := make(Policies, 0, len(current.policies)+1)
+	for _, p := range current.policies {
+		if p.GetID() != id {
+			policies = append(policies, p)
+		}
+	}
+	if policy != nil {
+		policies = append(policies, policy)
+	}
+
+	s, err := newSnapshot(policies, current)
+	if err != nil {
+		return err
+	}
+
+	if err := write(); err != nil {
+		return err
+	}
+
+	m.snapshot.Store(s)
+	return nil
+}
+
+// Create persists the policy.
+func (m *IndexedManager) Create(policy Policy) error {
+	return m.apply(policy.GetID(), policy, func() error {
+		return m.Manager.Create(policy)
+	})
+}
+
+// Update updates an existing policy.
+func (m *IndexedManager) Update(policy Policy) error {
+	return m.apply(policy.GetID(), policy, func() error {
+		return m.Manager.Update(policy)
+	})
+}
+
+// UpdateIfMatch updates an existing policy if its stored version equals version. The decorated manager must implement
+// VersionedManager.
+func (m *IndexedManager) UpdateIfMatch(policy Policy, version int64) error {
+	vm, ok := m.Manager.(VersionedManager)
+	if !ok {
+		return errors.Errorf("Manager %T does not support versions", m.Manager)
+	}
+
+	return m.apply(policy.GetID(), policy, func() error {
+		return vm.UpdateIfMatch(policy, version)
+	})
+}
+
+// Delete removes a policy.
+func (m *IndexedManager) Delete(id string) error {
+	return m.apply(id, nil, func() error {
+		return m.Manager.Delete(id)
+	})
+}
+
+// Get retrieves a policy.
+func (m *IndexedManager) Get(id string) (Policy, error) {
+	return m.Manager.Get(id)
+}
+
+// GetAll retrieves all policies.
+func (m *IndexedManager) GetAll(limit, offset int64) (Policies, error) {
+	return m.Manager.GetAll(limit, offset)
+}
+
+// ExpandSubject returns the additional names of the request's subject if the decorated manager implements
+// SubjectExpander.
+func (m *IndexedManager) ExpandSubject(r *Request) ([]string, error) {
+	if se, ok := m.Manager.(SubjectExpander); ok {
+		return se.ExpandSubject(r)
+	}
+	return nil, nil
+}
+
+// FindRequestCandidates returns the policies matching the request.
+func (m *IndexedManager) FindRequestCandidates(r *Request) (Policies, error) {
+	return m.FindRequestCandidatesContext(context.Background(), r)
+}
+
+// FindRequestCandidatesContext returns the policies matching the request.
+func (m *IndexedManager) FindRequestCandidatesContext(ctx context.Context, r *Request) (Policies, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	expanded, err := m.ExpandSubject(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return m.current().candidates(r, expanded), nil
+}
@@ -0,0 +1,164 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package index
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	. "github.com/ory/ladon"
+	"github.com/ory/ladon/manager/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func candidateIDs(t *testing.T, m Manager, r *Request) []string {
+	ps, err := m.FindRequestCandidates(r)
+	require.NoError(t, err)
+
+	ids := make([]string, len(ps))
+	for k, p := range ps {
+		ids[k] = p.GetID()
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// expectedIDs returns the policies DefaultMatcher considers to match the request.
+func expectedIDs(t *testing.T, policies []*DefaultPolicy, r *Request) []string {
+	ids := []string{}
+	for _, p := range policies {
+		matches := true
+		for _, f := range []struct {
+			haystack []string
+			needle   string
+		}{{p.Subjects, r.Subject}, {p.Actions, r.Action}, {p.Resources, r.Resource}} {
+			m, err := DefaultMatcher.Matches(p, f.haystack, f.needle)
+			require.NoError(t, err)
+			matches = matches && m
+		}
+		if matches {
+			ids = append(ids, p.ID)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func TestIndexedManagerFindRequestCandidates(t *testing.T) {
+	past, future := time.Now().Add(-time.Hour), time.Now().Add(time.Hour)
+	policies := []*DefaultPolicy{
+		{ID: "literal", Subjects: []string{"peter", "ken"}, Actions: []string{"get"}, Resources: []string{"articles:1"}},
+		{ID: "any-subject", Subjects: []string{"<.*>"}, Actions: []string{"get"}, Resources: []string{"articles:1"}},
+		{ID: "prefix", Subjects: []string{"peter"}, Actions: []string{"<get|update>"}, Resources: []string{"articles:<.*>"}},
+		{ID: "nested-prefix", Subjects: []string{"peter"}, Actions: []string{"get"}, Resources: []string{"articles:1<.*>"}},
+		{ID: "regexp", Subjects: []string{"users:<[a-z]+>"}, Actions: []string{"get"}, Resources: []string{"articles:<[0-9]+>:comments"}},
+		{ID: "no-subjects", Actions: []string{"get"}, Resources: []string{"articles:1"}},
+		{ID: "expired", Subjects: []string{"peter"}, Actions: []string{"get"}, Resources: []string{"articles:1"}, NotAfter: &past},
+		{ID: "pending", Subjects: []string{"peter"}, Actions: []string{"get"}, Resources: []string{"articles:1"}, NotBefore: &future},
+	}
+	for i := 0; i < 100; i++ {
+		policies = append(policies, &DefaultPolicy{
+			ID:        fmt.Sprintf("generated-%d", i),
+			Subjects:  []string{fmt.Sprintf("<group%d|role%d>", i, i%10), fmt.Sprintf("users:%d", i)},
+			Actions:   []string{"get"},
+			Resources: []string{fmt.Sprintf("articles:%d", i%7), fmt.Sprintf("<[a-z]+>:%d<[0-9]*>", i%5)},
+		})
+	}
+
+	m, err := NewIndexedManager(memory.NewMemoryManager())
+	require.NoError(t, err)
+	for _, p := range policies {
+		require.NoError(t, m.Create(p))
+	}
+
+	assert.Equal(t, []string{"any-subject", "expired", "literal", "nested-prefix", "pending", "prefix"}, candidateIDs(t, m, &Request{Subject: "peter", Action: "get", Resource: "articles:1"}))
+	assert.Equal(t, []string{"nested-prefix", "prefix"}, candidateIDs(t, m, &Request{Subject: "peter", Action: "get", Resource: "articles:12"}))
+	assert.Equal(t, []string{"regexp"}, candidateIDs(t, m, &Request{Subject: "users:max", Action: "get", Resource: "articles:12:comments"}))
+	assert.Empty(t, candidateIDs(t, m, &Request{Subject: "users:max", Action: "get", Resource: "articles::comments"}))
+
+	for _, r := range []*Request{
+		{Subject: "group3", Action: "get", Resource: "articles:3"},
+		{Subject: "role3", Action: "get", Resource: "articles:3"},
+		{Subject: "role3", Action: "get", Resource: "comments:3"},
+		{Subject: "role3", Action: "get", Resource: "comments:31"},
+		{Subject: "users:42", Action: "get", Resource: "comments:2"},
+		{Subject: "users:42", Action: "update", Resource: "comments:2"},
+		{Subject: "peter", Action: "update", Resource: "articles:"},
+		{Subject: "", Action: "", Resource: ""},
+	} {
+		assert.Equal(t, expectedIDs(t, policies, r), candidateIDs(t, m, r), "%+v", r)
+	}
+
+	require.NoError(t, m.Delete("any-subject"))
+	require.NoError(t, m.Update(&DefaultPolicy{ID: "literal", Subjects: []string{"max"}, Actions: []string{"get"}, Resources: []string{"articles:1"}}))
+	assert.Equal(t, []string{"expired", "nested-prefix", "pending", "prefix"}, candidateIDs(t, m, &Request{Subject: "peter", Action: "get", Resource: "articles:1"}))
+	assert.Equal(t, []string{"literal"}, candidateIDs(t, m, &Request{Subject: "max", Action: "get", Resource: "articles:1"}))
+}
+
+func TestIndexedManagerRejectsInvalidTemplates(t *testing.T) {
+	underlying := memory.NewMemoryManager()
+	m, err := NewIndexedManager(underlying)
+	require.NoError(t, err)
+
+	require.Error(t, m.Create(&DefaultPolicy{ID: "invalid", Subjects: []string{"<[>"}, Actions: []string{"get"}, Resources: []string{"articles"}}))
+	_, err = underlying.Get("invalid")
+	assert.Error(t, err)
+
+	require.NoError(t, underlying.Create(&DefaultPolicy{ID: "invalid", Subjects: []string{"<[>"}, Actions: []string{"get"}, Resources: []string{"articles"}}))
+	assert.Error(t, m.Rebuild())
+	_, err = NewIndexedManager(underlying)
+	assert.Error(t, err)
+}
+
+func TestIndexedManagerRebuild(t *testing.T) {
+	underlying := memory.NewMemoryManager()
+	require.NoError(t, underlying.Create(&DefaultPolicy{ID: "1", Subjects: []string{"peter"}, Actions: []string{"get"}, Resources: []string{"articles"}}))
+
+	m, err := NewIndexedManager(underlying)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1"}, candidateIDs(t, m, &Request{Subject: "peter", Action: "get", Resource: "articles"}))
+
+	require.NoError(t, underlying.Create(&DefaultPolicy{ID: "2", Subjects: []string{"<.*>"}, Actions: []string{"get"}, Resources: []string{"articles"}}))
+	assert.Equal(t, []string{"1"}, candidateIDs(t, m, &Request{Subject: "peter", Action: "get", Resource: "articles"}))
+
+	require.NoError(t, m.Rebuild())
+	assert.Equal(t, []string{"1", "2"}, candidateIDs(t, m, &Request{Subject: "peter", Action: "get", Resource: "articles"}))
+}
+
+type expandingManager struct {
+	*memory.MemoryManager
+}
+
+func (m *expandingManager) ExpandSubject(r *Request) ([]string, error) {
+	return []string{"admins"}, nil
+}
+
+func TestIndexedManagerExpandSubject(t *testing.T) {
+	m, err := NewIndexedManager(&expandingManager{MemoryManager: memory.NewMemoryManager()})
+	require.NoError(t, err)
+	require.NoError(t, m.Create(&DefaultPolicy{ID: "1", Subjects: []string{"admins"}, Actions: []string{"get"}, Resources: []string{"articles"}, Effect: AllowAccess}))
+
+	assert.Equal(t, []string{"1"}, candidateIDs(t, m, &Request{Subject: "peter", Action: "get", Resource: "articles"}))
+	assert.NoError(t, (&Ladon{Manager: m}).IsAllowed(&Request{Subject: "peter", Action: "get", Resource: "articles"}))
+}
@@ -0,0 +1,212 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package index
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	. "github.com/ory/ladon"
+	"github.com/ory/ladon/compiler"
+	"github.com/pkg/errors"
+)
+
+const (
+	subjects = iota
+	actions
+	resources
+)
+
+type patternKind int
+
+const (
+	literalPattern patternKind = iota
+	prefixPattern
+	regexpPattern
+)
+
+// pattern is a classified subject, action or resource of a policy.
+type pattern struct {
+	kind patternKind
+
+	// literal is the complete value of a literal pattern and the part in front of the first template otherwise.
+	literal string
+	re      *regexp.Regexp
+}
+
+func (p *pattern) matches(value string) bool {
+	switch p.kind {
+	case literalPattern:
+		return p.literal == value
+	case prefixPattern:
+		return strings.HasPrefix(value, p.literal)
+	default:
+		return p.re.MatchString(value)
+	}
+}
+
+// snapshot is an immutable index of a set of policies. Each of the policies' fields is indexed by a radix trie.
+type snapshot struct {
+	policies Policies
+	patterns [][3][]*pattern
+	fields   [3]*node
+
+	// compiled remembers the compiled templates, so they can be reused by the next snapshot.
+	compiled map[string]*regexp.Regexp
+}
+
+// newSnapshot indexes the policies. Templates found in previous are not compiled again.
+func newSnapshot(policies Policies, previous *snapshot) (*snapshot, error) {
+	policies = append(Policies{}, policies...)
+	sort.Slice(policies, func(i, j int) bool { return policies[i].GetID() < policies[j].GetID() })
+
+	s := &snapshot{
+		policies: policies,
+		patterns: make([][3][]*pattern, len(policies)),
+		fields:   [3]*node{{}, {}, {}},
+		compiled: map[string]*regexp.Regexp{},
+	}
+
+	for id, p := range policies {
+		for field, values := range [3][]string{p.GetSubjects(), p.GetActions(), p.GetResources()} {
+			for _, v := range values {
+				pt, err := s.classify(p, v, previous)
+				if err != nil {
+					return nil, err
+				}
+				s.patterns[id][field] = append(s.patterns[id][field], pt)
+
+				n := s.fields[field].insert(pt.literal)
+				switch pt.kind {
+				case literalPattern:
+					n.exact = append(n.exact, id)
+				case prefixPattern:
+					n.prefix = append(n.prefix, id)
+				default:
+					n.addRegexp(pt.re, id)
+				}
+			}
+		}
+	}
+
+	for _, n := range s.fields {
+		n.freeze()
+	}
+	return s, nil
+}
+
+// classify turns a value into a literal pattern if it contains no template, into a prefix pattern if it ends with
+// the only template and that template matches anything, and into a regular expression otherwise.
+func (s *snapshot) classify(p Policy, value string, previous *snapshot) (*pattern, error) {
+	start, end := p.GetStartDelimiter(), p.GetEndDelimiter()
+	i := strings.IndexByte(value, start)
+	if i < 0 {
+		return &pattern{kind: literalPattern, literal: value}, nil
+	}
+
+	if value[i:] == string(start)+".*"+string(end) {
+		return &pattern{kind: prefixPattern, literal: value[:i]}, nil
+	}
+
+	key := string([]byte{start, end}) + value
+	re, ok := s.compiled[key]
+	if !ok && previous != nil {
+		re, ok = previous.compiled[key]
+	}
+	if !ok {
+		var err error
+		if re, err = compiler.CompileRegex(value, start, end); err != nil {
+			return nil, errors.Wrapf(err, "Policy %s has invalid template %q", p.GetID(), value)
+		}
+	}
+	s.compiled[key] = re
+
+	return &pattern{kind: regexpPattern, literal: value[:i], re: re}, nil
+}
+
+// matches returns true if one of the values matches one of the patterns of the policy's field.
+func (s *snapshot) matches(id, field int, values []string) bool {
+	for _, pt := range s.patterns[id][field] {
+		for _, v := range values {
+			if pt.matches(v) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// candidates returns the policies whose subjects, actions and resources match the request. Subjects match if they
+// match the request's subject or one of the expanded subjects. Their validity period is left to the warden.
+//
+// All three tries are searched first, which is cheap as only the nodes on the path of the requested value are
+// visited. The policies found for the field with the fewest hits are then checked against the other two fields.
+func (s *snapshot) candidates(r *Request, expanded []string) Policies {
+	values := [3][]string{append([]string{r.Subject}, expanded...), {r.Action}, {r.Resource}}
+
+	var hits [3][][]int
+	var sizes [3]int
+	for field := range values {
+		for _, v := range values[field] {
+			hits[field] = s.fields[field].lookup(v, hits[field])
+		}
+		for _, ids := range hits[field] {
+			sizes[field] += len(ids)
+		}
+	}
+
+	smallest := subjects
+	for field := range sizes {
+		if sizes[field] < sizes[smallest] {
+			smallest = field
+		}
+	}
+
+	seen := map[int]bool{}
+	var found []int
+	for _, ids := range hits[smallest] {
+		for _, id := range ids {
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+
+			matches := true
+			for field := range values {
+				if field != smallest && !s.matches(id, field, values[field]) {
+					matches = false
+					break
+				}
+			}
+			if matches {
+				found = append(found, id)
+			}
+		}
+	}
+
+	sort.Ints(found)
+	ps := make(Policies, len(found))
+	for k, id := range found {
+		ps[k] = s.policies[id]
+	}
+	return ps
+}
@@ -0,0 +1,179 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package index
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// regexpGroupSize is the number of templates combined into a single automaton. A request value is only matched against
+// the individual templates of a group if the combined automaton matches it.
+const regexpGroupSize = 32
+
+// node is a node of a radix trie. The key of a node is the concatenation of the labels on the path from the root.
+type node struct {
+	label    string
+	children []*node
+
+	// exact contains the policies having the node's key as literal value.
+	exact []int
+
+	// prefix contains the policies having a template which matches any value starting with the node's key.
+	prefix []int
+
+	// regexps contains the policies having a template whose literal prefix is the node's key. They are collected in
+	// pending while the trie is built and combined into groups by freeze.
+	regexps []*regexpGroup
+	pending map[*regexp.Regexp][]int
+}
+
+// regexpGroup combines up to regexpGroupSize templates into one automaton.
+type regexpGroup struct {
+	combined *regexp.Regexp
+	patterns []*regexp.Regexp
+	ids      [][]int
+}
+
+// child returns the position the child starting with c has, or should have, and the child if it exists.
+func (n *node) child(c byte) (int, *node) {
+	i := sort.Search(len(n.children), func(i int) bool { return n.children[i].label[0] >= c })
+	if i < len(n.children) && n.children[i].label[0] == c {
+		return i, n.children[i]
+	}
+	return i, nil
+}
+
+// insert returns the node for key, creating it and splitting edges as necessary.
+func (n *node) insert(key string) *node {
+	for key != "" {
+		i, c := n.child(key[0])
+		if c == nil {
+			c = &node{label: key}
+			n.children = append(n.children, nil)
+			copy(n.children[i+1:], n.children[i:])
+			n.children[i] = c
+			return c
+		}
+
+		l := commonPrefix(key, c.label)
+		if l < len(c.label) {
+			split := &node{label: c.label[:l], children: []*node{c}}
+			c.label = c.label[l:]
+			n.children[i] = split
+			c = split
+		}
+
+		n, key = c, key[l:]
+	}
+	return n
+}
+
+func (n *node) addRegexp(re *regexp.Regexp, id int) {
+	if n.pending == nil {
+		n.pending = map[*regexp.Regexp][]int{}
+	}
+	n.pending[re] = append(n.pending[re], id)
+}
+
+// freeze combines the pending templates of this node and all of its descendants into groups.
+func (n *node) freeze() {
+	if len(n.pending) > 0 {
+		patterns := make([]*regexp.Regexp, 0, len(n.pending))
+		for re := range n.pending {
+			patterns = append(patterns, re)
+		}
+		sort.Slice(patterns, func(i, j int) bool { return patterns[i].String() < patterns[j].String() })
+
+		for start := 0; start < len(patterns); start += regexpGroupSize {
+			end := start + regexpGroupSize
+			if end > len(patterns) {
+				end = len(patterns)
+			}
+
+			g := &regexpGroup{patterns: patterns[start:end]}
+			sources := make([]string, len(g.patterns))
+			for k, re := range g.patterns {
+				g.ids = append(g.ids, n.pending[re])
+				sources[k] = "(?:" + re.String() + ")"
+			}
+
+			// If the templates can not be combined, they are matched one by one.
+			if len(g.patterns) > 1 {
+				g.combined, _ = regexp.Compile(strings.Join(sources, "|"))
+			}
+			n.regexps = append(n.regexps, g)
+		}
+	}
+	n.pending = nil
+
+	for _, c := range n.children {
+		c.freeze()
+	}
+}
+
+// lookup appends the policies matching value to hits. Only nodes whose keys are prefixes of value are visited.
+func (n *node) lookup(value string, hits [][]int) [][]int {
+	rest := value
+	for {
+		if len(n.prefix) > 0 {
+			hits = append(hits, n.prefix)
+		}
+		for _, g := range n.regexps {
+			hits = g.lookup(value, hits)
+		}
+
+		if rest == "" {
+			if len(n.exact) > 0 {
+				hits = append(hits, n.exact)
+			}
+			return hits
+		}
+
+		_, c := n.child(rest[0])
+		if c == nil || !strings.HasPrefix(rest, c.label) {
+			return hits
+		}
+		n, rest = c, rest[len(c.label):]
+	}
+}
+
+func (g *regexpGroup) lookup(value string, hits [][]int) [][]int {
+	if g.combined != nil && !g.combined.MatchString(value) {
+		return hits
+	}
+
+	for k, re := range g.patterns {
+		if re.MatchString(value) {
+			hits = append(hits, g.ids[k])
+		}
+	}
+	return hits
+}
+
+func commonPrefix(a, b string) int {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return i
+}
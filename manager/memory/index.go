@@ -0,0 +1,160 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package memory
+
+import (
+	. "github.com/ory/ladon"
+)
+
+// fieldIndex maps the literal values of one policy field (subjects, actions or resources) to the IDs of the
+// policies containing them. Policies which contain a template in that field could match any value and are
+// kept in a separate bucket.
+type fieldIndex struct {
+	literal   map[string]map[string]bool
+	templated map[string]bool
+
+	// keys remembers the literal values a policy was indexed with, so it can be removed even if the policy
+	// was modified in the meantime.
+	keys map[string][]string
+}
+
+func newFieldIndex() *fieldIndex {
+	return &fieldIndex{
+		literal:   map[string]map[string]bool{},
+		templated: map[string]bool{},
+		keys:      map[string][]string{},
+	}
+}
+
+func (i *fieldIndex) add(id string, values []string, delimiter byte) {
+	for _, v := range values {
+		// Values containing glob wildcards are treated as templates as well, so GlobMatcher can be used.
+		if IsTemplated(v, delimiter) {
+			i.templated[id] = true
+			continue
+		}
+
+		if _, ok := i.literal[v]; !ok {
+			i.literal[v] = map[string]bool{}
+		}
+		i.literal[v][id] = true
+		i.keys[id] = append(i.keys[id], v)
+	}
+}
+
+func (i *fieldIndex) remove(id string) {
+	for _, v := range i.keys[id] {
+		delete(i.literal[v], id)
+		if len(i.literal[v]) == 0 {
+			delete(i.literal, v)
+		}
+	}
+	delete(i.keys, id)
+	delete(i.templated, id)
+}
+
+// size returns the number of candidates for value.
+func (i *fieldIndex) size(value string) int {
+	return len(i.literal[value]) + len(i.templated)
+}
+
+// contains returns true if the policy is a candidate for value.
+func (i *fieldIndex) contains(id, value string) bool {
+	return i.templated[id] || i.literal[value][id]
+}
+
+// each calls f with the ID of every candidate for value. A policy might be passed twice if it contains
+// both, the literal value and a template.
+func (i *fieldIndex) each(value string, f func(id string)) {
+	for id := range i.literal[value] {
+		f(id)
+	}
+	for id := range i.templated {
+		f(id)
+	}
+}
+
+// policyIndex indexes policies by subject, action and resource.
+type policyIndex struct {
+	subjects  *fieldIndex
+	actions   *fieldIndex
+	resources *fieldIndex
+}
+
+func newPolicyIndex() *policyIndex {
+	return &policyIndex{
+		subjects:  newFieldIndex(),
+		actions:   newFieldIndex(),
+		resources: newFieldIndex(),
+	}
+}
+
+func (i *policyIndex) add(p Policy) {
+	i.subjects.add(p.GetID(), p.GetSubjects(), p.GetStartDelimiter())
+	i.actions.add(p.GetID(), p.GetActions(), p.GetStartDelimiter())
+	i.resources.add(p.GetID(), p.GetResources(), p.GetStartDelimiter())
+}
+
+func (i *policyIndex) remove(id string) {
+	i.subjects.remove(id)
+	i.actions.remove(id)
+	i.resources.remove(id)
+}
+
+// candidates returns the IDs of all policies that could match the request. The smallest of the three
+// candidate sets is iterated and checked against the other two.
+func (i *policyIndex) candidates(r *Request) []string {
+	type field struct {
+		index *fieldIndex
+		value string
+	}
+
+	fields := []field{
+		{index: i.subjects, value: r.Subject},
+		{index: i.actions, value: r.Action},
+		{index: i.resources, value: r.Resource},
+	}
+
+	smallest := 0
+	for k := range fields {
+		if fields[k].index.size(fields[k].value) < fields[smallest].index.size(fields[smallest].value) {
+			smallest = k
+		}
+	}
+
+	var ids []string
+	var seen = map[string]bool{}
+	fields[smallest].index.each(fields[smallest].value, func(id string) {
+		if seen[id] {
+			return
+		}
+		seen[id] = true
+
+		for k, f := range fields {
+			if k != smallest && !f.index.contains(id, f.value) {
+				return
+			}
+		}
+		ids = append(ids, id)
+	})
+
+	return ids
+}
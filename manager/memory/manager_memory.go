@@ -21,6 +21,7 @@
 package memory
 
 import (
+	"sort"
 	"sync"
 
 	. "github.com/ory/ladon"
@@ -29,28 +30,119 @@ import (
 )
 
 // MemoryManager is an in-memory (non-persistent) implementation of Manager.
+//
+// Policies are indexed by their literal subjects, actions and resources. Policies must therefore only be
+// modified through the manager, changes made to Policies directly are not picked up by FindRequestCandidates.
 type MemoryManager struct {
 	Policies map[string]Policy
 	sync.RWMutex
+
+	index    *policyIndex
+	versions map[string]int64
+	watches  map[*watch]bool
 }
 
 // NewMemoryManager constructs and initializes new MemoryManager with no policies.
 func NewMemoryManager() *MemoryManager {
 	return &MemoryManager{
 		Policies: map[string]Policy{},
+		index:    newPolicyIndex(),
+	}
+}
+
+// indexPolicy (re-)indexes a policy. The write lock must be held.
+func (m *MemoryManager) indexPolicy(policy Policy) {
+	if m.index == nil {
+		// The manager was not created using NewMemoryManager, index what we've got.
+		m.index = newPolicyIndex()
+		for _, p := range m.Policies {
+			m.index.add(p)
+		}
 	}
+
+	m.index.remove(policy.GetID())
+	m.index.add(policy)
 }
 
-// Update updates an existing policy.
+// setVersion stores the version of a policy and returns the policy to store. A DefaultPolicy is copied and the
+// copy's Version is set, so that the caller's policy is left untouched. The write lock must be held.
+func (m *MemoryManager) setVersion(policy Policy, version int64) Policy {
+	if m.versions == nil {
+		m.versions = map[string]int64{}
+	}
+
+	m.versions[policy.GetID()] = version
+	if p, ok := policy.(*DefaultPolicy); ok {
+		c := *p
+		c.Version = version
+		return &c
+	}
+	return policy
+}
+
+// version returns the stored version of a policy. Policies which were added to Policies directly are at version 1.
+// The read lock must be held.
+func (m *MemoryManager) version(id string) int64 {
+	if v, ok := m.versions[id]; ok {
+		return v
+	}
+	return 1
+}
+
+// Update updates an existing policy and increases its version.
 func (m *MemoryManager) Update(policy Policy) error {
 	m.Lock()
 	defer m.Unlock()
+	m.update(policy)
+	return nil
+}
+
+// CreateOrUpdate creates the policies which do not exist yet and updates the others at once.
+func (m *MemoryManager) CreateOrUpdate(policies Policies) error {
+	m.Lock()
+	defer m.Unlock()
+	for _, p := range policies {
+		m.update(p)
+	}
+	return nil
+}
+
+// update creates or updates a policy. The write lock must be held.
+func (m *MemoryManager) update(policy Policy) {
+	version, event := int64(1), PolicyCreated
+	if _, found := m.Policies[policy.GetID()]; found {
+		version, event = m.version(policy.GetID())+1, PolicyUpdated
+	}
+
+	policy = m.setVersion(policy, version)
+	m.Policies[policy.GetID()] = policy
+	m.indexPolicy(policy)
+	m.publish(event, policy.GetID(), policy)
+}
+
+// UpdateIfMatch updates an existing policy, but only if its stored version equals version. Otherwise ErrConflict is
+// returned.
+func (m *MemoryManager) UpdateIfMatch(policy Policy, version int64) error {
+	m.Lock()
+	defer m.Unlock()
+
+	if _, found := m.Policies[policy.GetID()]; !found {
+		return NewErrResourceNotFound(errors.New("Not found"))
+	} else if current := m.version(policy.GetID()); current != version {
+		return errors.WithStack(ErrConflict)
+	}
+
+	policy = m.setVersion(policy, version+1)
 	m.Policies[policy.GetID()] = policy
+	m.indexPolicy(policy)
+	m.publish(PolicyUpdated, policy.GetID(), policy)
 	return nil
 }
 
-// GetAll returns all policies.
+// GetAll returns all policies ordered by their ID, so that paging through them is stable.
 func (m *MemoryManager) GetAll(limit, offset int64) (Policies, error) {
+	m.RLock()
+	defer m.RUnlock()
 	ps := make(Policies, len(m.Policies))
 	i := 0
 
@@ -58,6 +150,7 @@ func (m *MemoryManager) GetAll(limit, offset int64) (Policies, error) {
 		ps[i] = p
 		i++
 	}
+	sort.Slice(ps, func(i, j int) bool { return ps[i].GetID() < ps[j].GetID() })
 
 	start, end := pagination.Index(int(limit), int(offset), len(ps))
 	return ps[start:end], nil
@@ -72,7 +165,10 @@ func (m *MemoryManager) Create(policy Policy) error {
 		return errors.New("Policy exists")
 	}
 
+	policy = m.setVersion(policy, 1)
 	m.Policies[policy.GetID()] = policy
+	m.indexPolicy(policy)
+	m.publish(PolicyCreated, policy.GetID(), policy)
 	return nil
 }
 
@@ -82,7 +178,7 @@ func (m *MemoryManager) Get(id string) (Policy, error) {
 	defer m.RUnlock()
 	p, ok := m.Policies[id]
 	if !ok {
-		return nil, errors.New("Not found")
+		return nil, NewErrResourceNotFound(errors.New("Not found"))
 	}
 
 	return p, nil
@@ -92,21 +188,41 @@ func (m *MemoryManager) Get(id string) (Policy, error) {
 func (m *MemoryManager) Delete(id string) error {
 	m.Lock()
 	defer m.Unlock()
+	if _, found := m.Policies[id]; found {
+		m.publish(PolicyDeleted, id, nil)
+	}
+
 	delete(m.Policies, id)
+	delete(m.versions, id)
+	if m.index != nil {
+		m.index.remove(id)
+	}
 	return nil
 }
 
 // FindRequestCandidates returns candidates that could match the request object. It either returns
 // a set that exactly matches the request, or a superset of it. If an error occurs, it returns nil and
 // the error.
+//
+// Only policies whose subjects, actions and resources each either contain the requested value or a template
+// are returned. Policies outside of their validity period (see ladon.ValidityPolicy) are returned as well, the warden
+// decides about them using its own clock.
 func (m *MemoryManager) FindRequestCandidates(r *Request) (Policies, error) {
 	m.RLock()
 	defer m.RUnlock()
-	ps := make(Policies, len(m.Policies))
-	var count int
+
+	if m.index != nil {
+		ids := m.index.candidates(r)
+		ps := make(Policies, 0, len(ids))
+		for _, id := range ids {
+			ps = append(ps, m.Policies[id])
+		}
+		return ps, nil
+	}
+
+	ps := make(Policies, 0, len(m.Policies))
 	for _, p := range m.Policies {
-		ps[count] = p
-		count++
+		ps = append(ps, p)
 	}
 	return ps, nil
 }
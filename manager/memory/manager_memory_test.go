@@ -0,0 +1,97 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package memory
+
+import (
+	"sort"
+	"testing"
+
+	. "github.com/ory/ladon"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func candidateIDs(t *testing.T, m *MemoryManager, r *Request) []string {
+	ps, err := m.FindRequestCandidates(r)
+	require.NoError(t, err)
+
+	ids := make([]string, len(ps))
+	for k, p := range ps {
+		ids[k] = p.GetID()
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func TestFindRequestCandidates(t *testing.T) {
+	m := NewMemoryManager()
+	for _, p := range []*DefaultPolicy{
+		{ID: "literal", Subjects: []string{"peter", "ken"}, Actions: []string{"get"}, Resources: []string{"articles:1"}},
+		{ID: "any-subject", Subjects: []string{"<.*>"}, Actions: []string{"get"}, Resources: []string{"articles:1"}},
+		{ID: "any-resource", Subjects: []string{"peter"}, Actions: []string{"<get|update>"}, Resources: []string{"articles:<.*>"}},
+		{ID: "no-subjects", Actions: []string{"get"}, Resources: []string{"articles:1"}},
+		{ID: "mixed", Subjects: []string{"ken", "<zac|ken>"}, Actions: []string{"get"}, Resources: []string{"articles:1"}},
+	} {
+		require.NoError(t, m.Create(p))
+	}
+
+	assert.Equal(t, []string{"any-resource", "any-subject", "literal", "mixed"}, candidateIDs(t, m, &Request{Subject: "peter", Action: "get", Resource: "articles:1"}))
+	assert.Equal(t, []string{"any-subject", "literal", "mixed"}, candidateIDs(t, m, &Request{Subject: "ken", Action: "get", Resource: "articles:1"}))
+	assert.Equal(t, []string{"any-resource"}, candidateIDs(t, m, &Request{Subject: "peter", Action: "update", Resource: "articles:2"}))
+	assert.Equal(t, []string{"any-resource"}, candidateIDs(t, m, &Request{Subject: "peter", Action: "delete", Resource: "articles:1"}))
+	assert.Empty(t, candidateIDs(t, m, &Request{Subject: "max", Action: "delete", Resource: "articles:1"}))
+
+	require.NoError(t, m.Update(&DefaultPolicy{ID: "literal", Subjects: []string{"max"}, Actions: []string{"get"}, Resources: []string{"articles:1"}}))
+	assert.Equal(t, []string{"any-resource", "any-subject", "mixed"}, candidateIDs(t, m, &Request{Subject: "peter", Action: "get", Resource: "articles:1"}))
+	assert.Equal(t, []string{"any-subject", "literal", "mixed"}, candidateIDs(t, m, &Request{Subject: "max", Action: "get", Resource: "articles:1"}))
+
+	require.NoError(t, m.Delete("any-subject"))
+	require.NoError(t, m.Delete("mixed"))
+	assert.Equal(t, []string{"literal"}, candidateIDs(t, m, &Request{Subject: "max", Action: "get", Resource: "articles:1"}))
+
+	require.NoError(t, m.Create(&DefaultPolicy{ID: "glob", Subjects: []string{"users:*"}, Actions: []string{"get"}, Resources: []string{"articles:?"}}))
+	assert.Equal(t, []string{"glob"}, candidateIDs(t, m, &Request{Subject: "users:max", Action: "get", Resource: "articles:2"}))
+}
+
+func TestFindRequestCandidatesWithoutConstructor(t *testing.T) {
+	m := &MemoryManager{Policies: map[string]Policy{
+		"literal": &DefaultPolicy{ID: "literal", Subjects: []string{"peter"}, Actions: []string{"get"}, Resources: []string{"articles:1"}},
+	}}
+
+	assert.Equal(t, []string{"literal"}, candidateIDs(t, m, &Request{Subject: "max", Action: "get", Resource: "articles:1"}))
+
+	require.NoError(t, m.Create(&DefaultPolicy{ID: "other", Subjects: []string{"max"}, Actions: []string{"get"}, Resources: []string{"articles:1"}}))
+	assert.Equal(t, []string{"other"}, candidateIDs(t, m, &Request{Subject: "max", Action: "get", Resource: "articles:1"}))
+}
+
+func TestVersionsAreNotWrittenToCallers(t *testing.T) {
+	m := NewMemoryManager()
+	p := &DefaultPolicy{ID: "articles", Subjects: []string{"peter"}}
+	require.NoError(t, m.Create(p))
+	require.NoError(t, m.Update(p))
+	require.NoError(t, m.UpdateIfMatch(p, 2))
+	assert.EqualValues(t, 0, p.Version)
+
+	stored, err := m.Get("articles")
+	require.NoError(t, err)
+	assert.EqualValues(t, 3, stored.(*DefaultPolicy).Version)
+	assert.False(t, stored == Policy(p))
+}
@@ -0,0 +1,105 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package memory
+
+import (
+	"context"
+	"sync"
+
+	. "github.com/ory/ladon"
+)
+
+// watch queues the events of a single Watch call, so that writes never wait for a slow consumer.
+type watch struct {
+	sync.Mutex
+	queue  []PolicyEvent
+	notify chan struct{}
+}
+
+func newWatch() *watch {
+	return &watch{notify: make(chan struct{}, 1)}
+}
+
+func (w *watch) push(e PolicyEvent) {
+	w.Lock()
+	w.queue = append(w.queue, e)
+	w.Unlock()
+
+	select {
+	case w.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (w *watch) take() []PolicyEvent {
+	w.Lock()
+	defer w.Unlock()
+	queue := w.queue
+	w.queue = nil
+	return queue
+}
+
+// publish sends an event to all watches. The write lock must be held, so that events are queued in the order the
+// changes were made.
+func (m *MemoryManager) publish(t PolicyEventType, id string, policy Policy) {
+	for w := range m.watches {
+		w.push(PolicyEvent{Type: t, ID: id, Policy: policy})
+	}
+}
+
+// Watch returns a channel which receives an event for every change made after Watch returned. Events are queued in
+// memory until they are consumed. The channel is closed once ctx is done. The error is always nil.
+func (m *MemoryManager) Watch(ctx context.Context) (<-chan PolicyEvent, error) {
+	w := newWatch()
+	m.Lock()
+	if m.watches == nil {
+		m.watches = map[*watch]bool{}
+	}
+	m.watches[w] = true
+	m.Unlock()
+
+	events := make(chan PolicyEvent)
+	go func() {
+		defer close(events)
+		defer func() {
+			m.Lock()
+			delete(m.watches, w)
+			m.Unlock()
+		}()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-w.notify:
+			}
+
+			for _, e := range w.take() {
+				select {
+				case events <- e:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return events, nil
+}
@@ -1,27 +1,79 @@
 package rbac
 
 import (
+	"context"
+
 	"github.com/ory/ladon"
 	"github.com/ory/ladon/manager/memory"
+	"github.com/ory/ladon/manager/rbac/role"
 )
 
+// DefaultRolePrefix is the prefix which identifies roles in a policy's subjects, e.g. "role:admin".
+const DefaultRolePrefix = "role:"
+
+// DefaultDomainKey is the request context key which holds the domain a subject's roles are looked up in.
+const DefaultDomainKey = "domain"
+
 // RbacManager is base on rbac manage, an persistent(pre loading in-memory) implementation of Manager.
+//
+// RbacManager implements ladon.SubjectExpander: a request's subject is expanded to all roles it transitively
+// inherits in the RuleManager, so that policies may grant access to roles by naming them in their subjects,
+// prefixed with RolePrefix.
 type RbacManager struct {
 	memory *memory.MemoryManager
+	rules  *role.RuleManager
+
+	// RolePrefix is prepended to role names when they are matched against a policy's subjects.
+	// Defaults to DefaultRolePrefix.
+	RolePrefix string
+
+	// DomainKey is the request context key of the domain roles are looked up in. If the request's context
+	// does not contain a string value for this key, roles are looked up without a domain.
+	// Defaults to DefaultDomainKey.
+	DomainKey string
 }
 
-// NewRbacManager constructs and initializes new RbacManager with no policies.
-func NewRbacManager() *RbacManager {
+// NewRbacManager constructs and initializes new RbacManager with no policies. If rules is nil, an empty
+// RuleManager is used.
+func NewRbacManager(rules *role.RuleManager) *RbacManager {
+	if rules == nil {
+		rules = role.NewRuleManager()
+	}
+
 	return &RbacManager{
-		memory: memory.NewMemoryManager(),
+		memory:     memory.NewMemoryManager(),
+		rules:      rules,
+		RolePrefix: DefaultRolePrefix,
+		DomainKey:  DefaultDomainKey,
 	}
 }
 
+// RuleManager returns the RuleManager which holds the role assignments.
+func (m *RbacManager) RuleManager() *role.RuleManager {
+	return m.rules
+}
+
 // Update updates an existing policy.
 func (m *RbacManager) Update(policy ladon.Policy) error {
 	return m.memory.Update(policy)
 }
 
+// UpdateIfMatch updates an existing policy, but only if its stored version equals version.
+func (m *RbacManager) UpdateIfMatch(policy ladon.Policy, version int64) error {
+	return m.memory.UpdateIfMatch(policy, version)
+}
+
+// Watch returns a channel which receives an event for every change of the policies made after Watch returned. Changes
+// of the role assignments are not reported.
+func (m *RbacManager) Watch(ctx context.Context) (<-chan ladon.PolicyEvent, error) {
+	return m.memory.Watch(ctx)
+}
+
+// CreateOrUpdate creates the policies which do not exist yet and updates the others at once.
+func (m *RbacManager) CreateOrUpdate(policies ladon.Policies) error {
+	return m.memory.CreateOrUpdate(policies)
+}
+
 // GetAll returns all policies.
 func (m *RbacManager) GetAll(limit, offset int64) (ladon.Policies, error) {
 	return m.memory.GetAll(limit, offset)
@@ -39,12 +91,59 @@ func (m *RbacManager) Get(id string) (ladon.Policy, error) {
 
 // Delete removes a policy.
 func (m *RbacManager) Delete(id string) error {
-	return m.Delete(id)
+	return m.memory.Delete(id)
 }
 
 // FindRequestCandidates returns candidates that could match the request object. It either returns
 // a set that exactly matches the request, or a superset of it. If an error occurs, it returns nil and
 // the error.
+//
+// Candidates are looked up for the request's subject as well as for each of its roles.
 func (m *RbacManager) FindRequestCandidates(r *ladon.Request) (ladon.Policies, error) {
-	return m.FindRequestCandidates(r)
+	return m.FindRequestCandidatesContext(context.Background(), r)
+}
+
+// FindRequestCandidatesContext is like FindRequestCandidates, but stops looking up candidates once ctx is done.
+func (m *RbacManager) FindRequestCandidatesContext(ctx context.Context, r *ladon.Request) (ladon.Policies, error) {
+	subjects, err := m.ExpandSubject(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var seen = map[string]bool{}
+	var candidates = ladon.Policies{}
+	for _, subject := range append([]string{r.Subject}, subjects...) {
+		req := *r
+		req.Subject = subject
+
+		policies, err := ladon.NewContextManager(m.memory).FindRequestCandidatesContext(ctx, &req)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, p := range policies {
+			if !seen[p.GetID()] {
+				seen[p.GetID()] = true
+				candidates = append(candidates, p)
+			}
+		}
+	}
+
+	return candidates, nil
+}
+
+// ExpandSubject returns the roles the request's subject transitively inherits, each prefixed with RolePrefix.
+func (m *RbacManager) ExpandSubject(r *ladon.Request) ([]string, error) {
+	var roles []string
+	if domain, ok := r.Context[m.DomainKey].(string); ok && domain != "" {
+		roles = m.rules.GetImplicitRolesForUserInDomain(r.Subject, domain)
+	} else {
+		roles = m.rules.GetImplicitRolesForUser(r.Subject)
+	}
+
+	subjects := make([]string, len(roles))
+	for i, name := range roles {
+		subjects[i] = m.RolePrefix + name
+	}
+	return subjects, nil
 }
@@ -0,0 +1,67 @@
+package rbac
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ory/ladon"
+	"github.com/ory/ladon/manager/rbac/role"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRbacManager(t *testing.T) {
+	rules := role.NewRuleManager()
+	rules.AddRoleForUserInDomain("peter", "editor", "blog")
+	rules.AddRoleForUserInDomain("editor", "reader", "blog")
+	rules.AddRoleForUserInDomain("ken", "reader", "blog")
+
+	m := NewRbacManager(rules)
+	warden := &ladon.Ladon{Manager: m}
+
+	require.NoError(t, m.Create(&ladon.DefaultPolicy{
+		ID:        "readers",
+		Subjects:  []string{"role:reader"},
+		Resources: []string{"articles:<.*>"},
+		Actions:   []string{"get"},
+		Effect:    ladon.AllowAccess,
+	}))
+	require.NoError(t, m.Create(&ladon.DefaultPolicy{
+		ID:        "editors",
+		Subjects:  []string{"role:editor"},
+		Resources: []string{"articles:<.*>"},
+		Actions:   []string{"update"},
+		Effect:    ladon.AllowAccess,
+	}))
+
+	for k, c := range []struct {
+		r       *ladon.Request
+		allowed bool
+	}{
+		{r: &ladon.Request{Subject: "peter", Action: "get", Resource: "articles:1", Context: ladon.Context{"domain": "blog"}}, allowed: true},
+		{r: &ladon.Request{Subject: "peter", Action: "update", Resource: "articles:1", Context: ladon.Context{"domain": "blog"}}, allowed: true},
+		{r: &ladon.Request{Subject: "ken", Action: "get", Resource: "articles:1", Context: ladon.Context{"domain": "blog"}}, allowed: true},
+		{r: &ladon.Request{Subject: "ken", Action: "update", Resource: "articles:1", Context: ladon.Context{"domain": "blog"}}, allowed: false},
+		{r: &ladon.Request{Subject: "peter", Action: "get", Resource: "articles:1", Context: ladon.Context{"domain": "shop"}}, allowed: false},
+		{r: &ladon.Request{Subject: "peter", Action: "get", Resource: "articles:1"}, allowed: false},
+	} {
+		err := warden.IsAllowed(c.r)
+		assert.Equal(t, c.allowed, err == nil, "case %d: %v", k, err)
+	}
+
+	subjects, err := m.ExpandSubject(&ladon.Request{Subject: "peter", Context: ladon.Context{"domain": "blog"}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"role:editor", "role:reader"}, subjects)
+
+	var _ ladon.ContextManager = m
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = m.FindRequestCandidatesContext(ctx, &ladon.Request{Subject: "peter", Action: "get", Resource: "articles:1"})
+	assert.Equal(t, context.Canceled, errors.Cause(err))
+	assert.Error(t, warden.IsAllowedContext(ctx, &ladon.Request{Subject: "peter", Action: "get", Resource: "articles:1", Context: ladon.Context{"domain": "blog"}}))
+
+	require.NoError(t, m.Delete("editors"))
+	_, err = m.Get("editors")
+	assert.Error(t, err)
+}
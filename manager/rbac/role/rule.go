@@ -16,6 +16,11 @@ type RuleManager struct {
 	autobuildRoleLinks bool
 }
 
+// NewRuleManager creates a RuleManager. If a *gorm.DB is passed, rules are persisted through it.
+func NewRuleManager(params ...interface{}) *RuleManager {
+	return newRuleManager(params...)
+}
+
 func newRuleManager(params ...interface{}) *RuleManager {
 	m := &RuleManager{
 		rules:              newModel(),
@@ -151,6 +156,40 @@ func (m *RuleManager) GetRolesForUser(name string) []string {
 	return res
 }
 
+// GetImplicitRolesForUserInDomain gets the roles that a user has inside a domain, including the roles
+// that are inherited through other roles.
+func (m *RuleManager) GetImplicitRolesForUserInDomain(name string, domain string) []string {
+	return getImplicitRoles(name, func(name string) []string {
+		return m.GetRolesForUserInDomain(name, domain)
+	})
+}
+
+// GetImplicitRolesForUser gets the roles that a user has, including the roles that are inherited through other roles.
+func (m *RuleManager) GetImplicitRolesForUser(name string) []string {
+	return getImplicitRoles(name, m.GetRolesForUser)
+}
+
+// getImplicitRoles walks the role hierarchy breadth first, starting at name.
+func getImplicitRoles(name string, direct func(string) []string) []string {
+	roles := []string{}
+	seen := map[string]bool{name: true}
+	queue := []string{name}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+
+		for _, r := range direct(current) {
+			if !seen[r] {
+				seen[r] = true
+				roles = append(roles, r)
+				queue = append(queue, r)
+			}
+		}
+	}
+
+	return roles
+}
+
 // GetUsersForRoleInDomain gets the users that has a role.
 func (m *RuleManager) GetUsersForRoleInDomain(name, domain string) []string {
 	res, _ := m.rules["g"]["g"].RM.GetUsers(name, domain)
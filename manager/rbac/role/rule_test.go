@@ -2,6 +2,7 @@ package role
 
 import (
 	"fmt"
+	"sort"
 	"testing"
 )
 
@@ -28,3 +29,28 @@ func TestRuleManager(t *testing.T) {
 
 	fmt.Println("=====>", users)
 }
+
+func TestRuleManagerImplicitRoles(t *testing.T) {
+	rm := NewRuleManager()
+	rm.AddRoleForUserInDomain("Bruce Lee", "master", "Kung Fu")
+	rm.AddRoleForUserInDomain("master", "teacher", "Kung Fu")
+	rm.AddRoleForUserInDomain("teacher", "member", "Kung Fu")
+	rm.AddRoleForUserInDomain("member", "teacher", "Kung Fu")
+	rm.AddRoleForUserInDomain("Bruce Lee", "actor", "Hollywood")
+
+	roles := rm.GetImplicitRolesForUserInDomain("Bruce Lee", "Kung Fu")
+	sort.Strings(roles)
+	if !ArrayEquals(roles, []string{"master", "member", "teacher"}) {
+		t.Fatalf("GetImplicitRolesForUserInDomain returned %v", roles)
+	}
+
+	roles = rm.GetImplicitRolesForUserInDomain("Bruce Lee", "Hollywood")
+	if !ArrayEquals(roles, []string{"actor"}) {
+		t.Fatalf("GetImplicitRolesForUserInDomain returned %v", roles)
+	}
+
+	roles = rm.GetImplicitRolesForUserInDomain("Peter", "Kung Fu")
+	if len(roles) != 0 {
+		t.Fatalf("GetImplicitRolesForUserInDomain returned %v", roles)
+	}
+}
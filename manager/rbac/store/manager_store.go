@@ -1,11 +1,13 @@
 package store
 
 import (
+	"context"
 	"crypto/sha256"
 	"database/sql"
 	"encoding/json"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/jmoiron/sqlx"
 	. "github.com/ory/ladon"
@@ -18,6 +20,12 @@ import (
 type StoreManager struct {
 	db       *sqlx.DB
 	database string
+
+	// author is recorded in the history of the policies written, see WithAuthor.
+	author string
+
+	// WatchInterval is how often Watch polls the change log. Defaults to DefaultWatchInterval.
+	WatchInterval time.Duration
 }
 
 // NewStoreManager initializes a new StoreManager for given db instance.
@@ -26,6 +34,9 @@ func NewStoreManager(db *sqlx.DB, schema []string) *StoreManager {
 	switch database {
 	case "pgx", "pq":
 		database = "postgres"
+	case "sqlite3_ladon":
+		// The driver registered by github.com/ory/ladon/manager/sql/sqlite
+		database = "sqlite3"
 	}
 
 	return &StoreManager{
@@ -34,7 +45,8 @@ func NewStoreManager(db *sqlx.DB, schema []string) *StoreManager {
 	}
 }
 
-// CreateSchemas creates ladon_policy tables
+// CreateSchemas creates ladon_policy tables. Policies which have no history yet, e.g. because they were stored before
+// the history table was created, are given a baseline revision (see Revisions).
 func (s *StoreManager) CreateSchemas(schema, table string) (int, error) {
 	if _, ok := Migrations[s.database]; !ok {
 		return 0, errors.Errorf("Database %s is not supported", s.database)
@@ -48,28 +60,91 @@ func (s *StoreManager) CreateSchemas(schema, table string) (int, error) {
 	if err != nil {
 		return 0, errors.Wrapf(err, "Could not migrate sql schema, applied %d migrations", n)
 	}
+
+	if err := s.recordBaselines(); err != nil {
+		return n, errors.WithMessage(err, "Could not record the baseline revisions of existing policies")
+	}
 	return n, nil
 }
 
-// Update updates an existing policy.
+// Update updates an existing policy and increases its version.
 func (s *StoreManager) Update(policy Policy) error {
-	tx, err := s.db.Beginx()
-	if err != nil {
-		return errors.WithStack(err)
-	}
+	return s.update(policy, 0, false)
+}
 
-	if err := s.delete(policy.GetID(), tx); err != nil {
-		if rollErr := tx.Rollback(); rollErr != nil {
-			return errors.Wrap(err, rollErr.Error())
+// UpdateIfMatch updates an existing policy, but only if its stored version equals version. Otherwise ErrConflict is
+// returned.
+func (s *StoreManager) UpdateIfMatch(policy Policy, version int64) error {
+	return s.update(policy, version, true)
+}
+
+func (s *StoreManager) update(policy Policy, version int64, match bool) error {
+	return s.transaction(func(tx *sqlx.Tx) error {
+		if err := s.lock(tx, policy.GetID()); err != nil {
+			return err
 		}
+
+		before, err := s.find(tx, policy.GetID())
+		if err != nil {
+			return err
+		}
+
+		if err := s.replace(policy, version, match, tx); err != nil {
+			return err
+		}
+
+		operation := OperationUpdate
+		if before == nil {
+			operation = OperationCreate
+		}
+		return s.record(tx, operation, policy.GetID(), before)
+	})
+}
+
+// CreateOrUpdate creates the policies which do not exist yet and updates the others in a single transaction.
+func (s *StoreManager) CreateOrUpdate(policies Policies) error {
+	return s.transaction(func(tx *sqlx.Tx) error {
+		for _, p := range policies {
+			if err := s.lock(tx, p.GetID()); err != nil {
+				return err
+			}
+
+			before, err := s.find(tx, p.GetID())
+			if err != nil {
+				return err
+			}
+
+			if before == nil {
+				if err := s.create(p, 1, tx); err != nil {
+					return errors.WithStack(err)
+				} else if err := s.record(tx, OperationCreate, p.GetID(), nil); err != nil {
+					return err
+				}
+				continue
+			}
+
+			if err := s.replace(p, 0, false, tx); err != nil {
+				return err
+			} else if err := s.record(tx, OperationUpdate, p.GetID(), before); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// transaction runs fn in a transaction, which is committed if fn succeeds and rolled back otherwise.
+func (s *StoreManager) transaction(fn func(tx *sqlx.Tx) error) error {
+	tx, err := s.db.Beginx()
+	if err != nil {
 		return errors.WithStack(err)
 	}
 
-	if err := s.create(policy, tx); err != nil {
+	if err := fn(tx); err != nil {
 		if rollErr := tx.Rollback(); rollErr != nil {
 			return errors.Wrap(err, rollErr.Error())
 		}
-		return errors.WithStack(err)
+		return err
 	}
 
 	if err = tx.Commit(); err != nil {
@@ -82,31 +157,62 @@ func (s *StoreManager) Update(policy Policy) error {
 	return nil
 }
 
-// Create inserts a new policy
-func (s *StoreManager) Create(policy Policy) (err error) {
-	tx, err := s.db.Beginx()
+// replace increases the version of a policy and replaces it. If match is true, the policy is only replaced if its
+// stored version equals version. The version is increased first, so that concurrent updates are serialized by the
+// database's row lock.
+func (s *StoreManager) replace(policy Policy, version int64, match bool, tx *sqlx.Tx) error {
+	query, args := "UPDATE ladon_policy SET version = version + 1 WHERE id = ?", []interface{}{policy.GetID()}
+	if match {
+		query, args = query+" AND version = ?", append(args, version)
+	}
+
+	result, err := tx.Exec(s.db.Rebind(query), args...)
 	if err != nil {
 		return errors.WithStack(err)
 	}
 
-	if err := s.create(policy, tx); err != nil {
-		if rollErr := tx.Rollback(); rollErr != nil {
-			return errors.Wrap(err, rollErr.Error())
-		}
+	affected, err := result.RowsAffected()
+	if err != nil {
 		return errors.WithStack(err)
 	}
 
-	if err = tx.Commit(); err != nil {
-		if rollErr := tx.Rollback(); rollErr != nil {
-			return errors.Wrap(err, rollErr.Error())
+	next := int64(1)
+	if affected == 0 && match {
+		var exists int
+		if err := tx.Get(&exists, s.db.Rebind("SELECT COUNT(*) FROM ladon_policy WHERE id = ?"), policy.GetID()); err != nil {
+			return errors.WithStack(err)
+		} else if exists == 0 {
+			return NewErrResourceNotFound(sql.ErrNoRows)
 		}
+		return errors.WithStack(ErrConflict)
+	} else if affected > 0 {
+		if err := tx.Get(&next, s.db.Rebind("SELECT version FROM ladon_policy WHERE id = ?"), policy.GetID()); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	if err := s.delete(policy.GetID(), tx); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := s.create(policy, next, tx); err != nil {
 		return errors.WithStack(err)
 	}
 
 	return nil
 }
 
-func (s *StoreManager) create(policy Policy, tx *sqlx.Tx) (err error) {
+// Create inserts a new policy
+func (s *StoreManager) Create(policy Policy) (err error) {
+	return s.transaction(func(tx *sqlx.Tx) error {
+		if err := s.create(policy, 1, tx); err != nil {
+			return errors.WithStack(err)
+		}
+		return s.record(tx, OperationCreate, policy.GetID(), nil)
+	})
+}
+
+func (s *StoreManager) create(policy Policy, version int64, tx *sqlx.Tx) (err error) {
 	conditions := []byte("{}")
 	if policy.GetConditions() != nil {
 		cs := policy.GetConditions()
@@ -120,7 +226,18 @@ func (s *StoreManager) create(policy Policy, tx *sqlx.Tx) (err error) {
 		return errors.Errorf("Database %s is not supported", s.database)
 	}
 
-	if _, err = tx.Exec(s.db.Rebind(Migrations[s.database].QueryInsertPolicy), policy.GetID(), policy.GetDescription(), policy.GetEffect(), conditions); err != nil {
+	var priority int
+	if pp, ok := policy.(PriorityPolicy); ok {
+		priority = pp.GetPriority()
+	}
+
+	var notBefore, notAfter sql.NullInt64
+	if vp, ok := policy.(ValidityPolicy); ok {
+		notBefore = toUnixMicro(vp.GetNotBefore())
+		notAfter = toUnixMicro(vp.GetNotAfter())
+	}
+
+	if _, err = tx.Exec(s.db.Rebind(Migrations[s.database].QueryInsertPolicy), policy.GetID(), policy.GetDescription(), policy.GetEffect(), conditions, priority, notBefore, notAfter, version); err != nil {
 		return errors.WithStack(err)
 	}
 
@@ -160,7 +277,7 @@ func (s *StoreManager) create(policy Policy, tx *sqlx.Tx) (err error) {
 				return errors.WithStack(err)
 			}
 
-			if _, err := tx.Exec(s.db.Rebind(query), id, template, compiled.String(), strings.Index(template, string(policy.GetStartDelimiter())) >= -1); err != nil {
+			if _, err := tx.Exec(s.db.Rebind(query), id, template, compiled.String(), strings.Index(template, string(policy.GetStartDelimiter())) >= 0); err != nil {
 				return errors.WithStack(err)
 			}
 			if _, err := tx.Exec(s.db.Rebind(queryRel), policy.GetID(), id); err != nil {
@@ -172,10 +289,19 @@ func (s *StoreManager) create(policy Policy, tx *sqlx.Tx) (err error) {
 	return nil
 }
 
+// FindRequestCandidates returns the policies whose subjects, actions and resources each match the request. The
+// templates are matched by the database. Policies outside of their validity period at the current time are left out.
 func (s *StoreManager) FindRequestCandidates(r *Request) (Policies, error) {
+	return s.FindRequestCandidatesContext(context.Background(), r)
+}
+
+// FindRequestCandidatesContext is like FindRequestCandidates, but cancels the query as soon as ctx is done. The
+// validity period is checked against ladon.EvaluationTime(ctx), which is the time of the warden's Clock.
+func (s *StoreManager) FindRequestCandidatesContext(ctx context.Context, r *Request) (Policies, error) {
 	query := Migrations[s.database].QueryRequestCandidates
+	now := unixMicro(EvaluationTime(ctx))
 
-	rows, err := s.db.Query(s.db.Rebind(query), r.Subject, r.Subject)
+	rows, err := s.db.QueryContext(ctx, s.db.Rebind(query), r.Subject, r.Subject, r.Action, r.Action, r.Resource, r.Resource, now, now)
 	if err == sql.ErrNoRows {
 		return nil, NewErrResourceNotFound(err)
 	} else if err != nil {
@@ -193,11 +319,12 @@ func scanRows(rows *sql.Rows) (Policies, error) {
 		var p DefaultPolicy
 		var conditions []byte
 		var resource, subject, action sql.NullString
+		var notBefore, notAfter sql.NullInt64
 		p.Actions = []string{}
 		p.Subjects = []string{}
 		p.Resources = []string{}
 
-		if err := rows.Scan(&p.ID, &p.Effect, &conditions, &p.Description, &subject, &resource, &action); err == sql.ErrNoRows {
+		if err := rows.Scan(&p.ID, &p.Effect, &conditions, &p.Description, &p.Priority, &notBefore, &notAfter, &p.Version, &subject, &resource, &action); err == sql.ErrNoRows {
 			return nil, NewErrResourceNotFound(err)
 		} else if err != nil {
 			return nil, errors.WithStack(err)
@@ -207,6 +334,8 @@ func scanRows(rows *sql.Rows) (Policies, error) {
 		if err := json.Unmarshal(conditions, &p.Conditions); err != nil {
 			return nil, errors.WithStack(err)
 		}
+		p.NotBefore = fromUnixMicro(notBefore)
+		p.NotAfter = fromUnixMicro(notAfter)
 
 		if c, ok := policies[p.ID]; ok {
 			if action.Valid {
@@ -251,7 +380,7 @@ func scanRows(rows *sql.Rows) (Policies, error) {
 }
 
 var getQuery = `SELECT
-	p.id, p.effect, p.conditions, p.description,
+	p.id, p.effect, p.conditions, p.description, p.priority, p.not_before, p.not_after, p.version,
 	subject.template as subject, resource.template as resource, action.template as action
 FROM
 	ladon_policy as p
@@ -267,7 +396,7 @@ LEFT JOIN ladon_resource as resource ON rr.resource = resource.id
 WHERE p.id=?`
 
 var getAllQuery = `SELECT
-	p.id, p.effect, p.conditions, p.description,
+	p.id, p.effect, p.conditions, p.description, p.priority, p.not_before, p.not_after, p.version,
 	subject.template as subject, resource.template as resource, action.template as action
 FROM
 	(SELECT * from ladon_policy ORDER BY id LIMIT ? OFFSET ?) as p
@@ -295,12 +424,20 @@ func (s *StoreManager) GetAll(limit, offset int64) (Policies, error) {
 
 // Get retrieves a policy.
 func (s *StoreManager) Get(id string) (Policy, error) {
-	query := s.db.Rebind(getQuery)
+	p, err := s.find(s.db, id)
+	if err != nil {
+		return nil, err
+	} else if p == nil {
+		return nil, NewErrResourceNotFound(sql.ErrNoRows)
+	}
 
-	rows, err := s.db.Query(query, id)
-	if err == sql.ErrNoRows {
-		return nil, NewErrResourceNotFound(err)
-	} else if err != nil {
+	return p, nil
+}
+
+// find retrieves a policy, or nil if it does not exist.
+func (s *StoreManager) find(q sqlx.Queryer, id string) (*DefaultPolicy, error) {
+	rows, err := q.Query(s.db.Rebind(getQuery), id)
+	if err != nil {
 		return nil, errors.WithStack(err)
 	}
 	defer rows.Close()
@@ -309,34 +446,31 @@ func (s *StoreManager) Get(id string) (Policy, error) {
 	if err != nil {
 		return nil, errors.WithStack(err)
 	} else if len(policies) == 0 {
-		return nil, NewErrResourceNotFound(sql.ErrNoRows)
+		return nil, nil
 	}
 
-	return policies[0], nil
+	return policies[0].(*DefaultPolicy), nil
 }
 
 // Delete removes a policy.
 func (s *StoreManager) Delete(id string) error {
-	tx, err := s.db.Beginx()
-	if err != nil {
-		return errors.WithStack(err)
-	}
-
-	if err := s.delete(id, tx); err != nil {
-		if rollErr := tx.Rollback(); rollErr != nil {
-			return errors.Wrap(err, rollErr.Error())
+	return s.transaction(func(tx *sqlx.Tx) error {
+		if err := s.lock(tx, id); err != nil {
+			return err
 		}
-		return errors.WithStack(err)
-	}
 
-	if err = tx.Commit(); err != nil {
-		if rollErr := tx.Rollback(); rollErr != nil {
-			return errors.Wrap(err, rollErr.Error())
+		before, err := s.find(tx, id)
+		if err != nil {
+			return err
 		}
-		return errors.WithStack(err)
-	}
 
-	return nil
+		if err := s.delete(id, tx); err != nil {
+			return err
+		} else if before == nil {
+			return nil
+		}
+		return s.record(tx, OperationDelete, id, before)
+	})
 }
 
 // Delete removes a policy.
@@ -345,6 +479,28 @@ func (s *StoreManager) delete(id string, tx *sqlx.Tx) error {
 	return errors.WithStack(err)
 }
 
+// toUnixMicro converts a policy's validity bound to the unix time in microseconds it is stored as.
+func toUnixMicro(t *time.Time) sql.NullInt64 {
+	if t == nil {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: unixMicro(*t), Valid: true}
+}
+
+// fromUnixMicro is the inverse of toUnixMicro.
+func fromUnixMicro(u sql.NullInt64) *time.Time {
+	if !u.Valid {
+		return nil
+	}
+	t := time.Unix(u.Int64/1e6, u.Int64%1e6*1e3).UTC()
+	return &t
+}
+
+// unixMicro returns t as unix time in microseconds. Unlike t.UnixNano, it does not overflow for years after 2262.
+func unixMicro(t time.Time) int64 {
+	return t.Unix()*1e6 + int64(t.Nanosecond()/1e3)
+}
+
 func uniq(input []string) []string {
 	u := make([]string, 0, len(input))
 	m := make(map[string]bool)
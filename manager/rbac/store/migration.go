@@ -111,9 +111,21 @@ func (s *StoreManagerMigrateFromMajor0Minor6ToMajor0Minor7) Create(policy Policy
 		}
 	}
 
+	// Migrate does not touch existing rows of ladon_policy, so columns added later must be written here.
+	var priority int
+	if pp, ok := policy.(PriorityPolicy); ok {
+		priority = pp.GetPriority()
+	}
+
+	var notBefore, notAfter sql.NullInt64
+	if vp, ok := policy.(ValidityPolicy); ok {
+		notBefore = toUnixMicro(vp.GetNotBefore())
+		notAfter = toUnixMicro(vp.GetNotAfter())
+	}
+
 	if tx, err := s.DB.Begin(); err != nil {
 		return errors.WithStack(err)
-	} else if _, err = tx.Exec(s.DB.Rebind("INSERT INTO ladon_policy (id, description, effect, conditions) VALUES (?, ?, ?, ?)"), policy.GetID(), policy.GetDescription(), policy.GetEffect(), conditions); err != nil {
+	} else if _, err = tx.Exec(s.DB.Rebind("INSERT INTO ladon_policy (id, description, effect, conditions, priority, not_before, not_after) VALUES (?, ?, ?, ?, ?, ?, ?)"), policy.GetID(), policy.GetDescription(), policy.GetEffect(), conditions, priority, notBefore, notAfter); err != nil {
 		if err := tx.Rollback(); err != nil {
 			return errors.WithStack(err)
 		}
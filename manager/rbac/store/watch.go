@@ -0,0 +1,164 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	. "github.com/ory/ladon"
+	"github.com/pkg/errors"
+)
+
+// DefaultWatchInterval is how often Watch polls the change log if WatchInterval is not set.
+const DefaultWatchInterval = time.Second
+
+// watchGapTimeout is how long Watch waits for a change whose sequence number was skipped. Sequence numbers are
+// skipped if a transaction is rolled back, but also if a transaction which started earlier commits later.
+const watchGapTimeout = time.Minute
+
+// logChange appends a change to the change log followed by Watch.
+func (s *StoreManager) logChange(tx *sqlx.Tx, event PolicyEventType, id string) error {
+	_, err := tx.Exec(s.db.Rebind("INSERT INTO ladon_policy_change (policy, event_type, created_at) VALUES (?, ?, ?)"), id, string(event), time.Now().UnixNano())
+	return errors.WithStack(err)
+}
+
+// PruneChanges removes the changes logged before t from the change log and returns how many were removed. Watches
+// which did not poll since t miss the removed changes.
+func (s *StoreManager) PruneChanges(t time.Time) (int64, error) {
+	result, err := s.db.Exec(s.db.Rebind("DELETE FROM ladon_policy_change WHERE created_at < ?"), t.UnixNano())
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+
+	n, err := result.RowsAffected()
+	return n, errors.WithStack(err)
+}
+
+func (s *StoreManager) watchInterval() time.Duration {
+	if s.WatchInterval <= 0 {
+		return DefaultWatchInterval
+	}
+	return s.WatchInterval
+}
+
+// Watch returns a channel which receives an event for every change made after Watch returned, by this or any other
+// process sharing the database. The change log is polled every WatchInterval, errors are retried at the next poll. The
+// channel is closed once ctx is done. An error is returned if the position of the watch in the change log can not be
+// determined.
+//
+// Changes are reported in the order of their sequence number in the change log. A change committed after a change with
+// a higher sequence number is still reported if it is committed within a minute.
+func (s *StoreManager) Watch(ctx context.Context) (<-chan PolicyEvent, error) {
+	f := &changeFeed{seen: map[int64]bool{}}
+	if err := s.db.GetContext(ctx, &f.last, "SELECT COALESCE(MAX(seq), 0) FROM ladon_policy_change"); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	events := make(chan PolicyEvent)
+	go func() {
+		defer close(events)
+
+		ticker := time.NewTicker(s.watchInterval())
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			changes, err := s.changes(ctx, f)
+			if err != nil {
+				continue
+			}
+
+			for _, c := range changes {
+				e := PolicyEvent{Type: PolicyEventType(c.event), ID: c.policy}
+				if e.Type != PolicyDeleted {
+					if p, err := s.find(s.db, c.policy); err == nil && p != nil {
+						e.Policy = p
+					}
+				}
+
+				select {
+				case events <- e:
+				case <-ctx.Done():
+					return
+				}
+				f.seen[c.seq] = true
+			}
+			f.advance(time.Now())
+		}
+	}()
+	return events, nil
+}
+
+type change struct {
+	seq    int64
+	policy string
+	event  string
+}
+
+// changes returns the changes which were logged after f.last and have not been reported yet.
+func (s *StoreManager) changes(ctx context.Context, f *changeFeed) ([]change, error) {
+	rows, err := s.db.QueryContext(ctx, s.db.Rebind("SELECT seq, policy, event_type FROM ladon_policy_change WHERE seq > ? ORDER BY seq"), f.last)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer rows.Close()
+
+	var changes []change
+	for rows.Next() {
+		var c change
+		if err := rows.Scan(&c.seq, &c.policy, &c.event); err != nil {
+			return nil, errors.WithStack(err)
+		} else if !f.seen[c.seq] {
+			changes = append(changes, c)
+		}
+	}
+	return changes, errors.WithStack(rows.Err())
+}
+
+// changeFeed is the position of a watch in the change log.
+type changeFeed struct {
+	// last is the sequence number up to which all changes were reported or given up on.
+	last int64
+
+	// seen are the sequence numbers after last which were reported already.
+	seen map[int64]bool
+
+	// gapSince is when the change after last was first found missing while later changes were reported.
+	gapSince time.Time
+}
+
+// advance moves last forward over the reported changes. A missing change is given up on after watchGapTimeout.
+func (f *changeFeed) advance(now time.Time) {
+	for {
+		advanced := false
+		for f.seen[f.last+1] {
+			delete(f.seen, f.last+1)
+			f.last++
+			advanced = true
+		}
+
+		if len(f.seen) == 0 {
+			f.gapSince = time.Time{}
+			return
+		} else if advanced || f.gapSince.IsZero() {
+			f.gapSince = now
+			return
+		} else if now.Sub(f.gapSince) < watchGapTimeout {
+			return
+		}
+
+		// The missing change was rolled back or took too long to commit, skip it.
+		var lowest int64
+		for seq := range f.seen {
+			if lowest == 0 || seq < lowest {
+				lowest = seq
+			}
+		}
+		f.last = lowest - 1
+	}
+}
@@ -31,6 +31,7 @@ type Statements struct {
 	QueryInsertPolicyResourcesRel string
 	QueryInsertPolicySubjects     string
 	QueryInsertPolicySubjectsRel  string
+	QueryLockPolicy               string
 	QueryRequestCandidates        string
 }
 
@@ -115,6 +116,54 @@ var sharedMigrations = []*migrate.Migration{
 		},
 		Down: []string{},
 	},
+	{
+		Id: "4",
+		Up: []string{
+			"ALTER TABLE ladon_policy ADD COLUMN priority integer NOT NULL DEFAULT 0",
+		},
+		Down: []string{
+			"ALTER TABLE ladon_policy DROP COLUMN priority",
+		},
+	},
+	{
+		// not_before and not_after hold unix time in microseconds.
+		Id: "5",
+		Up: []string{
+			"ALTER TABLE ladon_policy ADD COLUMN not_before bigint NULL",
+			"ALTER TABLE ladon_policy ADD COLUMN not_after bigint NULL",
+		},
+		Down: []string{
+			"ALTER TABLE ladon_policy DROP COLUMN not_before",
+			"ALTER TABLE ladon_policy DROP COLUMN not_after",
+		},
+	},
+	{
+		Id: "6",
+		Up: []string{
+			"ALTER TABLE ladon_policy ADD COLUMN version bigint NOT NULL DEFAULT 1",
+		},
+		Down: []string{
+			"ALTER TABLE ladon_policy DROP COLUMN version",
+		},
+	},
+	{
+		Id: "7",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS ladon_policy_revision (
+				policy      varchar(255) NOT NULL,
+				revision    bigint NOT NULL,
+				operation   varchar(16) NOT NULL,
+				author      varchar(255) NOT NULL,
+				created_at  bigint NOT NULL,
+				old_policy  text NULL,
+				new_policy  text NULL,
+				PRIMARY KEY (policy, revision)
+			)`,
+		},
+		Down: []string{
+			"DROP TABLE ladon_policy_revision",
+		},
+	},
 }
 
 var Migrations = map[string]Statements{
@@ -136,21 +185,58 @@ var Migrations = map[string]Statements{
 						"DROP INDEX ladon_resource_compiled_idx",
 					},
 				},
+				sharedMigrations[2],
+				sharedMigrations[3],
+				sharedMigrations[4],
+				sharedMigrations[5],
+				{
+					Id: "8",
+					Up: []string{
+						`CREATE TABLE IF NOT EXISTS ladon_policy_change (
+							seq         bigserial NOT NULL PRIMARY KEY,
+							policy      varchar(255) NOT NULL,
+							event_type  varchar(16) NOT NULL,
+							created_at  bigint NOT NULL
+						)`,
+					},
+					Down: []string{
+						"DROP TABLE ladon_policy_change",
+					},
+				},
+				{
+					// Templates without delimiters were stored as regular expressions, they are matched by equality now.
+					Id: "9",
+					Up: []string{
+						"UPDATE ladon_subject SET has_regex = (compiled <> '^' || template || '$')",
+						"UPDATE ladon_action SET has_regex = (compiled <> '^' || template || '$')",
+						"UPDATE ladon_resource SET has_regex = (compiled <> '^' || template || '$')",
+					},
+					Down: []string{
+						"UPDATE ladon_subject SET has_regex = true",
+						"UPDATE ladon_action SET has_regex = true",
+						"UPDATE ladon_resource SET has_regex = true",
+					},
+				},
 			},
 		},
-		QueryInsertPolicy:             `INSERT INTO ladon_policy(id, description, effect, conditions) SELECT $1::varchar, $2, $3, $4 WHERE NOT EXISTS (SELECT 1 FROM ladon_policy WHERE id = $1)`,
+		QueryInsertPolicy:             `INSERT INTO ladon_policy(id, description, effect, conditions, priority, not_before, not_after, version) SELECT $1::varchar, $2, $3, $4, $5::integer, $6::bigint, $7::bigint, $8::bigint WHERE NOT EXISTS (SELECT 1 FROM ladon_policy WHERE id = $1)`,
 		QueryInsertPolicyActions:      `INSERT INTO ladon_action (id, template, compiled, has_regex) SELECT $1::varchar, $2, $3, $4 WHERE NOT EXISTS (SELECT 1 FROM ladon_action WHERE id = $1)`,
 		QueryInsertPolicyActionsRel:   `INSERT INTO ladon_policy_action_rel (policy, action) SELECT $1::varchar, $2::varchar WHERE NOT EXISTS (SELECT 1 FROM ladon_policy_action_rel WHERE policy = $1 AND action = $2)`,
 		QueryInsertPolicyResources:    `INSERT INTO ladon_resource (id, template, compiled, has_regex) SELECT $1::varchar, $2, $3, $4 WHERE NOT EXISTS (SELECT 1 FROM ladon_resource WHERE id = $1)`,
 		QueryInsertPolicyResourcesRel: `INSERT INTO ladon_policy_resource_rel (policy, resource) SELECT $1::varchar, $2::varchar WHERE NOT EXISTS (SELECT 1 FROM ladon_policy_resource_rel WHERE policy = $1 AND resource = $2)`,
 		QueryInsertPolicySubjects:     `INSERT INTO ladon_subject (id, template, compiled, has_regex) SELECT $1::varchar, $2, $3, $4 WHERE NOT EXISTS (SELECT 1 FROM ladon_subject WHERE id = $1)`,
 		QueryInsertPolicySubjectsRel:  `INSERT INTO ladon_policy_subject_rel (policy, subject) SELECT $1::varchar, $2::varchar WHERE NOT EXISTS (SELECT 1 FROM ladon_policy_subject_rel WHERE policy = $1 AND subject = $2)`,
+		QueryLockPolicy:               `SELECT id FROM ladon_policy WHERE id = $1 FOR UPDATE`,
 		QueryRequestCandidates: `
 		SELECT
 			p.id,
 			p.effect,
 			p.conditions,
 			p.description,
+			p.priority,
+			p.not_before,
+			p.not_after,
+			p.version,
 			subject.template AS subject,
 			resource.template AS resource,
 			action.template AS action
@@ -165,9 +251,29 @@ var Migrations = map[string]Statements{
 			LEFT JOIN ladon_action AS action ON ra.action = action.id
 			LEFT JOIN ladon_resource AS resource ON rr.resource = resource.id
 		WHERE
-			(subject.has_regex IS NOT TRUE AND subject.template = $1)
-			OR
-			(subject.has_regex IS TRUE AND $2 ~ subject.compiled)`,
+			(
+				(subject.has_regex IS NOT TRUE AND subject.template = $1)
+				OR
+				(subject.has_regex IS TRUE AND $2 ~ subject.compiled)
+			)
+			AND EXISTS (
+				SELECT 1 FROM ladon_policy_action_rel AS fra INNER JOIN ladon_action AS fa ON fra.action = fa.id
+				WHERE fra.policy = p.id AND (
+					(fa.has_regex IS NOT TRUE AND fa.template = $3)
+					OR
+					(fa.has_regex IS TRUE AND $4 ~ fa.compiled)
+				)
+			)
+			AND EXISTS (
+				SELECT 1 FROM ladon_policy_resource_rel AS frr INNER JOIN ladon_resource AS fr ON frr.resource = fr.id
+				WHERE frr.policy = p.id AND (
+					(fr.has_regex IS NOT TRUE AND fr.template = $5)
+					OR
+					(fr.has_regex IS TRUE AND $6 ~ fr.compiled)
+				)
+			)
+			AND (p.not_before IS NULL OR p.not_before <= $7)
+			AND (p.not_after IS NULL OR p.not_after >= $8)`,
 	},
 	"mysql": {
 		Migrations: &migrate.MemoryMigrationSource{
@@ -187,21 +293,164 @@ var Migrations = map[string]Statements{
 						"DROP INDEX ladon_resource_compiled_idx",
 					},
 				},
+				sharedMigrations[2],
+				sharedMigrations[3],
+				sharedMigrations[4],
+				sharedMigrations[5],
+				{
+					Id: "8",
+					Up: []string{
+						`CREATE TABLE IF NOT EXISTS ladon_policy_change (
+							seq         bigint NOT NULL AUTO_INCREMENT PRIMARY KEY,
+							policy      varchar(255) NOT NULL,
+							event_type  varchar(16) NOT NULL,
+							created_at  bigint NOT NULL
+						)`,
+					},
+					Down: []string{
+						"DROP TABLE ladon_policy_change",
+					},
+				},
+				{
+					Id: "9",
+					Up: []string{
+						"UPDATE ladon_subject SET has_regex = (BINARY compiled <> CONCAT('^', template, '$'))",
+						"UPDATE ladon_action SET has_regex = (BINARY compiled <> CONCAT('^', template, '$'))",
+						"UPDATE ladon_resource SET has_regex = (BINARY compiled <> CONCAT('^', template, '$'))",
+					},
+					Down: []string{
+						"UPDATE ladon_subject SET has_regex = 1",
+						"UPDATE ladon_action SET has_regex = 1",
+						"UPDATE ladon_resource SET has_regex = 1",
+					},
+				},
 			},
 		},
-		QueryInsertPolicy:             `INSERT IGNORE INTO ladon_policy (id, description, effect, conditions) VALUES(?,?,?,?)`,
+		QueryInsertPolicy:             `INSERT IGNORE INTO ladon_policy (id, description, effect, conditions, priority, not_before, not_after, version) VALUES(?,?,?,?,?,?,?,?)`,
 		QueryInsertPolicyActions:      `INSERT IGNORE INTO ladon_action (id, template, compiled, has_regex) VALUES(?,?,?,?)`,
 		QueryInsertPolicyActionsRel:   `INSERT IGNORE INTO ladon_policy_action_rel (policy, action) VALUES(?,?)`,
 		QueryInsertPolicyResources:    `INSERT IGNORE INTO ladon_resource (id, template, compiled, has_regex) VALUES(?,?,?,?)`,
 		QueryInsertPolicyResourcesRel: `INSERT IGNORE INTO ladon_policy_resource_rel (policy, resource) VALUES(?,?)`,
 		QueryInsertPolicySubjects:     `INSERT IGNORE INTO ladon_subject (id, template, compiled, has_regex) VALUES(?,?,?,?)`,
 		QueryInsertPolicySubjectsRel:  `INSERT IGNORE INTO ladon_policy_subject_rel (policy, subject) VALUES(?,?)`,
+		QueryLockPolicy:               `SELECT id FROM ladon_policy WHERE id = ? FOR UPDATE`,
+		QueryRequestCandidates: `
+		SELECT
+			p.id,
+			p.effect,
+			p.conditions,
+			p.description,
+			p.priority,
+			p.not_before,
+			p.not_after,
+			p.version,
+			subject.template AS subject,
+			resource.template AS resource,
+			action.template AS action
+		FROM
+			ladon_policy AS p
+
+			INNER JOIN ladon_policy_subject_rel AS rs ON rs.policy = p.id
+			LEFT JOIN ladon_policy_action_rel AS ra ON ra.policy = p.id
+			LEFT JOIN ladon_policy_resource_rel AS rr ON rr.policy = p.id
+
+			INNER JOIN ladon_subject AS subject ON rs.subject = subject.id
+			LEFT JOIN ladon_action AS action ON ra.action = action.id
+			LEFT JOIN ladon_resource AS resource ON rr.resource = resource.id
+		WHERE
+			(
+				(subject.has_regex = 0 AND subject.template = BINARY ?)
+				OR
+				(subject.has_regex = 1 AND ? REGEXP BINARY subject.compiled)
+			)
+			AND EXISTS (
+				SELECT 1 FROM ladon_policy_action_rel AS fra INNER JOIN ladon_action AS fa ON fra.action = fa.id
+				WHERE fra.policy = p.id AND (
+					(fa.has_regex = 0 AND fa.template = BINARY ?)
+					OR
+					(fa.has_regex = 1 AND ? REGEXP BINARY fa.compiled)
+				)
+			)
+			AND EXISTS (
+				SELECT 1 FROM ladon_policy_resource_rel AS frr INNER JOIN ladon_resource AS fr ON frr.resource = fr.id
+				WHERE frr.policy = p.id AND (
+					(fr.has_regex = 0 AND fr.template = BINARY ?)
+					OR
+					(fr.has_regex = 1 AND ? REGEXP BINARY fr.compiled)
+				)
+			)
+			AND (p.not_before IS NULL OR p.not_before <= ?)
+			AND (p.not_after IS NULL OR p.not_after >= ?)`,
+	},
+	"sqlite3": {
+		Migrations: &migrate.MemoryMigrationSource{
+			Migrations: []*migrate.Migration{
+				sharedMigrations[0],
+				sharedMigrations[1],
+				{
+					Id: "3",
+					Up: []string{
+						"CREATE INDEX ladon_subject_compiled_idx ON ladon_subject (compiled)",
+						"CREATE INDEX ladon_action_compiled_idx ON ladon_action (compiled)",
+						"CREATE INDEX ladon_resource_compiled_idx ON ladon_resource (compiled)",
+					},
+					Down: []string{
+						"DROP INDEX ladon_subject_compiled_idx",
+						"DROP INDEX ladon_action_compiled_idx",
+						"DROP INDEX ladon_resource_compiled_idx",
+					},
+				},
+				sharedMigrations[2],
+				sharedMigrations[3],
+				sharedMigrations[4],
+				sharedMigrations[5],
+				{
+					Id: "8",
+					Up: []string{
+						`CREATE TABLE IF NOT EXISTS ladon_policy_change (
+							seq         integer NOT NULL PRIMARY KEY AUTOINCREMENT,
+							policy      varchar(255) NOT NULL,
+							event_type  varchar(16) NOT NULL,
+							created_at  bigint NOT NULL
+						)`,
+					},
+					Down: []string{
+						"DROP TABLE ladon_policy_change",
+					},
+				},
+				{
+					Id: "9",
+					Up: []string{
+						"UPDATE ladon_subject SET has_regex = (compiled <> '^' || template || '$')",
+						"UPDATE ladon_action SET has_regex = (compiled <> '^' || template || '$')",
+						"UPDATE ladon_resource SET has_regex = (compiled <> '^' || template || '$')",
+					},
+					Down: []string{
+						"UPDATE ladon_subject SET has_regex = 1",
+						"UPDATE ladon_action SET has_regex = 1",
+						"UPDATE ladon_resource SET has_regex = 1",
+					},
+				},
+			},
+		},
+		QueryInsertPolicy:             `INSERT OR IGNORE INTO ladon_policy (id, description, effect, conditions, priority, not_before, not_after, version) VALUES(?,?,?,?,?,?,?,?)`,
+		QueryInsertPolicyActions:      `INSERT OR IGNORE INTO ladon_action (id, template, compiled, has_regex) VALUES(?,?,?,?)`,
+		QueryInsertPolicyActionsRel:   `INSERT OR IGNORE INTO ladon_policy_action_rel (policy, action) VALUES(?,?)`,
+		QueryInsertPolicyResources:    `INSERT OR IGNORE INTO ladon_resource (id, template, compiled, has_regex) VALUES(?,?,?,?)`,
+		QueryInsertPolicyResourcesRel: `INSERT OR IGNORE INTO ladon_policy_resource_rel (policy, resource) VALUES(?,?)`,
+		QueryInsertPolicySubjects:     `INSERT OR IGNORE INTO ladon_subject (id, template, compiled, has_regex) VALUES(?,?,?,?)`,
+		QueryInsertPolicySubjectsRel:  `INSERT OR IGNORE INTO ladon_policy_subject_rel (policy, subject) VALUES(?,?)`,
+		QueryLockPolicy:               `UPDATE ladon_policy SET id = id WHERE id = ?`,
 		QueryRequestCandidates: `
 		SELECT
 			p.id,
 			p.effect,
 			p.conditions,
 			p.description,
+			p.priority,
+			p.not_before,
+			p.not_after,
+			p.version,
 			subject.template AS subject,
 			resource.template AS resource,
 			action.template AS action
@@ -216,8 +465,28 @@ var Migrations = map[string]Statements{
 			LEFT JOIN ladon_action AS action ON ra.action = action.id
 			LEFT JOIN ladon_resource AS resource ON rr.resource = resource.id
 		WHERE
-			(subject.has_regex = 0 AND subject.template = ?)
-			OR
-			(subject.has_regex = 1 AND ? REGEXP BINARY subject.compiled)`,
+			(
+				(subject.has_regex = 0 AND subject.template = ?)
+				OR
+				(subject.has_regex = 1 AND ? REGEXP subject.compiled)
+			)
+			AND EXISTS (
+				SELECT 1 FROM ladon_policy_action_rel AS fra INNER JOIN ladon_action AS fa ON fra.action = fa.id
+				WHERE fra.policy = p.id AND (
+					(fa.has_regex = 0 AND fa.template = ?)
+					OR
+					(fa.has_regex = 1 AND ? REGEXP fa.compiled)
+				)
+			)
+			AND EXISTS (
+				SELECT 1 FROM ladon_policy_resource_rel AS frr INNER JOIN ladon_resource AS fr ON frr.resource = fr.id
+				WHERE frr.policy = p.id AND (
+					(fr.has_regex = 0 AND fr.template = ?)
+					OR
+					(fr.has_regex = 1 AND ? REGEXP fr.compiled)
+				)
+			)
+			AND (p.not_before IS NULL OR p.not_before <= ?)
+			AND (p.not_after IS NULL OR p.not_after >= ?)`,
 	},
 }
@@ -0,0 +1,373 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package sql
+
+import (
+	"database/sql"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	. "github.com/ory/ladon"
+	"github.com/ory/pagination"
+	"github.com/pkg/errors"
+)
+
+// The operations recorded in the history of a policy.
+const (
+	OperationCreate  = "create"
+	OperationUpdate  = "update"
+	OperationDelete  = "delete"
+	OperationRestore = "restore"
+)
+
+// Revision is a change of a policy, as recorded in its history.
+type Revision struct {
+	// Policy is the ID of the policy which was changed.
+	Policy string `json:"policy"`
+
+	// Revision numbers the changes of a policy, starting at 1.
+	Revision int64 `json:"revision"`
+
+	// Operation is one of OperationCreate, OperationUpdate, OperationDelete and OperationRestore.
+	Operation string `json:"operation"`
+
+	// Author is who made the change, see WithAuthor.
+	Author string `json:"author"`
+
+	// CreatedAt is when the change was made.
+	CreatedAt time.Time `json:"created_at"`
+
+	// Before is the policy before the change, or nil if it did not exist.
+	Before *DefaultPolicy `json:"before"`
+
+	// After is the policy after the change, or nil if it was deleted.
+	After *DefaultPolicy `json:"after"`
+}
+
+// WithAuthor returns a manager using the same database as s which records author as the author of the changes made
+// through it, e.g. the user calling an API.
+func (s *SQLManager) WithAuthor(author string) *SQLManager {
+	c := *s
+	c.author = author
+	return &c
+}
+
+// lockAttempts is how often lock tries to lock a policy which is replaced concurrently.
+const lockAttempts = 10
+
+// lock locks the row of a policy until the transaction ends. Changes to a policy lock it before reading it, so that
+// concurrent changes are serialized and number their revisions consecutively. SQLite locks the whole database instead.
+// If the policy does not exist, nothing is locked.
+func (s *SQLManager) lock(tx *sqlx.Tx, id string) error {
+	for i := 0; i < lockAttempts; i++ {
+		var ids []string
+		if err := tx.Select(&ids, s.db.Rebind(Migrations[s.database].QueryLockPolicy), id); err != nil {
+			return errors.WithStack(err)
+		} else if len(ids) > 0 || s.database == "sqlite3" {
+			// SQLite's statement returns no rows, but the policy can not be replaced while the database is locked.
+			return nil
+		}
+
+		// If a concurrent transaction replaced the row while waiting for the lock, no row is locked although the
+		// policy exists. Try again to lock the new row.
+		var count int
+		if err := tx.Get(&count, s.db.Rebind("SELECT COUNT(*) FROM ladon_policy WHERE id = ?"), id); err != nil {
+			return errors.WithStack(err)
+		} else if count == 0 {
+			return nil
+		}
+	}
+	return errors.Errorf("Could not lock policy %s as it was replaced concurrently %d times", id, lockAttempts)
+}
+
+// record appends a revision to the history of a policy and logs the change for Watch. before is the policy before the
+// change, the policy after the change is read from the transaction. Unless the policy was just inserted, it must have
+// been locked using lock.
+func (s *SQLManager) record(tx *sqlx.Tx, operation, id string, before *DefaultPolicy) error {
+	after, err := s.find(tx, id)
+	if err != nil {
+		return err
+	}
+
+	var revision int64
+	if err := tx.Get(&revision, s.db.Rebind("SELECT COALESCE(MAX(revision), 0) FROM ladon_policy_revision WHERE policy = ?"), id); err != nil {
+		return errors.WithStack(err)
+	}
+
+	oldPolicy, err := marshalRevision(before)
+	if err != nil {
+		return err
+	}
+
+	newPolicy, err := marshalRevision(after)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(
+		s.db.Rebind("INSERT INTO ladon_policy_revision (policy, revision, operation, author, created_at, old_policy, new_policy) VALUES (?, ?, ?, ?, ?, ?, ?)"),
+		id, revision+1, operation, s.author, time.Now().UnixNano(), oldPolicy, newPolicy,
+	); err != nil {
+		return errors.WithStack(err)
+	}
+
+	event := PolicyUpdated
+	if before == nil {
+		event = PolicyCreated
+	} else if after == nil {
+		event = PolicyDeleted
+	}
+	return s.logChange(tx, event, id)
+}
+
+// recordBaselines records a revision creating each policy which has no history, so that AsOf includes the policies
+// which were stored before the history table was created. As the time they were created at is unknown, the revision
+// is dated to the beginning of unix time.
+func (s *SQLManager) recordBaselines() error {
+	return s.transaction(func(tx *sqlx.Tx) error {
+		var ids []string
+		if err := tx.Select(&ids, "SELECT id FROM ladon_policy WHERE NOT EXISTS (SELECT 1 FROM ladon_policy_revision WHERE policy = ladon_policy.id)"); err != nil {
+			return errors.WithStack(err)
+		}
+
+		for _, id := range ids {
+			p, err := s.find(tx, id)
+			if err != nil {
+				return err
+			} else if p == nil {
+				continue
+			}
+
+			newPolicy, err := marshalRevision(p)
+			if err != nil {
+				return err
+			}
+
+			if _, err := tx.Exec(
+				s.db.Rebind("INSERT INTO ladon_policy_revision (policy, revision, operation, author, created_at, old_policy, new_policy) VALUES (?, ?, ?, ?, ?, ?, ?)"),
+				id, 1, OperationCreate, "", 0, nil, newPolicy,
+			); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+		return nil
+	})
+}
+
+func marshalRevision(p *DefaultPolicy) (sql.NullString, error) {
+	if p == nil {
+		return sql.NullString{}, nil
+	}
+
+	out, err := json.Marshal(p)
+	if err != nil {
+		return sql.NullString{}, errors.WithStack(err)
+	}
+	return sql.NullString{String: string(out), Valid: true}, nil
+}
+
+func unmarshalRevision(data sql.NullString) (*DefaultPolicy, error) {
+	if !data.Valid {
+		return nil, nil
+	}
+
+	var p DefaultPolicy
+	if err := json.Unmarshal([]byte(data.String), &p); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return &p, nil
+}
+
+const revisionColumns = "policy, revision, operation, author, created_at, old_policy, new_policy"
+
+func scanRevisions(rows *sql.Rows) ([]*Revision, error) {
+	var revisions []*Revision
+	for rows.Next() {
+		var r Revision
+		var createdAt int64
+		var oldPolicy, newPolicy sql.NullString
+		if err := rows.Scan(&r.Policy, &r.Revision, &r.Operation, &r.Author, &createdAt, &oldPolicy, &newPolicy); err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		var err error
+		r.CreatedAt = time.Unix(0, createdAt).UTC()
+		if r.Before, err = unmarshalRevision(oldPolicy); err != nil {
+			return nil, err
+		} else if r.After, err = unmarshalRevision(newPolicy); err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, &r)
+	}
+	return revisions, errors.WithStack(rows.Err())
+}
+
+// Revisions returns the history of a policy, oldest revision first. The history of a policy which was stored before
+// the history table was created starts with a baseline revision created by CreateSchemas, which is dated to the
+// beginning of unix time.
+func (s *SQLManager) Revisions(id string, limit, offset int64) ([]*Revision, error) {
+	rows, err := s.db.Query(s.db.Rebind("SELECT "+revisionColumns+" FROM ladon_policy_revision WHERE policy = ? ORDER BY revision LIMIT ? OFFSET ?"), id, limit, offset)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer rows.Close()
+
+	return scanRevisions(rows)
+}
+
+// Restore sets a policy back to how it was after the given revision. This is recorded as a new revision, so restoring
+// can be undone as well. If the revision deleted the policy, restoring it deletes the policy.
+func (s *SQLManager) Restore(id string, revision int64) error {
+	return s.transaction(func(tx *sqlx.Tx) error {
+		if err := s.lock(tx, id); err != nil {
+			return err
+		}
+
+		rows, err := tx.Query(s.db.Rebind("SELECT "+revisionColumns+" FROM ladon_policy_revision WHERE policy = ? AND revision = ?"), id, revision)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		revisions, err := scanRevisions(rows)
+		rows.Close()
+		if err != nil {
+			return err
+		} else if len(revisions) == 0 {
+			return NewErrResourceNotFound(errors.Errorf("Revision %d of policy %s does not exist", revision, id))
+		}
+
+		before, err := s.find(tx, id)
+		if err != nil {
+			return err
+		}
+
+		restored := revisions[0].After
+		switch {
+		case restored == nil && before == nil:
+			return nil
+		case restored == nil:
+			err = s.delete(id, tx)
+		case before == nil:
+			err = s.create(restored, 1, tx)
+		default:
+			err = s.replace(restored, 0, false, tx)
+		}
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		return s.record(tx, OperationRestore, id, before)
+	})
+}
+
+// AsOf returns a read-only view of the policies as they were at t, according to their history. Policies whose
+// history started after t are not part of it, while policies with a baseline revision (see Revisions) are.
+func (s *SQLManager) AsOf(t time.Time) (*PointInTimeManager, error) {
+	rows, err := s.db.Query(s.db.Rebind(`SELECT r.new_policy FROM ladon_policy_revision AS r
+WHERE r.new_policy IS NOT NULL AND r.revision = (
+	SELECT MAX(h.revision) FROM ladon_policy_revision AS h WHERE h.policy = r.policy AND h.created_at <= ?
+)`), t.UnixNano())
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer rows.Close()
+
+	var policies Policies
+	for rows.Next() {
+		var data sql.NullString
+		if err := rows.Scan(&data); err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		p, err := unmarshalRevision(data)
+		if err != nil {
+			return nil, err
+		}
+		policies = append(policies, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return NewPointInTimeManager(t, policies), nil
+}
+
+// PointInTimeManager is a read-only Manager serving the policies as they were at a point in time, see
+// SQLManager.AsOf. To evaluate requests as they would have been evaluated back then, use a Ladon whose Clock returns
+// the same time, so that the validity periods of the policies and time based conditions such as TimeWindowCondition
+// are checked against it as well. Conditions with their own Clock and conditions depending on other data, such as the
+// roles of a subject, are not reproduced:
+//
+//	view, err := m.AsOf(t)
+//	// ...
+//	warden := &ladon.Ladon{Manager: view, Clock: func() time.Time { return t }}
+type PointInTimeManager struct {
+	// Time is the point in time the policies are served of.
+	Time time.Time
+
+	// policies are ordered by their ID.
+	policies Policies
+}
+
+// NewPointInTimeManager returns a read-only Manager serving policies, which were in effect at t.
+func NewPointInTimeManager(t time.Time, policies Policies) *PointInTimeManager {
+	ps := append(Policies{}, policies...)
+	sort.Slice(ps, func(i, j int) bool { return ps[i].GetID() < ps[j].GetID() })
+	return &PointInTimeManager{Time: t, policies: ps}
+}
+
+// Create returns ErrReadOnly.
+func (m *PointInTimeManager) Create(policy Policy) error {
+	return errors.WithStack(ErrReadOnly)
+}
+
+// Update returns ErrReadOnly.
+func (m *PointInTimeManager) Update(policy Policy) error {
+	return errors.WithStack(ErrReadOnly)
+}
+
+// Delete returns ErrReadOnly.
+func (m *PointInTimeManager) Delete(id string) error {
+	return errors.WithStack(ErrReadOnly)
+}
+
+// Get retrieves a policy.
+func (m *PointInTimeManager) Get(id string) (Policy, error) {
+	i := sort.Search(len(m.policies), func(i int) bool { return m.policies[i].GetID() >= id })
+	if i == len(m.policies) || m.policies[i].GetID() != id {
+		return nil, NewErrResourceNotFound(sql.ErrNoRows)
+	}
+	return m.policies[i], nil
+}
+
+// GetAll returns all policies ordered by their ID.
+func (m *PointInTimeManager) GetAll(limit, offset int64) (Policies, error) {
+	start, end := pagination.Index(int(limit), int(offset), len(m.policies))
+	return m.policies[start:end], nil
+}
+
+// FindRequestCandidates returns all policies, which is a superset of the policies matching the request. Whether they
+// were within their validity period at Time is decided by the warden, see the example above.
+func (m *PointInTimeManager) FindRequestCandidates(r *Request) (Policies, error) {
+	return m.policies, nil
+}
@@ -0,0 +1,76 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+// Package sqlite registers a SQLite database/sql driver which can be used with sql.SQLManager and store.StoreManager.
+// It wraps github.com/mattn/go-sqlite3, which requires cgo, and adds the REGEXP function the managers use to match
+// templates. Foreign keys are enforced on every connection, so deleting a policy removes its relations.
+//
+//	import (
+//		"github.com/ory/ladon/manager/sql"
+//		"github.com/ory/ladon/manager/sql/sqlite"
+//	)
+//
+//	db, err := sqlx.Open(sqlite.DriverName, "/var/lib/ladon/policies.db?_busy_timeout=5000")
+//	// if err != nil ...
+//	m := sql.NewSQLManager(db, nil)
+//	_, err = m.CreateSchemas("", "")
+//
+// Every connection to ":memory:" opens a new, empty database. Use a file, or limit the pool to a single connection
+// using db.SetMaxOpenConns(1).
+package sqlite
+
+import (
+	"database/sql"
+	"regexp"
+
+	"github.com/hashicorp/golang-lru"
+	"github.com/mattn/go-sqlite3"
+)
+
+// DriverName is the name the driver is registered as.
+const DriverName = "sqlite3_ladon"
+
+// regexps caches the compiled regular expressions of all connections.
+var regexps, _ = lru.New(512)
+
+func init() {
+	sql.Register(DriverName, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			if _, err := conn.Exec("PRAGMA foreign_keys = ON", nil); err != nil {
+				return err
+			}
+			return conn.RegisterFunc("regexp", match, true)
+		},
+	})
+}
+
+// match implements "value REGEXP pattern".
+func match(pattern, value string) (bool, error) {
+	if re, ok := regexps.Get(pattern); ok {
+		return re.(*regexp.Regexp).MatchString(value), nil
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return false, err
+	}
+	regexps.Add(pattern, re)
+	return re.MatchString(value), nil
+}
@@ -0,0 +1,60 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package sqlite
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDriver(t *testing.T) {
+	db, err := sql.Open(DriverName, ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	for _, c := range []struct {
+		value, pattern string
+		matches        bool
+	}{
+		{value: "articles:1", pattern: "^articles:[0-9]+$", matches: true},
+		{value: "articles:a", pattern: "^articles:[0-9]+$", matches: false},
+		{value: "xarticles:1", pattern: "^articles:[0-9]+$", matches: false},
+		{value: "articles:12:comments", pattern: "^articles:[0-9]+$", matches: false},
+	} {
+		var matches bool
+		require.NoError(t, db.QueryRow("SELECT ? REGEXP ?", c.value, c.pattern).Scan(&matches))
+		assert.Equal(t, c.matches, matches, "%s %s", c.value, c.pattern)
+	}
+
+	var matches bool
+	assert.Error(t, db.QueryRow("SELECT 'a' REGEXP '('").Scan(&matches))
+
+	_, err = db.Exec("CREATE TABLE parent (id text PRIMARY KEY)")
+	require.NoError(t, err)
+	_, err = db.Exec("CREATE TABLE child (parent text REFERENCES parent(id) ON DELETE CASCADE)")
+	require.NoError(t, err)
+	_, err = db.Exec("INSERT INTO child (parent) VALUES ('unknown')")
+	assert.Error(t, err, "foreign keys are enforced")
+}
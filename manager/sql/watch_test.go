@@ -0,0 +1,60 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package sql
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChangeFeedAdvance(t *testing.T) {
+	now := time.Now()
+	f := &changeFeed{last: 10, seen: map[int64]bool{}}
+
+	f.seen[11], f.seen[12] = true, true
+	f.advance(now)
+	assert.EqualValues(t, 12, f.last)
+	assert.Empty(t, f.seen)
+	assert.True(t, f.gapSince.IsZero())
+
+	// 13 is missing, e.g. because its transaction is not committed yet.
+	f.seen[14], f.seen[16] = true, true
+	f.advance(now)
+	assert.EqualValues(t, 12, f.last)
+	assert.Equal(t, now, f.gapSince)
+
+	// 13 is committed within the timeout, 15 is missing now.
+	f.seen[13] = true
+	f.advance(now.Add(time.Second))
+	assert.EqualValues(t, 14, f.last)
+	assert.Equal(t, now.Add(time.Second), f.gapSince)
+
+	f.advance(now.Add(watchGapTimeout))
+	assert.EqualValues(t, 14, f.last)
+
+	// 15 was rolled back.
+	f.advance(now.Add(time.Second + watchGapTimeout))
+	assert.EqualValues(t, 16, f.last)
+	assert.Empty(t, f.seen)
+	assert.True(t, f.gapSince.IsZero())
+}
@@ -21,44 +21,127 @@
 package ladon_test
 
 import (
+	"context"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
 	"sync"
 	"testing"
+	"time"
 
+	"github.com/jmoiron/sqlx"
 	. "github.com/ory/ladon"
 	"github.com/ory/ladon/integration"
+	"github.com/ory/ladon/manager/cache"
+	"github.com/ory/ladon/manager/index"
 	. "github.com/ory/ladon/manager/memory"
+	"github.com/ory/ladon/manager/rbac/store"
 	. "github.com/ory/ladon/manager/sql"
+	"github.com/ory/ladon/manager/sql/sqlite"
+	"github.com/pborman/uuid"
+	"github.com/pkg/errors"
+	"github.com/rubenv/sql-migrate"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
 var managers = map[string]Manager{}
 var migrators = map[string]ManagerMigrator{}
+var sqliteDir string
 
 func TestMain(m *testing.M) {
 	var wg sync.WaitGroup
-	wg.Add(3)
-	connectMySQL(&wg)
-	connectPG(&wg)
+	wg.Add(2)
 	connectMEM(&wg)
+	connectSQLite(&wg)
+	if err := integration.DockerAvailable(); err != nil {
+		log.Printf("Skipping the mysql and postgres managers because docker is not available: %v", err)
+	} else {
+		wg.Add(2)
+		connectMySQL(&wg)
+		connectPG(&wg)
+	}
 	wg.Wait()
 
 	s := m.Run()
 	integration.KillAll()
+	os.RemoveAll(sqliteDir)
 	os.Exit(s)
 }
 
+// pick returns the managers with the given names which are available.
+func pick(names ...string) map[string]Manager {
+	picked := map[string]Manager{}
+	for _, name := range names {
+		if m, ok := managers[name]; ok {
+			picked[name] = m
+		}
+	}
+	return picked
+}
+
 func connectMEM(wg *sync.WaitGroup) {
 	defer wg.Done()
 	managers["memory"] = NewMemoryManager()
+
+	indexed, err := index.NewIndexedManager(NewMemoryManager())
+	if err != nil {
+		log.Fatalf("Could not create indexed manager: %v", err)
+	}
+	managers["indexed"] = indexed
+
+	managers["cache"] = cache.NewCacheManager(NewMemoryManager(), 0, time.Minute)
+}
+
+func connectSQLite(wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	var err error
+	sqliteDir, err = ioutil.TempDir("", "ladon-sqlite")
+	if err != nil {
+		log.Fatalf("Could not create sqlite directory: %v", err)
+	}
+
+	open := func(name string) *sqlx.DB {
+		db, err := sqlx.Open(sqlite.DriverName, filepath.Join(sqliteDir, name)+"?_busy_timeout=5000")
+		if err != nil {
+			log.Fatalf("Could not open sqlite database: %v", err)
+		}
+		return db
+	}
+
+	db := open("sql.db")
+	s := NewSQLManager(db, nil)
+	s.WatchInterval = 10 * time.Millisecond
+	if _, err := s.CreateSchemas("", ""); err != nil {
+		log.Fatalf("Could not create sqlite schema: %v", err)
+	}
+	managers["sqlite"] = s
+	migrators["sqlite"] = &SQLManagerMigrateFromMajor0Minor6ToMajor0Minor7{
+		DB:         db,
+		SQLManager: s,
+	}
+
+	db = open("store.db")
+	st := store.NewStoreManager(db, nil)
+	st.WatchInterval = 10 * time.Millisecond
+	if _, err := st.CreateSchemas("", ""); err != nil {
+		log.Fatalf("Could not create sqlite schema: %v", err)
+	}
+	managers["sqlite-store"] = st
+	migrators["sqlite-store"] = &store.StoreManagerMigrateFromMajor0Minor6ToMajor0Minor7{
+		DB:           db,
+		StoreManager: st,
+	}
 }
 
 func connectPG(wg *sync.WaitGroup) {
 	defer wg.Done()
 	var db = integration.ConnectToPostgres("ladon")
 	s := NewSQLManager(db, nil)
+	s.WatchInterval = 10 * time.Millisecond
 	if _, err := s.CreateSchemas("", ""); err != nil {
 		log.Fatalf("Could not create postgres schema: %v", err)
 	}
@@ -74,6 +157,7 @@ func connectMySQL(wg *sync.WaitGroup) {
 	defer wg.Done()
 	var db = integration.ConnectToMySQL()
 	s := NewSQLManager(db, nil)
+	s.WatchInterval = 10 * time.Millisecond
 	if _, err := s.CreateSchemas("", ""); err != nil {
 		log.Fatalf("Could not create mysql schema: %v", err)
 	}
@@ -99,19 +183,33 @@ func TestManagers(t *testing.T) {
 	})
 
 	t.Run("type=find", func(t *testing.T) {
-		for k, s := range map[string]Manager{
-			"postgres": managers["postgres"],
-			"mysql":    managers["mysql"],
-		} {
+		for k, s := range pick("postgres", "mysql", "memory", "indexed", "cache", "sqlite", "sqlite-store") {
 			t.Run(fmt.Sprintf("manager=%s", k), TestHelperFindPoliciesForSubject(k, s))
 		}
 	})
 
+	t.Run("type=find by request", func(t *testing.T) {
+		for k, s := range pick("postgres", "mysql", "sqlite", "sqlite-store", "indexed") {
+			t.Run(fmt.Sprintf("manager=%s", k), TestHelperFindPoliciesForRequest(k, s))
+		}
+	})
+
+	t.Run("type=update if match", func(t *testing.T) {
+		for k, s := range managers {
+			if vm, ok := s.(VersionedManager); ok {
+				t.Run(fmt.Sprintf("manager=%s", k), TestHelperUpdateIfMatch(k, vm))
+			}
+		}
+	})
+
+	t.Run("type=watch", func(t *testing.T) {
+		for k, s := range pick("postgres", "mysql", "memory", "sqlite", "sqlite-store") {
+			t.Run(fmt.Sprintf("manager=%s", k), TestHelperWatch(k, s))
+		}
+	})
+
 	t.Run("type=migrate 6 to 7", func(t *testing.T) {
-		for k, s := range map[string]ManagerMigrator{
-			"postgres": migrators["postgres"],
-			"mysql":    migrators["mysql"],
-		} {
+		for k, s := range migrators {
 			t.Run(fmt.Sprintf("manager=%s", k), func(t *testing.T) {
 
 				// This create part is only necessary to populate the data store with some values. If you
@@ -138,3 +236,304 @@ func TestManagers(t *testing.T) {
 		}
 	})
 }
+
+func TestSQLManagerHistory(t *testing.T) {
+	for _, k := range []string{"postgres", "mysql", "sqlite"} {
+		m, ok := managers[k].(*SQLManager)
+		if !ok {
+			continue
+		}
+
+		t.Run("manager="+k, func(t *testing.T) {
+			id := uuid.New()
+			policy := func(description string) *DefaultPolicy {
+				return &DefaultPolicy{
+					ID:          id,
+					Description: description,
+					Subjects:    []string{"peter"},
+					Effect:      AllowAccess,
+					Resources:   []string{"articles:1"},
+					Actions:     []string{"view"},
+					Conditions:  Conditions{},
+				}
+			}
+			request := &Request{Subject: "peter", Action: "view", Resource: "articles:1"}
+
+			before := time.Now()
+			require.NoError(t, m.WithAuthor("alice").Create(policy("created")))
+			created := time.Now()
+			require.NoError(t, m.WithAuthor("bob").Update(policy("updated")))
+			updated := time.Now()
+			require.NoError(t, m.WithAuthor("alice").Delete(id))
+			defer m.Delete(id)
+
+			revisions, err := m.Revisions(id, 10, 0)
+			require.NoError(t, err)
+			require.Len(t, revisions, 3)
+			for i, c := range []struct {
+				operation, author, before, after string
+			}{
+				{operation: OperationCreate, author: "alice", after: "created"},
+				{operation: OperationUpdate, author: "bob", before: "created", after: "updated"},
+				{operation: OperationDelete, author: "alice", before: "updated"},
+			} {
+				r := revisions[i]
+				assert.EqualValues(t, i+1, r.Revision)
+				assert.Equal(t, c.operation, r.Operation)
+				assert.Equal(t, c.author, r.Author)
+				assert.False(t, r.CreatedAt.Before(before.Truncate(time.Microsecond)))
+
+				for _, p := range []struct {
+					description string
+					got         *DefaultPolicy
+				}{{c.before, r.Before}, {c.after, r.After}} {
+					if p.description == "" {
+						assert.Nil(t, p.got, "%d", i)
+					} else {
+						require.NotNil(t, p.got, "%d", i)
+						AssertPolicyEqual(t, policy(p.description), p.got)
+					}
+				}
+			}
+
+			for _, c := range []struct {
+				at          time.Time
+				description string
+			}{
+				{at: before},
+				{at: created, description: "created"},
+				{at: updated, description: "updated"},
+				{at: time.Now()},
+			} {
+				view, err := m.AsOf(c.at)
+				require.NoError(t, err)
+				warden := &Ladon{Manager: view, Clock: func() time.Time { return c.at }}
+
+				get, err := view.Get(id)
+				if c.description == "" {
+					assert.Error(t, err)
+					assert.Error(t, warden.IsAllowed(request))
+					continue
+				}
+				require.NoError(t, err)
+				assert.Equal(t, c.description, get.GetDescription())
+				assert.NoError(t, warden.IsAllowed(request))
+				assert.Equal(t, ErrReadOnly, errors.Cause(view.Update(policy("read-only"))))
+			}
+
+			require.NoError(t, m.Restore(id, 1))
+			get, err := m.Get(id)
+			require.NoError(t, err)
+			assert.Equal(t, "created", get.GetDescription())
+
+			require.NoError(t, m.Restore(id, 2))
+			get, err = m.Get(id)
+			require.NoError(t, err)
+			assert.Equal(t, "updated", get.GetDescription())
+			assert.EqualValues(t, 2, get.(*DefaultPolicy).Version)
+
+			revisions, err = m.Revisions(id, 10, 3)
+			require.NoError(t, err)
+			require.Len(t, revisions, 2)
+			assert.Equal(t, OperationRestore, revisions[1].Operation)
+			assert.Equal(t, "created", revisions[1].Before.Description)
+
+			assert.Error(t, m.Restore(id, 10))
+		})
+	}
+}
+
+func TestSQLManagerHistoryBaseline(t *testing.T) {
+	db, err := sqlx.Open(sqlite.DriverName, filepath.Join(sqliteDir, "baseline.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	s := NewSQLManager(db, nil)
+	_, err = s.CreateSchemas("", "")
+	require.NoError(t, err)
+	p := &DefaultPolicy{
+		ID:         "baseline",
+		Subjects:   []string{"peter"},
+		Actions:    []string{"view"},
+		Resources:  []string{"articles:1"},
+		Effect:     AllowAccess,
+		Conditions: Conditions{},
+	}
+	require.NoError(t, s.Create(p))
+
+	// Migrations 7 and later create the history, so the policy was stored before it existed.
+	source := Migrations["sqlite3"].Migrations
+	_, err = migrate.ExecMax(db.DB, "sqlite3", source, migrate.Down, 3)
+	require.NoError(t, err)
+	_, err = s.CreateSchemas("", "")
+	require.NoError(t, err)
+
+	revisions, err := s.Revisions(p.ID, 10, 0)
+	require.NoError(t, err)
+	require.Len(t, revisions, 1)
+	assert.Equal(t, OperationCreate, revisions[0].Operation)
+	assert.Nil(t, revisions[0].Before)
+	AssertPolicyEqual(t, p, revisions[0].After)
+
+	view, err := s.AsOf(time.Date(2018, 3, 1, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	get, err := view.Get(p.ID)
+	require.NoError(t, err)
+	AssertPolicyEqual(t, p, get)
+
+	// The baseline is only recorded once.
+	_, err = s.CreateSchemas("", "")
+	require.NoError(t, err)
+	revisions, err = s.Revisions(p.ID, 10, 0)
+	require.NoError(t, err)
+	assert.Len(t, revisions, 1)
+}
+
+func TestSQLManagerWatchWithoutSchema(t *testing.T) {
+	db, err := sqlx.Open(sqlite.DriverName, filepath.Join(sqliteDir, "watch.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	// The change log does not exist, so the watch can not be started.
+	events, err := NewSQLManager(db, nil).Watch(context.Background())
+	assert.Error(t, err)
+	assert.Nil(t, events)
+}
+
+func TestSQLManagerHasRegex(t *testing.T) {
+	db, err := sqlx.Open(sqlite.DriverName, filepath.Join(sqliteDir, "has_regex.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	s := NewSQLManager(db, nil)
+	_, err = s.CreateSchemas("", "")
+	require.NoError(t, err)
+	require.NoError(t, s.Create(&DefaultPolicy{
+		ID:        "has-regex",
+		Subjects:  []string{"peter", "users:<.*>"},
+		Actions:   []string{"view"},
+		Resources: []string{"articles.1"},
+		Effect:    AllowAccess,
+	}))
+
+	hasRegex := func() map[string]bool {
+		rows, err := db.Query("SELECT template, has_regex FROM ladon_subject UNION SELECT template, has_regex FROM ladon_resource")
+		require.NoError(t, err)
+		defer rows.Close()
+
+		templates := map[string]bool{}
+		for rows.Next() {
+			var template string
+			var has bool
+			require.NoError(t, rows.Scan(&template, &has))
+			templates[template] = has
+		}
+		require.NoError(t, rows.Err())
+		return templates
+	}
+	assert.Equal(t, map[string]bool{"peter": false, "users:<.*>": true, "articles.1": false}, hasRegex())
+
+	// Migration 9 recomputes the flag of templates stored by previous versions.
+	source := Migrations["sqlite3"].Migrations
+	_, err = migrate.ExecMax(db.DB, "sqlite3", source, migrate.Down, 1)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{"peter": true, "users:<.*>": true, "articles.1": true}, hasRegex())
+
+	// Templates whose characters were escaped in the regular expression keep matching it, which is equivalent.
+	_, err = migrate.Exec(db.DB, "sqlite3", source, migrate.Up)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{"peter": false, "users:<.*>": true, "articles.1": true}, hasRegex())
+
+	for subject, found := range map[string]bool{"peter": true, "users:1": true, "Peter": false} {
+		policies, err := s.FindRequestCandidates(&Request{Subject: subject, Action: "view", Resource: "articles.1"})
+		require.NoError(t, err)
+		assert.Equal(t, found, len(policies) == 1, "%s", subject)
+	}
+
+	policies, err := s.FindRequestCandidates(&Request{Subject: "peter", Action: "view", Resource: "articlesX1"})
+	require.NoError(t, err)
+	assert.Empty(t, policies)
+}
+
+func TestSQLManagerValidityPeriod(t *testing.T) {
+	notBefore := time.Date(2018, 3, 1, 0, 0, 0, 0, time.UTC)
+	notAfter := time.Date(9999, 12, 31, 23, 59, 59, 999999000, time.UTC)
+
+	for k, m := range pick("postgres", "mysql", "sqlite", "sqlite-store") {
+		t.Run(fmt.Sprintf("manager=%s", k), func(t *testing.T) {
+			p := &DefaultPolicy{
+				ID:         uuid.New(),
+				Subjects:   []string{"validity-period"},
+				Actions:    []string{"view"},
+				Resources:  []string{"articles:1"},
+				Effect:     AllowAccess,
+				Conditions: Conditions{},
+				NotBefore:  &notBefore,
+				NotAfter:   &notAfter,
+			}
+			require.NoError(t, m.Create(p))
+			defer m.Delete(p.ID)
+
+			for at, found := range map[time.Time]bool{
+				notBefore.Add(-time.Microsecond): false,
+				notBefore:                        true,
+				time.Now():                       true,
+				notAfter:                         true,
+				notAfter.Add(time.Microsecond):   false,
+			} {
+				r := &Request{Subject: "validity-period", Action: "view", Resource: "articles:1"}
+				policies, err := NewContextManager(m).FindRequestCandidatesContext(WithEvaluationTime(context.Background(), at), r)
+				require.NoError(t, err)
+				require.Equal(t, found, len(policies) == 1, "%s", at)
+				if found {
+					AssertPolicyEqual(t, p, policies[0])
+				}
+
+				w := &Ladon{Manager: m, Clock: func() time.Time { return at }}
+				assert.Equal(t, found, w.IsAllowed(r) == nil, "%s", at)
+			}
+		})
+	}
+}
+
+func TestSQLManagerConcurrentRevisions(t *testing.T) {
+	for _, k := range []string{"postgres", "mysql", "sqlite"} {
+		m, ok := managers[k].(*SQLManager)
+		if !ok {
+			continue
+		}
+
+		t.Run("manager="+k, func(t *testing.T) {
+			id := uuid.New()
+			policy := &DefaultPolicy{ID: id, Subjects: []string{"peter"}, Effect: AllowAccess, Resources: []string{"articles:1"}, Actions: []string{"view"}}
+			require.NoError(t, m.Create(policy))
+			defer m.Delete(id)
+
+			var wg sync.WaitGroup
+			errs := make(chan error, 10)
+			for i := 0; i < 10; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					errs <- m.Update(policy)
+				}()
+			}
+			wg.Wait()
+			close(errs)
+			for err := range errs {
+				assert.NoError(t, err)
+			}
+
+			revisions, err := m.Revisions(id, 20, 0)
+			require.NoError(t, err)
+			require.Len(t, revisions, 11)
+			for i, r := range revisions {
+				assert.EqualValues(t, i+1, r.Revision)
+			}
+
+			get, err := m.Get(id)
+			require.NoError(t, err)
+			assert.EqualValues(t, 11, get.(*DefaultPolicy).Version)
+		})
+	}
+}
@@ -21,9 +21,12 @@
 package ladon
 
 import (
+	"context"
 	"fmt"
 	"reflect"
+	"sort"
 	"testing"
+	"time"
 
 	"github.com/pborman/uuid"
 	"github.com/pkg/errors"
@@ -31,6 +34,12 @@ import (
 	"github.com/stretchr/testify/require"
 )
 
+var (
+	testNotBefore = time.Date(2018, 3, 1, 0, 0, 0, 123456000, time.UTC)
+	testNotAfter  = time.Date(9999, 12, 31, 23, 59, 59, 999999000, time.UTC)
+	testExpired   = time.Date(2018, 3, 31, 0, 0, 0, 0, time.UTC)
+)
+
 var TestManagerPolicies = []*DefaultPolicy{
 	{
 		ID:          uuid.New(),
@@ -154,6 +163,45 @@ var TestManagerPolicies = []*DefaultPolicy{
 			"owner": &EqualsSubjectCondition{},
 		},
 	},
+	{
+		ID:          uuid.New(),
+		Description: "description",
+		Subjects:    []string{"admin"},
+		Effect:      DenyAccess,
+		Resources:   []string{"<.*>"},
+		Actions:     []string{"delete"},
+		Conditions:  Conditions{},
+		Priority:    10,
+	},
+	{
+		ID:          uuid.New(),
+		Description: "description",
+		Subjects:    []string{"contractor"},
+		Effect:      AllowAccess,
+		Resources:   []string{"<.*>"},
+		Actions:     []string{"create"},
+		Conditions:  Conditions{},
+		NotBefore:   &testNotBefore,
+		NotAfter:    &testNotAfter,
+	},
+	{
+		ID:          uuid.New(),
+		Description: "description",
+		Subjects:    []string{"contractor"},
+		Effect:      AllowAccess,
+		Resources:   []string{"<.*>"},
+		Actions:     []string{"view"},
+		Conditions: Conditions{
+			"access": &OrCondition{Conditions: Conditions{
+				"ip": &CIDRCondition{
+					CIDR: "10.0.0.0/8",
+				},
+				"foreign": &NotCondition{Conditions: Conditions{
+					"owner": &EqualsSubjectCondition{},
+				}},
+			}},
+		},
+	},
 	//Two new policies which do not persist in MySQL correctly
 	{
 		ID:          uuid.New(),
@@ -227,6 +275,16 @@ var testPolicies = []*DefaultPolicy{
 			},
 		},
 	},
+	{
+		ID:          uuid.New(),
+		Description: "expired",
+		Subjects:    []string{"sqlexpired"},
+		Effect:      AllowAccess,
+		Resources:   []string{"master", "user", "article"},
+		Actions:     []string{"create", "update", "delete"},
+		Conditions:  Conditions{},
+		NotAfter:    &testExpired,
+	},
 }
 
 func TestHelperFindPoliciesForSubject(k string, s Manager) func(t *testing.T) {
@@ -262,6 +320,109 @@ func TestHelperFindPoliciesForSubject(k string, s Manager) func(t *testing.T) {
 		require.NoError(t, err)
 		require.Len(t, res, 1)
 		AssertPolicyEqual(t, testPolicies[0], res[0])
+
+		res, err = s.FindRequestCandidates(&Request{
+			Subject:  "sqlmatch",
+			Resource: "article",
+			Action:   "view",
+		})
+		require.NoError(t, err)
+		assert.Len(t, res, 0)
+
+		// Policies are candidates within their validity period, whose bounds are inclusive.
+		res, err = NewContextManager(s).FindRequestCandidatesContext(WithEvaluationTime(context.Background(), testExpired), &Request{
+			Subject:  "sqlexpired",
+			Resource: "article",
+			Action:   "create",
+		})
+		require.NoError(t, err)
+		var found bool
+		for _, p := range res {
+			if p.GetID() == testPolicies[len(testPolicies)-1].ID {
+				AssertPolicyEqual(t, testPolicies[len(testPolicies)-1], p)
+				found = true
+			}
+		}
+		assert.True(t, found)
+
+		res, err = s.FindRequestCandidates(&Request{
+			Subject:  "sqlmatch",
+			Resource: "comment",
+			Action:   "create",
+		})
+		require.NoError(t, err)
+		assert.Len(t, res, 0)
+	}
+}
+
+var testFilterPolicies = []*DefaultPolicy{
+	{
+		ID:         "filter-literal",
+		Subjects:   []string{"filter-subject"},
+		Effect:     AllowAccess,
+		Conditions: Conditions{},
+		Resources:  []string{"articles:1", "articles:2"},
+		Actions:    []string{"get"},
+	},
+	{
+		ID:         "filter-regex",
+		Subjects:   []string{"filter-<.*>"},
+		Effect:     AllowAccess,
+		Conditions: Conditions{},
+		Resources:  []string{"articles:<[0-9]+>"},
+		Actions:    []string{"<get|update>"},
+	},
+	{
+		ID:         "filter-other",
+		Subjects:   []string{"filter-subject"},
+		Effect:     AllowAccess,
+		Conditions: Conditions{},
+		Resources:  []string{"comments:<.*>"},
+		Actions:    []string{"<.*>"},
+	},
+}
+
+// TestHelperFindPoliciesForRequest checks that a manager only returns candidates whose subjects, actions and
+// resources each match the request.
+func TestHelperFindPoliciesForRequest(k string, s Manager) func(t *testing.T) {
+	return func(t *testing.T) {
+		for _, c := range testFilterPolicies {
+			require.NoError(t, s.Create(c))
+		}
+
+		for _, c := range []struct {
+			r        *Request
+			expected []string
+		}{
+			{r: &Request{Subject: "filter-subject", Action: "get", Resource: "articles:1"}, expected: []string{"filter-literal", "filter-regex"}},
+			{r: &Request{Subject: "filter-subject", Action: "update", Resource: "articles:3"}, expected: []string{"filter-regex"}},
+			{r: &Request{Subject: "filter-subject", Action: "delete", Resource: "articles:1"}, expected: []string{}},
+			{r: &Request{Subject: "filter-subject", Action: "delete", Resource: "comments:1"}, expected: []string{"filter-other"}},
+			{r: &Request{Subject: "filter-someone", Action: "get", Resource: "articles:a"}, expected: []string{}},
+		} {
+			res, err := s.FindRequestCandidates(c.r)
+			require.NoError(t, err)
+
+			ids := []string{}
+			for _, p := range res {
+				ids = append(ids, p.GetID())
+			}
+			sort.Strings(ids)
+			assert.Equal(t, c.expected, ids, "%s: %+v", k, c.r)
+		}
+
+		// The candidates are complete policies, not only the matching parts of them.
+		res, err := s.FindRequestCandidates(&Request{Subject: "filter-subject", Action: "get", Resource: "articles:2"})
+		require.NoError(t, err)
+		for _, p := range res {
+			if p.GetID() == "filter-literal" {
+				AssertPolicyEqual(t, testFilterPolicies[0], p)
+			}
+		}
+
+		for _, c := range testFilterPolicies {
+			require.NoError(t, s.Delete(c.ID))
+		}
 	}
 }
 
@@ -279,6 +440,28 @@ func AssertPolicyEqual(t *testing.T, expected, got Policy) {
 	assert.NoError(t, testEq(expected.GetResources(), got.GetResources()))
 	assert.NoError(t, testEq(expected.GetSubjects(), got.GetSubjects()))
 	assert.EqualValues(t, expected.GetConditions(), got.GetConditions())
+
+	if ep, ok := expected.(ValidityPolicy); ok {
+		gp, ok := got.(ValidityPolicy)
+		require.True(t, ok)
+		assertTimeEqual(t, ep.GetNotBefore(), gp.GetNotBefore())
+		assertTimeEqual(t, ep.GetNotAfter(), gp.GetNotAfter())
+	}
+
+	if ep, ok := expected.(PriorityPolicy); ok {
+		gp, ok := got.(PriorityPolicy)
+		require.True(t, ok)
+		assert.Equal(t, ep.GetPriority(), gp.GetPriority())
+	}
+}
+
+func assertTimeEqual(t *testing.T, expected, got *time.Time) {
+	if expected == nil {
+		assert.Nil(t, got)
+		return
+	}
+	require.NotNil(t, got)
+	assert.True(t, expected.Equal(*got), "expected %s but got %s", expected, got)
 }
 
 func testEq(a, b []string) error {
@@ -412,3 +595,103 @@ func TestHelperCreateGetDelete(s Manager) func(t *testing.T) {
 		}
 	}
 }
+
+func TestHelperUpdateIfMatch(k string, s VersionedManager) func(t *testing.T) {
+	return func(t *testing.T) {
+		id := uuid.New()
+		policy := func(description string) *DefaultPolicy {
+			return &DefaultPolicy{
+				ID:          id,
+				Description: description,
+				Subjects:    []string{"peter"},
+				Effect:      AllowAccess,
+				Resources:   []string{"articles:1"},
+				Actions:     []string{"view"},
+				Conditions:  Conditions{},
+			}
+		}
+
+		version := func() int64 {
+			get, err := s.Get(id)
+			require.NoError(t, err, k)
+			vp, ok := get.(VersionedPolicy)
+			require.True(t, ok, k)
+			return vp.GetVersion()
+		}
+
+		err := s.UpdateIfMatch(policy("missing"), 1)
+		require.Error(t, err, k)
+		assert.Equal(t, 404, errors.Cause(err).(interface {
+			StatusCode() int
+		}).StatusCode(), k)
+
+		require.NoError(t, s.Create(policy("created")), k)
+		defer s.Delete(id)
+		assert.EqualValues(t, 1, version(), k)
+
+		require.NoError(t, s.UpdateIfMatch(policy("first"), 1), k)
+		assert.EqualValues(t, 2, version(), k)
+
+		err = s.UpdateIfMatch(policy("second"), 1)
+		require.Error(t, err, k)
+		assert.Equal(t, ErrConflict, errors.Cause(err), k)
+
+		get, err := s.Get(id)
+		require.NoError(t, err, k)
+		assert.Equal(t, "first", get.GetDescription(), k)
+
+		require.NoError(t, s.Update(policy("third")), k)
+		assert.EqualValues(t, 3, version(), k)
+
+		require.NoError(t, s.UpdateIfMatch(policy("fourth"), 3), k)
+		get, err = s.Get(id)
+		require.NoError(t, err, k)
+		assert.Equal(t, "fourth", get.GetDescription(), k)
+		assert.EqualValues(t, 4, get.(VersionedPolicy).GetVersion(), k)
+	}
+}
+
+func TestHelperWatch(k string, s Manager) func(t *testing.T) {
+	return func(t *testing.T) {
+		w, ok := s.(Watcher)
+		require.True(t, ok, k)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		events, err := w.Watch(ctx)
+		require.NoError(t, err, k)
+
+		id := uuid.New()
+		policy := &DefaultPolicy{
+			ID:          id,
+			Description: "created",
+			Subjects:    []string{"peter"},
+			Effect:      AllowAccess,
+			Resources:   []string{"articles:1"},
+			Actions:     []string{"view"},
+			Conditions:  Conditions{},
+		}
+		require.NoError(t, s.Create(policy), k)
+		updated := *policy
+		updated.Description = "updated"
+		require.NoError(t, s.Update(&updated), k)
+		require.NoError(t, s.Delete(id), k)
+
+		for _, expected := range []PolicyEventType{PolicyCreated, PolicyUpdated, PolicyDeleted} {
+			select {
+			case e := <-events:
+				assert.Equal(t, expected, e.Type, k)
+				assert.Equal(t, id, e.ID, k)
+				if expected == PolicyDeleted {
+					assert.Nil(t, e.Policy, k)
+				}
+			case <-time.After(10 * time.Second):
+				t.Fatalf("%s: Timed out waiting for %s event", k, expected)
+			}
+		}
+
+		cancel()
+		for range events {
+		}
+	}
+}
@@ -20,8 +20,22 @@
 
 package ladon
 
-type matcher interface {
+import "strings"
+
+// Matcher decides whether a value of a request (subject, action or resource) matches one of the patterns of a
+// policy. Ladon ships with RegexpMatcher, which understands the regular expression templates enclosed in the
+// policy's delimiters, and GlobMatcher, which understands glob patterns.
+type Matcher interface {
+	// Matches returns true if the needle matches at least one of the patterns in haystack.
 	Matches(p Policy, haystack []string, needle string) (matches bool, error error)
 }
 
+// DefaultMatcher is the matcher used if Ladon.Matcher is not set.
 var DefaultMatcher = NewRegexpMatcher(512)
+
+// IsTemplated returns true if value might match other values than itself, either because it contains a regular
+// expression enclosed in delimiter or because it contains a glob wildcard (see GlobMatcher). Managers can look up
+// policies by the values for which it returns false, but need to consider the other values for every request.
+func IsTemplated(value string, delimiter byte) bool {
+	return strings.IndexByte(value, delimiter) >= 0 || strings.ContainsAny(value, "*?")
+}
@@ -0,0 +1,179 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultGlobSeparators are the separators used by NewGlobMatcher if none are given.
+const DefaultGlobSeparators = ":/"
+
+// GlobMatcher matches request values against glob patterns instead of regular expression templates. A pattern
+// may contain the following wildcards:
+//
+//	"*"   matches any sequence of characters within a single segment
+//	"**"  matches any sequence of characters, including separators
+//	"?"   matches exactly one character which is not a separator
+//
+// A backslash escapes the following character, so `\*` matches a literal asterisk. All other characters match
+// themselves. The policy's delimiters have no special meaning.
+//
+// Managers only need to return policies whose patterns could match the request. MemoryManager treats values
+// containing `*` or `?` as patterns, the SQL managers do not and can therefore not be used with GlobMatcher.
+type GlobMatcher struct {
+	// Separators contains the characters dividing a value into segments, for example ":" in
+	// "resources:articles:1" or "/" in "/articles/1".
+	Separators string
+}
+
+// NewGlobMatcher returns a GlobMatcher using the given separators, or DefaultGlobSeparators if none are given.
+func NewGlobMatcher(separators string) *GlobMatcher {
+	if separators == "" {
+		separators = DefaultGlobSeparators
+	}
+	return &GlobMatcher{Separators: separators}
+}
+
+// Matches a needle with an array of glob patterns and returns true if a match was found.
+func (m *GlobMatcher) Matches(p Policy, haystack []string, needle string) (bool, error) {
+	for _, h := range haystack {
+		if matches, err := m.match(h, needle); err != nil {
+			return false, err
+		} else if matches {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+type globTokenKind int
+
+const (
+	globLiteral globTokenKind = iota
+	globAny
+	globStar
+	globStarStar
+)
+
+type globToken struct {
+	kind globTokenKind
+	r    rune
+}
+
+func parseGlob(pattern string) ([]globToken, error) {
+	runes := []rune(pattern)
+	tokens := make([]globToken, 0, len(runes))
+	for i := 0; i < len(runes); i++ {
+		switch runes[i] {
+		case '\\':
+			if i+1 == len(runes) {
+				return nil, errors.Errorf("Glob pattern %q ends with an unterminated escape sequence", pattern)
+			}
+			i++
+			tokens = append(tokens, globToken{kind: globLiteral, r: runes[i]})
+		case '?':
+			tokens = append(tokens, globToken{kind: globAny})
+		case '*':
+			if i+1 < len(runes) && runes[i+1] == '*' {
+				// Any number of consecutive asterisks behaves like a double asterisk.
+				for i+1 < len(runes) && runes[i+1] == '*' {
+					i++
+				}
+				tokens = append(tokens, globToken{kind: globStarStar})
+				continue
+			}
+			tokens = append(tokens, globToken{kind: globStar})
+		default:
+			tokens = append(tokens, globToken{kind: globLiteral, r: runes[i]})
+		}
+	}
+	return tokens, nil
+}
+
+// match simulates the pattern as a nondeterministic automaton whose states are the positions in the pattern. This
+// takes time proportional to the length of the pattern times the length of the value, no matter how many wildcards
+// the pattern contains.
+func (m *GlobMatcher) match(pattern, value string) (bool, error) {
+	tokens, err := parseGlob(pattern)
+	if err != nil {
+		return false, err
+	}
+
+	current := make([]bool, len(tokens)+1)
+	next := make([]bool, len(tokens)+1)
+
+	// Wildcards matching sequences may match the empty sequence, so their successors are active as well.
+	closure := func(states []bool) {
+		for i, t := range tokens {
+			if states[i] && (t.kind == globStar || t.kind == globStarStar) {
+				states[i+1] = true
+			}
+		}
+	}
+
+	current[0] = true
+	closure(current)
+
+	for _, r := range value {
+		separator := strings.ContainsRune(m.Separators, r)
+		active := false
+		for i := range next {
+			next[i] = false
+		}
+
+		for i, t := range tokens {
+			if !current[i] {
+				continue
+			}
+
+			switch t.kind {
+			case globLiteral:
+				if t.r == r {
+					next[i+1] = true
+				}
+			case globAny:
+				if !separator {
+					next[i+1] = true
+				}
+			case globStar:
+				if !separator {
+					next[i] = true
+				}
+			case globStarStar:
+				next[i] = true
+			}
+		}
+
+		closure(next)
+		for _, ok := range next {
+			active = active || ok
+		}
+		if !active {
+			return false, nil
+		}
+		current, next = next, current
+	}
+
+	return current[len(tokens)], nil
+}
@@ -0,0 +1,94 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon_test
+
+import (
+	"testing"
+
+	. "github.com/ory/ladon"
+	"github.com/ory/ladon/manager/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGlobMatcher(t *testing.T) {
+	m := NewGlobMatcher("")
+	p := new(DefaultPolicy)
+
+	for k, c := range []struct {
+		pattern string
+		value   string
+		matches bool
+	}{
+		{pattern: "articles:1", value: "articles:1", matches: true},
+		{pattern: "articles:1", value: "articles:12", matches: false},
+		{pattern: "articles:*", value: "articles:12", matches: true},
+		{pattern: "articles:*", value: "articles:", matches: true},
+		{pattern: "articles:*", value: "articles:12:comments", matches: false},
+		{pattern: "articles:**", value: "articles:12:comments", matches: true},
+		{pattern: "articles:**:comments", value: "articles:12:comments", matches: true},
+		{pattern: "articles:**:comments", value: "articles:comments", matches: false},
+		{pattern: "articles:*:comments:*", value: "articles:12:comments:3", matches: true},
+		{pattern: "/articles/*/edit", value: "/articles/12/edit", matches: true},
+		{pattern: "/articles/*/edit", value: "/articles/12/3/edit", matches: false},
+		{pattern: "/articles/**/edit", value: "/articles/12/3/edit", matches: true},
+		{pattern: "articles:?", value: "articles:1", matches: true},
+		{pattern: "articles:?", value: "articles:12", matches: false},
+		{pattern: "articles?1", value: "articles:1", matches: false},
+		{pattern: "users:*", value: "users:pétér", matches: true},
+		{pattern: "users:p?t?r", value: "users:pétér", matches: true},
+		{pattern: "*a*a*a*a*b", value: "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", matches: false},
+		{pattern: `articles:\*`, value: "articles:*", matches: true},
+		{pattern: `articles:\*`, value: "articles:1", matches: false},
+		{pattern: "**", value: "", matches: true},
+		{pattern: "*", value: ":", matches: false},
+	} {
+		matches, err := m.Matches(p, []string{c.pattern}, c.value)
+		require.NoError(t, err, "%d", k)
+		assert.Equal(t, c.matches, matches, "%d: %s %s", k, c.pattern, c.value)
+	}
+
+	matches, err := m.Matches(p, []string{"articles:1", "comments:*"}, "comments:3")
+	require.NoError(t, err)
+	assert.True(t, matches)
+
+	_, err = m.Matches(p, []string{`articles:\`}, "articles:1")
+	assert.Error(t, err)
+
+	matches, err = NewGlobMatcher(".").Matches(p, []string{"articles.*"}, "articles.1:2")
+	require.NoError(t, err)
+	assert.True(t, matches)
+}
+
+func TestLadonGlobMatcher(t *testing.T) {
+	warden := &Ladon{Manager: memory.NewMemoryManager(), Matcher: NewGlobMatcher("")}
+	require.NoError(t, warden.Manager.Create(&DefaultPolicy{
+		ID:        "1",
+		Subjects:  []string{"users:*"},
+		Actions:   []string{"get"},
+		Resources: []string{"articles:**"},
+		Effect:    AllowAccess,
+	}))
+
+	assert.NoError(t, warden.IsAllowed(&Request{Subject: "users:peter", Action: "get", Resource: "articles:1:comments"}))
+	assert.Error(t, warden.IsAllowed(&Request{Subject: "groups:admins", Action: "get", Resource: "articles:1"}))
+	assert.Error(t, warden.IsAllowed(&Request{Subject: "users:peter", Action: "delete", Resource: "articles:1"}))
+}
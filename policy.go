@@ -22,7 +22,9 @@ package ladon
 
 import (
 	"encoding/json"
+	"time"
 
+	"github.com/ory/ladon/compiler"
 	"github.com/pkg/errors"
 )
 
@@ -62,6 +64,82 @@ type Policy interface {
 	GetEndDelimiter() byte
 }
 
+// ValidityPolicy is an optional interface a Policy can implement to limit the period of time it applies in. The
+// warden skips policies outside of their validity period and managers may exclude them from the request candidates.
+type ValidityPolicy interface {
+	Policy
+
+	// GetNotBefore returns the time the policy becomes valid at or nil if it is valid from the beginning.
+	GetNotBefore() *time.Time
+
+	// GetNotAfter returns the time the policy expires at or nil if it never expires.
+	GetNotAfter() *time.Time
+}
+
+// VersionedPolicy is an optional interface a Policy can implement to carry the version it is stored with (see
+// VersionedManager).
+type VersionedPolicy interface {
+	Policy
+
+	// GetVersion returns the version the policy is stored with, or 0 if it is unknown.
+	GetVersion() int64
+}
+
+// IsPolicyActive returns false if the policy implements ValidityPolicy and t lies outside of its validity period.
+func IsPolicyActive(p Policy, t time.Time) bool {
+	vp, ok := p.(ValidityPolicy)
+	if !ok {
+		return true
+	}
+
+	if nb := vp.GetNotBefore(); nb != nil && t.Before(*nb) {
+		return false
+	}
+	if na := vp.GetNotAfter(); na != nil && t.After(*na) {
+		return false
+	}
+	return true
+}
+
+// ValidatePolicy returns an error if the policy has no ID, its effect is neither AllowAccess nor DenyAccess, one of its
+// subjects, actions or resources is not a valid template or its validity period ends before it begins or lies outside
+// of the years 1 to 9999.
+func ValidatePolicy(p Policy) error {
+	if p.GetID() == "" {
+		return errors.New("Policy ID must not be empty")
+	}
+
+	if p.GetEffect() != AllowAccess && p.GetEffect() != DenyAccess {
+		return errors.Errorf("Policy %s has effect %q, but it must be either %q or %q", p.GetID(), p.GetEffect(), AllowAccess, DenyAccess)
+	}
+
+	for field, templates := range map[string][]string{
+		"subject":  p.GetSubjects(),
+		"action":   p.GetActions(),
+		"resource": p.GetResources(),
+	} {
+		for _, t := range templates {
+			if _, err := compiler.CompileRegex(t, p.GetStartDelimiter(), p.GetEndDelimiter()); err != nil {
+				return errors.Wrapf(err, "Policy %s has invalid %s %q", p.GetID(), field, t)
+			}
+		}
+	}
+
+	if vp, ok := p.(ValidityPolicy); ok {
+		nb, na := vp.GetNotBefore(), vp.GetNotAfter()
+		for _, t := range []*time.Time{nb, na} {
+			if t != nil && (t.Year() < 1 || t.Year() > 9999) {
+				return errors.Errorf("Policy %s has validity bound %s, but it must lie within the years 1 and 9999", p.GetID(), t)
+			}
+		}
+		if nb != nil && na != nil && na.Before(*nb) {
+			return errors.Errorf("Policy %s expires before it becomes valid", p.GetID())
+		}
+	}
+
+	return nil
+}
+
 // DefaultPolicy is the default implementation of the policy interface.
 type DefaultPolicy struct {
 	ID          string     `json:"id" gorethink:"id"`
@@ -71,6 +149,10 @@ type DefaultPolicy struct {
 	Resources   []string   `json:"resources" gorethink:"resources"`
 	Actions     []string   `json:"actions" gorethink:"actions"`
 	Conditions  Conditions `json:"conditions" gorethink:"conditions"`
+	Priority    int        `json:"priority,omitempty" gorethink:"priority"`
+	NotBefore   *time.Time `json:"not_before,omitempty" gorethink:"not_before"`
+	NotAfter    *time.Time `json:"not_after,omitempty" gorethink:"not_after"`
+	Version     int64      `json:"version,omitempty" gorethink:"version"`
 }
 
 // UnmarshalJSON overwrite own policy with values of the given in policy in JSON format
@@ -83,6 +165,10 @@ func (p *DefaultPolicy) UnmarshalJSON(data []byte) error {
 		Resources   []string   `json:"resources" gorethink:"resources"`
 		Actions     []string   `json:"actions" gorethink:"actions"`
 		Conditions  Conditions `json:"conditions" gorethink:"conditions"`
+		Priority    int        `json:"priority" gorethink:"priority"`
+		NotBefore   *time.Time `json:"not_before" gorethink:"not_before"`
+		NotAfter    *time.Time `json:"not_after" gorethink:"not_after"`
+		Version     int64      `json:"version" gorethink:"version"`
 	}{
 		Conditions: Conditions{},
 	}
@@ -99,6 +185,10 @@ func (p *DefaultPolicy) UnmarshalJSON(data []byte) error {
 		Resources:   pol.Resources,
 		Actions:     pol.Actions,
 		Conditions:  pol.Conditions,
+		Priority:    pol.Priority,
+		NotBefore:   pol.NotBefore,
+		NotAfter:    pol.NotAfter,
+		Version:     pol.Version,
 	}
 	return nil
 }
@@ -143,6 +233,26 @@ func (p *DefaultPolicy) GetConditions() Conditions {
 	return p.Conditions
 }
 
+// GetPriority returns the policies priority.
+func (p *DefaultPolicy) GetPriority() int {
+	return p.Priority
+}
+
+// GetNotBefore returns the time the policy becomes valid at or nil if it is valid from the beginning.
+func (p *DefaultPolicy) GetNotBefore() *time.Time {
+	return p.NotBefore
+}
+
+// GetNotAfter returns the time the policy expires at or nil if it never expires.
+func (p *DefaultPolicy) GetNotAfter() *time.Time {
+	return p.NotAfter
+}
+
+// GetVersion returns the version the policy is stored with, or 0 if it is unknown.
+func (p *DefaultPolicy) GetVersion() int64 {
+	return p.Version
+}
+
 // GetEndDelimiter returns the delimiter which identifies the end of a regular expression.
 func (p *DefaultPolicy) GetEndDelimiter() byte {
 	return '>'
@@ -24,6 +24,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"testing"
+	"time"
 
 	. "github.com/ory/ladon"
 	"github.com/stretchr/testify/assert"
@@ -34,6 +35,11 @@ var policyConditions = Conditions{
 	"owner": &EqualsSubjectCondition{},
 }
 
+var (
+	policyNotBefore = time.Date(2018, 3, 1, 0, 0, 0, 0, time.UTC)
+	policyNotAfter  = time.Date(2018, 3, 31, 0, 0, 0, 0, time.UTC)
+)
+
 var policyCases = []*DefaultPolicy{
 	{
 		ID:          "1",
@@ -43,6 +49,9 @@ var policyCases = []*DefaultPolicy{
 		Resources:   []string{"articles:<[0-9]+>"},
 		Actions:     []string{"create", "update"},
 		Conditions:  policyConditions,
+		Priority:    5,
+		NotBefore:   &policyNotBefore,
+		NotAfter:    &policyNotAfter,
 	},
 	{
 		Effect:     DenyAccess,
@@ -80,11 +89,45 @@ func TestGetters(t *testing.T) {
 		assert.Equal(t, len(c.Conditions), len(c.GetConditions()))
 		assert.Equal(t, c.Effect, c.GetEffect())
 		assert.Equal(t, c.Actions, c.GetActions())
+		assert.Equal(t, c.Priority, c.GetPriority())
+		assert.Equal(t, c.NotBefore, c.GetNotBefore())
+		assert.Equal(t, c.NotAfter, c.GetNotAfter())
 		assert.Equal(t, byte('<'), c.GetStartDelimiter())
 		assert.Equal(t, byte('>'), c.GetEndDelimiter())
 	}
 }
 
+func TestIsPolicyActive(t *testing.T) {
+	assert.False(t, IsPolicyActive(policyCases[0], policyNotBefore.Add(-time.Second)))
+	assert.True(t, IsPolicyActive(policyCases[0], policyNotBefore))
+	assert.True(t, IsPolicyActive(policyCases[0], policyNotAfter))
+	assert.False(t, IsPolicyActive(policyCases[0], policyNotAfter.Add(time.Second)))
+	assert.True(t, IsPolicyActive(policyCases[1], time.Time{}))
+}
+
+func TestValidatePolicy(t *testing.T) {
+	lastValidTime := time.Date(9999, 12, 31, 23, 59, 59, 999999999, time.UTC)
+	tooLate := lastValidTime.Add(time.Nanosecond)
+	tooEarly := time.Date(0, 12, 31, 0, 0, 0, 0, time.UTC)
+	for k, c := range []struct {
+		p     *DefaultPolicy
+		valid bool
+	}{
+		{p: policyCases[0], valid: true},
+		{p: &DefaultPolicy{ID: "1", Effect: DenyAccess}, valid: true},
+		{p: &DefaultPolicy{Effect: AllowAccess}},
+		{p: &DefaultPolicy{ID: "1", Effect: "maybe"}},
+		{p: &DefaultPolicy{ID: "1", Effect: AllowAccess, Subjects: []string{"<peter"}}},
+		{p: &DefaultPolicy{ID: "1", Effect: AllowAccess, Resources: []string{"articles:<[0-9>"}}},
+		{p: &DefaultPolicy{ID: "1", Effect: AllowAccess, NotBefore: &policyNotAfter, NotAfter: &policyNotBefore}},
+		{p: &DefaultPolicy{ID: "1", Effect: AllowAccess, NotAfter: &lastValidTime}, valid: true},
+		{p: &DefaultPolicy{ID: "1", Effect: AllowAccess, NotAfter: &tooLate}},
+		{p: &DefaultPolicy{ID: "1", Effect: AllowAccess, NotBefore: &tooEarly}},
+	} {
+		assert.Equal(t, c.valid, ValidatePolicy(c.p) == nil, "%d", k)
+	}
+}
+
 func RequireError(t *testing.T, expectError bool, err error, args ...interface{}) {
 	if err != nil && !expectError {
 		t.Logf("Unexpected error: %s\n", err.Error())
@@ -0,0 +1,321 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+// Package policytest runs declarative test suites against policies. A suite consists of policies and access requests
+// together with the expected outcome, and may be written in JSON or YAML:
+//
+//	name: articles
+//	policies:
+//	  - id: read-articles
+//	    subjects: ["<peter|max>"]
+//	    actions: ["get"]
+//	    resources: ["articles:<[0-9]+>"]
+//	    effect: allow
+//	cases:
+//	  - description: peter may read articles
+//	    request: {subject: peter, action: get, resource: "articles:42"}
+//	    expect: allow
+//	    deciding_policies: [read-articles]
+//	  - description: zac may not read articles
+//	    request: {subject: zac, action: get, resource: "articles:42"}
+//	    expect: deny
+//
+// The report of a suite explains every failed case and lists the policies which did not apply to any case.
+package policytest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ory/ladon"
+	"github.com/ory/ladon/internal/yamljson"
+	"github.com/ory/ladon/manager/memory"
+	"github.com/pkg/errors"
+)
+
+const (
+	// ExpectAllow expects access to be granted.
+	ExpectAllow = "allow"
+
+	// ExpectDeny expects access to be denied, either by default or forcefully.
+	ExpectDeny = "deny"
+
+	// ExpectForcefulDeny expects access to be denied by a policy.
+	ExpectForcefulDeny = "forceful-deny"
+)
+
+// Suite is a set of policies and the test cases which are run against them.
+type Suite struct {
+	// Name is a human readable name of the suite.
+	Name string `json:"name"`
+
+	// CombiningAlgorithm is the name of the combining algorithm the warden uses (see ladon.CombiningAlgorithms).
+	// Defaults to ladon.DefaultCombiningAlgorithm.
+	CombiningAlgorithm string `json:"combining_algorithm,omitempty"`
+
+	// Policies are the policies under test.
+	Policies []*ladon.DefaultPolicy `json:"policies"`
+
+	// Cases are the access requests and their expected outcome.
+	Cases []*Case `json:"cases"`
+}
+
+// Case is a single access request and its expected outcome.
+type Case struct {
+	// Description describes the case.
+	Description string `json:"description"`
+
+	// Request is the access request.
+	Request *ladon.Request `json:"request"`
+
+	// Expect is the expected outcome, one of ExpectAllow, ExpectDeny and ExpectForcefulDeny.
+	Expect string `json:"expect"`
+
+	// DecidingPolicies are the IDs of the policies that are expected to decide the request, in any order. If nil,
+	// the deciding policies are not checked.
+	DecidingPolicies []string `json:"deciding_policies,omitempty"`
+}
+
+// Load reads a suite from a JSON file, or a YAML file if the file name ends with .yml or .yaml.
+func Load(file string) (*Suite, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if ext := filepath.Ext(file); ext == ".yml" || ext == ".yaml" {
+		if data, err = yamljson.ToJSON(data); err != nil {
+			return nil, errors.Wrapf(err, "%s", file)
+		}
+	}
+
+	var s Suite
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, errors.Wrapf(err, "%s", file)
+	}
+	if s.Name == "" {
+		s.Name = file
+	}
+	return &s, nil
+}
+
+// Result is the outcome of a single case.
+type Result struct {
+	// Case is the case that was run.
+	Case *Case
+
+	// Decision explains how the case's request was decided.
+	Decision *ladon.Decision
+
+	// Failure explains why the case failed. It is empty if the case passed.
+	Failure string
+}
+
+// Passed returns true if the case passed.
+func (r *Result) Passed() bool {
+	return r.Failure == ""
+}
+
+// Report is the outcome of a suite.
+type Report struct {
+	// Suite is the suite that was run.
+	Suite *Suite
+
+	// Results are the results of all cases, in the order of the suite's cases.
+	Results []*Result
+
+	// Coverage maps the ID of every policy to the number of cases it applied to.
+	Coverage map[string]int
+}
+
+// Passed returns true if all cases passed.
+func (r *Report) Passed() bool {
+	return len(r.Failed()) == 0
+}
+
+// Failed returns the results of all failed cases.
+func (r *Report) Failed() []*Result {
+	var failed []*Result
+	for _, res := range r.Results {
+		if !res.Passed() {
+			failed = append(failed, res)
+		}
+	}
+	return failed
+}
+
+// Uncovered returns the sorted IDs of all policies which did not apply to any case.
+func (r *Report) Uncovered() []string {
+	var ids []string
+	for id, n := range r.Coverage {
+		if n == 0 {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Run validates the suite's policies and runs all cases against them.
+func Run(s *Suite) (*Report, error) {
+	m := memory.NewMemoryManager()
+	report := &Report{Suite: s, Coverage: map[string]int{}}
+	for _, p := range s.Policies {
+		if err := ladon.ValidatePolicy(p); err != nil {
+			return nil, err
+		}
+		if err := m.Create(p); err != nil {
+			return nil, errors.Wrapf(err, "Could not add policy %s", p.ID)
+		}
+		report.Coverage[p.ID] = 0
+	}
+
+	warden := &ladon.Ladon{Manager: m}
+	if s.CombiningAlgorithm != "" {
+		a, ok := ladon.CombiningAlgorithms[s.CombiningAlgorithm]
+		if !ok {
+			return nil, errors.Errorf("Combining algorithm %s is not supported", s.CombiningAlgorithm)
+		}
+		warden.CombiningAlgorithm = a
+	}
+
+	for k, c := range s.Cases {
+		if c.Request == nil {
+			return nil, errors.Errorf("Case %d has no request", k)
+		}
+
+		d, err := warden.Explain(c.Request)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Case %d", k)
+		}
+
+		for _, e := range d.Candidates {
+			if e.Applicable {
+				report.Coverage[e.Policy.GetID()]++
+			}
+		}
+
+		failure, err := check(c, d)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Case %d", k)
+		}
+		report.Results = append(report.Results, &Result{Case: c, Decision: d, Failure: failure})
+	}
+
+	return report, nil
+}
+
+// check returns why the decision does not meet the case's expectations, or an empty string if it does.
+func check(c *Case, d *ladon.Decision) (string, error) {
+	var outcome = ExpectAllow
+	if !d.Allowed {
+		outcome = ExpectDeny
+		if errors.Cause(d.Err) == ladon.ErrRequestForcefullyDenied {
+			outcome = ExpectForcefulDeny
+		}
+	}
+
+	switch c.Expect {
+	case ExpectAllow, ExpectForcefulDeny:
+		if outcome != c.Expect {
+			return fmt.Sprintf("expected %s, but got %s", c.Expect, outcome), nil
+		}
+	case ExpectDeny:
+		if outcome == ExpectAllow {
+			return fmt.Sprintf("expected %s, but got %s", c.Expect, outcome), nil
+		}
+	default:
+		return "", errors.Errorf("Expectation %q is neither %q, %q nor %q", c.Expect, ExpectAllow, ExpectDeny, ExpectForcefulDeny)
+	}
+
+	if c.DecidingPolicies != nil {
+		expected := append([]string{}, c.DecidingPolicies...)
+		got := make([]string, len(d.Deciders))
+		for k, p := range d.Deciders {
+			got[k] = p.GetID()
+		}
+		sort.Strings(expected)
+		sort.Strings(got)
+
+		if strings.Join(expected, ",") != strings.Join(got, ",") {
+			return fmt.Sprintf("expected deciding policies [%s], but got [%s]", strings.Join(expected, ", "), strings.Join(got, ", ")), nil
+		}
+	}
+
+	return "", nil
+}
+
+// Print writes a human readable report. Failed cases are explained by listing every candidate policy together with
+// the parts of the request it did not match.
+func (r *Report) Print(w io.Writer) {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "Suite %s: %d of %d cases passed\n", r.Suite.Name, len(r.Results)-len(r.Failed()), len(r.Results))
+
+	for _, res := range r.Failed() {
+		fmt.Fprintf(&b, "\nFAIL: %s\n  %s\n", res.Case.Description, res.Failure)
+		explain(&b, res.Decision)
+	}
+
+	if uncovered := r.Uncovered(); len(uncovered) > 0 {
+		fmt.Fprintf(&b, "\nPolicies which did not apply to any case: %s\n", strings.Join(uncovered, ", "))
+	}
+
+	w.Write(b.Bytes())
+}
+
+func explain(w io.Writer, d *ladon.Decision) {
+	if d.Reason != "" {
+		fmt.Fprintf(w, "  reason: %s\n", d.Reason)
+	}
+	if len(d.Candidates) == 0 {
+		fmt.Fprintln(w, "  no candidate policies")
+		return
+	}
+
+	for _, e := range d.Candidates {
+		if e.Applicable {
+			fmt.Fprintf(w, "  policy %s (%s): applied\n", e.Policy.GetID(), e.Policy.GetEffect())
+			continue
+		}
+
+		var reasons []string
+		if e.Inactive {
+			reasons = append(reasons, "outside of its validity period")
+		}
+		for _, m := range []struct {
+			field string
+			match *ladon.FieldMatch
+		}{{"action", e.Action}, {"subject", e.Subject}, {"resource", e.Resource}} {
+			if !m.match.Matches {
+				reasons = append(reasons, fmt.Sprintf("%s %q did not match", m.field, m.match.Value))
+			}
+		}
+		for _, c := range e.FailedConditions() {
+			reasons = append(reasons, fmt.Sprintf("condition %s (%s) was not fulfilled by %v", c.Key, c.Type, c.Value))
+		}
+		fmt.Fprintf(w, "  policy %s (%s): %s\n", e.Policy.GetID(), e.Policy.GetEffect(), strings.Join(reasons, ", "))
+	}
+}
@@ -0,0 +1,136 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package policytest_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ory/ladon"
+	"github.com/ory/ladon/policytest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRun(t *testing.T) {
+	s, err := policytest.Load("testdata/articles.yaml")
+	require.NoError(t, err)
+	require.Len(t, s.Policies, 3)
+	require.Len(t, s.Cases, 4)
+	assert.IsType(t, &ladon.NotCondition{}, s.Policies[1].Conditions["outside"])
+
+	report, err := policytest.Run(s)
+	require.NoError(t, err)
+	for _, r := range report.Results {
+		assert.True(t, r.Passed(), "%s: %s", r.Case.Description, r.Failure)
+	}
+	assert.True(t, report.Passed())
+	assert.Equal(t, map[string]int{"read-articles": 3, "no-secret-articles": 1, "write-articles": 0}, report.Coverage)
+	assert.Equal(t, []string{"write-articles"}, report.Uncovered())
+
+	var out bytes.Buffer
+	report.Print(&out)
+	assert.Equal(t, "Suite articles: 4 of 4 cases passed\n\nPolicies which did not apply to any case: write-articles\n", out.String())
+}
+
+func TestRunFailures(t *testing.T) {
+	s, err := policytest.Load("testdata/articles.yaml")
+	require.NoError(t, err)
+
+	s.Cases = []*policytest.Case{
+		{
+			Description: "zac may read articles",
+			Request:     &ladon.Request{Subject: "zac", Action: "get", Resource: "articles:42", Context: ladon.Context{"ip": "10.0.0.1"}},
+			Expect:      policytest.ExpectAllow,
+		},
+		{
+			Description: "peter is denied by the secret article policy",
+			Request:     &ladon.Request{Subject: "peter", Action: "get", Resource: "articles:42", Context: ladon.Context{"ip": "10.0.0.1"}},
+			Expect:      policytest.ExpectDeny,
+		},
+		{
+			Description:      "peter is allowed by the wrong policy",
+			Request:          &ladon.Request{Subject: "peter", Action: "get", Resource: "articles:1"},
+			Expect:           policytest.ExpectAllow,
+			DecidingPolicies: []string{"write-articles"},
+		},
+		{
+			Description: "zac is forcefully denied",
+			Request:     &ladon.Request{Subject: "zac", Action: "get", Resource: "articles:1"},
+			Expect:      policytest.ExpectForcefulDeny,
+		},
+	}
+
+	report, err := policytest.Run(s)
+	require.NoError(t, err)
+	assert.False(t, report.Passed())
+	require.Len(t, report.Failed(), 4)
+	assert.Equal(t, "expected allow, but got deny", report.Results[0].Failure)
+	assert.Equal(t, "expected deny, but got allow", report.Results[1].Failure)
+	assert.Equal(t, "expected deciding policies [write-articles], but got [read-articles]", report.Results[2].Failure)
+	assert.Equal(t, "expected forceful-deny, but got deny", report.Results[3].Failure)
+
+	var out bytes.Buffer
+	report.Print(&out)
+	assert.Contains(t, out.String(), "Suite articles: 0 of 4 cases passed\n")
+	assert.Contains(t, out.String(), "\nFAIL: zac may read articles\n  expected allow, but got deny\n  reason: "+ladon.ErrRequestDenied.Reason()+"\n")
+	assert.Contains(t, out.String(), `  policy no-secret-articles (deny): condition outside (NotCondition) was not fulfilled by <nil>`)
+	assert.Contains(t, out.String(), `  policy read-articles (allow): subject "zac" did not match`)
+}
+
+func TestRunErrors(t *testing.T) {
+	for k, s := range []*policytest.Suite{
+		{Policies: []*ladon.DefaultPolicy{{ID: "broken", Effect: ladon.AllowAccess, Subjects: []string{"<"}}}},
+		{CombiningAlgorithm: "unknown"},
+		{Cases: []*policytest.Case{{Expect: policytest.ExpectAllow}}},
+		{Cases: []*policytest.Case{{Request: &ladon.Request{}, Expect: "maybe"}}},
+	} {
+		_, err := policytest.Run(s)
+		assert.Error(t, err, "%d", k)
+	}
+}
+
+func TestLoadJSON(t *testing.T) {
+	dir, err := ioutil.TempDir("", "policytest")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "suite.json")
+	require.NoError(t, ioutil.WriteFile(file, []byte(`{
+		"combining_algorithm": "permit-overrides",
+		"policies": [{"id": "1", "subjects": ["peter"], "actions": ["get"], "resources": ["<.*>"], "effect": "allow"}],
+		"cases": [{"description": "peter", "request": {"subject": "peter", "action": "get", "resource": "a"}, "expect": "allow"}]
+	}`), 0644))
+
+	s, err := policytest.Load(file)
+	require.NoError(t, err)
+	assert.Equal(t, file, s.Name)
+
+	report, err := policytest.Run(s)
+	require.NoError(t, err)
+	assert.True(t, report.Passed())
+
+	_, err = policytest.Load(filepath.Join(dir, "does-not-exist.json"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,377 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+// Package server exposes a Warden as HTTP policy decision point (PDP) and a Manager as HTTP API to manage policies.
+//
+//	POST   /allowed          decides on the access request in the body, see ladon.Request
+//	GET    /policies         lists policies, paginated using the limit and offset query parameters
+//	POST   /policies         creates the policy in the body, see ladon.DefaultPolicy
+//	GET    /policies/{id}    returns a policy
+//	PUT    /policies/{id}    updates a policy
+//	DELETE /policies/{id}    deletes a policy
+//
+// If the manager implements ladon.VersionedManager, policies are returned with their version as ETag header, and an
+// update can be made conditional by sending the version in an If-Match header. If the policy was modified in the
+// meantime, the update is rejected with status code 412.
+//
+// Errors are returned as JSON object with the status code of the error if it has one, e.g. 403 if an access request
+// is denied, 400 if it is invalid or 404 if a policy does not exist. Policies are validated using ladon.ValidatePolicy
+// before they are stored. Errors without a status code, e.g. database errors, are returned as internal server error
+// without their message, which is logged instead.
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/ory/ladon"
+	"github.com/pkg/errors"
+)
+
+const (
+	// AllowedPath is the path of the policy decision point.
+	AllowedPath = "/allowed"
+
+	// PoliciesPath is the path of the policy management endpoints.
+	PoliciesPath = "/policies"
+
+	// DefaultLimit is the number of policies listed if the request does not set a limit.
+	DefaultLimit = 100
+
+	// DefaultMaxBodyBytes is the default size limit of request bodies.
+	DefaultMaxBodyBytes = 1 << 20
+)
+
+// Handler serves the policy decision point and policy management endpoints.
+type Handler struct {
+	// MaxBodyBytes limits the size of request bodies. Larger bodies are rejected with status code 400.
+	MaxBodyBytes int64
+
+	// Logger logs internal server errors, whose messages are not returned to the client. Defaults to a logger
+	// writing to stderr.
+	Logger *log.Logger
+
+	warden  ladon.Warden
+	manager ladon.Manager
+	mux     *http.ServeMux
+}
+
+// NewHandler returns a Handler which decides on access requests using warden and manages policies using manager.
+// If warden is nil, the policy decision point is not served. If manager is nil, the policy management endpoints are
+// not served.
+func NewHandler(warden ladon.Warden, manager ladon.Manager) *Handler {
+	h := &Handler{
+		MaxBodyBytes: DefaultMaxBodyBytes,
+		warden:       warden,
+		manager:      manager,
+		mux:          http.NewServeMux(),
+	}
+
+	if warden != nil {
+		h.mux.HandleFunc(AllowedPath, h.allowed)
+	}
+	if manager != nil {
+		h.mux.HandleFunc(PoliciesPath, h.policies)
+		h.mux.HandleFunc(PoliciesPath+"/", h.policy)
+	}
+	return h
+}
+
+// ServeHTTP implements http.Handler.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, h.MaxBodyBytes)
+	h.mux.ServeHTTP(w, r)
+}
+
+func (h *Handler) logger() *log.Logger {
+	if h.Logger == nil {
+		h.Logger = log.New(os.Stderr, "", log.LstdFlags)
+	}
+	return h.Logger
+}
+
+// errorResponse converts err using NewErrorResponse and logs it if it is an internal server error.
+func (h *Handler) errorResponse(err error) *ErrorResponse {
+	e := NewErrorResponse(err)
+	if e.Code == http.StatusInternalServerError {
+		h.logger().Printf("Internal server error: %+v", err)
+	}
+	return e
+}
+
+// AllowedResponse is the response of the policy decision point.
+type AllowedResponse struct {
+	// Allowed is true if access was granted.
+	Allowed bool `json:"allowed"`
+
+	// Error explains why access was denied.
+	Error *ErrorResponse `json:"error,omitempty"`
+}
+
+// ErrorResponse describes an error.
+type ErrorResponse struct {
+	// Code is the HTTP status code.
+	Code int `json:"code"`
+
+	// Status is the HTTP status text.
+	Status string `json:"status"`
+
+	// Reason is a human readable explanation of the error, if available.
+	Reason string `json:"reason,omitempty"`
+
+	// Message is the error message.
+	Message string `json:"message"`
+}
+
+type statusCoder interface {
+	StatusCode() int
+}
+
+type reasoner interface {
+	Reason() string
+}
+
+// NewErrorResponse converts err to an ErrorResponse. The status code and reason are taken from the error, e.g.
+// ladon.ErrRequestDenied, if it provides them. Otherwise it is an internal server error, and the error's message is
+// left out as it might reveal details such as database errors.
+func NewErrorResponse(err error) *ErrorResponse {
+	var e = &ErrorResponse{
+		Code:    http.StatusInternalServerError,
+		Message: http.StatusText(http.StatusInternalServerError),
+	}
+
+	cause := errors.Cause(err)
+	if sc, ok := cause.(statusCoder); ok {
+		e.Code = sc.StatusCode()
+		e.Message = err.Error()
+	}
+	if r, ok := cause.(reasoner); ok {
+		e.Reason = r.Reason()
+	}
+	e.Status = http.StatusText(e.Code)
+	return e
+}
+
+func (h *Handler) allowed(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	var ar ladon.Request
+	if err := json.NewDecoder(r.Body).Decode(&ar); err != nil {
+		writeError(w, badRequest(err))
+		return
+	}
+
+	var err error
+	if cw, ok := h.warden.(ladon.ContextWarden); ok {
+		err = cw.IsAllowedContext(r.Context(), &ar)
+	} else {
+		err = h.warden.IsAllowed(&ar)
+	}
+
+	if err != nil {
+		e := h.errorResponse(err)
+		writeJSON(w, e.Code, &AllowedResponse{Allowed: false, Error: e})
+		return
+	}
+	writeJSON(w, http.StatusOK, &AllowedResponse{Allowed: true})
+}
+
+func (h *Handler) policies(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		limit, offset := int64(DefaultLimit), int64(0)
+		for name, v := range map[string]*int64{"limit": &limit, "offset": &offset} {
+			if q := r.URL.Query().Get(name); q != "" {
+				i, err := strconv.ParseInt(q, 10, 64)
+				if err != nil || i < 0 {
+					writeError(w, badRequest(errors.Errorf("Query parameter %s must be a non-negative integer", name)))
+					return
+				}
+				*v = i
+			}
+		}
+
+		policies, err := h.manager.GetAll(limit, offset)
+		if err != nil {
+			writeError(w, h.errorResponse(err))
+			return
+		}
+		if policies == nil {
+			policies = ladon.Policies{}
+		}
+		writeJSON(w, http.StatusOK, policies)
+	case http.MethodPost:
+		p, err := decodePolicy(r)
+		if err != nil {
+			writeError(w, badRequest(err))
+			return
+		} else if err := ladon.ValidatePolicy(p); err != nil {
+			writeError(w, badRequest(err))
+			return
+		}
+
+		if err := h.manager.Create(p); err != nil {
+			writeError(w, h.errorResponse(err))
+			return
+		}
+		h.writePolicy(w, http.StatusCreated, p.ID)
+	default:
+		writeMethodNotAllowed(w, http.MethodGet, http.MethodPost)
+	}
+}
+
+func (h *Handler) policy(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, PoliciesPath+"/")
+	if id == "" || strings.Contains(id, "/") {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		h.writePolicy(w, http.StatusOK, id)
+	case http.MethodPut:
+		p, err := decodePolicy(r)
+		if err != nil {
+			writeError(w, badRequest(err))
+			return
+		}
+
+		if p.ID == "" {
+			p.ID = id
+		} else if p.ID != id {
+			writeError(w, badRequest(errors.Errorf("Policy ID %s does not match the ID %s in the path", p.ID, id)))
+			return
+		}
+
+		if _, err := h.manager.Get(id); err != nil {
+			writeError(w, h.errorResponse(err))
+			return
+		} else if err := ladon.ValidatePolicy(p); err != nil {
+			writeError(w, badRequest(err))
+			return
+		}
+
+		if err := h.update(p, r.Header.Get("If-Match")); err != nil {
+			writeError(w, err)
+			return
+		}
+		h.writePolicy(w, http.StatusOK, id)
+	case http.MethodDelete:
+		if _, err := h.manager.Get(id); err != nil {
+			writeError(w, h.errorResponse(err))
+			return
+		}
+
+		if err := h.manager.Delete(id); err != nil {
+			writeError(w, h.errorResponse(err))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeMethodNotAllowed(w, http.MethodGet, http.MethodPut, http.MethodDelete)
+	}
+}
+
+// update updates the policy. If ifMatch is set, the policy is only updated if its version matches.
+func (h *Handler) update(p *ladon.DefaultPolicy, ifMatch string) *ErrorResponse {
+	if ifMatch == "" {
+		if err := h.manager.Update(p); err != nil {
+			return h.errorResponse(err)
+		}
+		return nil
+	}
+
+	vm, ok := h.manager.(ladon.VersionedManager)
+	if !ok {
+		return badRequest(errors.New("Header If-Match is not supported because the manager does not store versions"))
+	}
+
+	version, err := strconv.ParseInt(strings.Trim(ifMatch, `"`), 10, 64)
+	if err != nil {
+		return badRequest(errors.Errorf("Header If-Match must be a version as returned in the ETag header, got %s", ifMatch))
+	}
+
+	if err := vm.UpdateIfMatch(p, version); errors.Cause(err) == ladon.ErrConflict {
+		e := h.errorResponse(err)
+		e.Code, e.Status = http.StatusPreconditionFailed, http.StatusText(http.StatusPreconditionFailed)
+		return e
+	} else if err != nil {
+		return h.errorResponse(err)
+	}
+	return nil
+}
+
+// writePolicy writes the policy stored under id, and its version as ETag header if it has one.
+func (h *Handler) writePolicy(w http.ResponseWriter, code int, id string) {
+	p, err := h.manager.Get(id)
+	if err != nil {
+		writeError(w, h.errorResponse(err))
+		return
+	}
+
+	if vp, ok := p.(ladon.VersionedPolicy); ok && vp.GetVersion() > 0 {
+		w.Header().Set("ETag", fmt.Sprintf(`"%d"`, vp.GetVersion()))
+	}
+	writeJSON(w, code, p)
+}
+
+func decodePolicy(r *http.Request) (*ladon.DefaultPolicy, error) {
+	var p = new(ladon.DefaultPolicy)
+	if err := json.NewDecoder(r.Body).Decode(p); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return p, nil
+}
+
+func badRequest(err error) *ErrorResponse {
+	return &ErrorResponse{
+		Code:    http.StatusBadRequest,
+		Status:  http.StatusText(http.StatusBadRequest),
+		Message: err.Error(),
+	}
+}
+
+func writeMethodNotAllowed(w http.ResponseWriter, allowed ...string) {
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	writeError(w, &ErrorResponse{
+		Code:    http.StatusMethodNotAllowed,
+		Status:  http.StatusText(http.StatusMethodNotAllowed),
+		Message: "Method not allowed",
+	})
+}
+
+func writeError(w http.ResponseWriter, e *ErrorResponse) {
+	writeJSON(w, e.Code, map[string]*ErrorResponse{"error": e})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
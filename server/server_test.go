@@ -0,0 +1,257 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package server_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ory/ladon"
+	"github.com/ory/ladon/manager/memory"
+	"github.com/ory/ladon/server"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func do(t *testing.T, ts *httptest.Server, method, path, body string, out interface{}) *http.Response {
+	req, err := http.NewRequest(method, ts.URL+path, bytes.NewBufferString(body))
+	require.NoError(t, err)
+
+	res, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	if out != nil {
+		require.NoError(t, json.NewDecoder(res.Body).Decode(out))
+	}
+	return res
+}
+
+func TestHandler(t *testing.T) {
+	manager := memory.NewMemoryManager()
+	ts := httptest.NewServer(server.NewHandler(&ladon.Ladon{Manager: manager}, manager))
+	defer ts.Close()
+
+	var errRes map[string]*server.ErrorResponse
+
+	t.Run("case=create", func(t *testing.T) {
+		var p ladon.DefaultPolicy
+		res := do(t, ts, "POST", "/policies", `{
+			"id": "1",
+			"subjects": ["peter"],
+			"actions": ["<get|update>"],
+			"resources": ["articles:<.*>"],
+			"effect": "allow",
+			"conditions": {"ip": {"type": "CIDRCondition", "options": {"cidr": "127.0.0.1/32"}}}
+		}`, &p)
+		assert.Equal(t, http.StatusCreated, res.StatusCode)
+		assert.Equal(t, "1", p.ID)
+		assert.IsType(t, &ladon.CIDRCondition{}, p.Conditions["ip"])
+
+		res = do(t, ts, "POST", "/policies", `{"id": "2", "subjects": ["peter"], "actions": ["delete"], "resources": ["<.*>"], "effect": "deny"}`, nil)
+		assert.Equal(t, http.StatusCreated, res.StatusCode)
+	})
+
+	t.Run("case=create invalid", func(t *testing.T) {
+		for _, body := range []string{
+			`{`,
+			`{"subjects": ["peter"]}`,
+			`{"id": "3", "conditions": {"foo": {"type": "DoesNotExist"}}}`,
+			`{"id": "3", "subjects": ["peter"], "effect": "permit"}`,
+			`{"id": "3", "subjects": ["<[0-9]+"], "effect": "allow"}`,
+			`{"id": "3", "effect": "allow", "description": "` + strings.Repeat("a", server.DefaultMaxBodyBytes) + `"}`,
+		} {
+			res := do(t, ts, "POST", "/policies", body, &errRes)
+			assert.Equal(t, http.StatusBadRequest, res.StatusCode, body)
+			assert.Equal(t, http.StatusBadRequest, errRes["error"].Code, body)
+		}
+	})
+
+	t.Run("case=allowed", func(t *testing.T) {
+		for k, c := range []struct {
+			body   string
+			code   int
+			allow  bool
+			reason string
+		}{
+			{
+				body:  `{"subject": "peter", "action": "get", "resource": "articles:1", "context": {"ip": "127.0.0.1"}}`,
+				code:  http.StatusOK,
+				allow: true,
+			},
+			{
+				body:   `{"subject": "peter", "action": "get", "resource": "articles:1", "context": {"ip": "10.0.0.1"}}`,
+				code:   http.StatusForbidden,
+				reason: ladon.ErrRequestDenied.Reason(),
+			},
+			{
+				body:   `{"subject": "peter", "action": "delete", "resource": "articles:1"}`,
+				code:   http.StatusForbidden,
+				reason: ladon.ErrRequestForcefullyDenied.Reason(),
+			},
+			{
+				body:   `{"subject": "peter", "action": "delete", "resource": "articles:1", "combining_algorithm": "permit-overrides"}`,
+				code:   http.StatusBadRequest,
+				reason: ladon.ErrInvalidRequest.Reason(),
+			},
+			{
+				body:   `{"subject": "peter", "action": "delete", "resource": "articles:1", "combining_algorithm": "does-not-exist"}`,
+				code:   http.StatusBadRequest,
+				reason: ladon.ErrInvalidRequest.Reason(),
+			},
+		} {
+			var ar server.AllowedResponse
+			res := do(t, ts, "POST", "/allowed", c.body, &ar)
+			assert.Equal(t, c.code, res.StatusCode, "%d", k)
+			assert.Equal(t, c.allow, ar.Allowed, "%d", k)
+			if c.allow {
+				assert.Nil(t, ar.Error, "%d", k)
+			} else {
+				require.NotNil(t, ar.Error, "%d", k)
+				assert.Equal(t, c.code, ar.Error.Code, "%d", k)
+				assert.Equal(t, c.reason, ar.Error.Reason, "%d", k)
+			}
+		}
+
+		res := do(t, ts, "POST", "/allowed", `not json`, &errRes)
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+		res = do(t, ts, "GET", "/allowed", ``, &errRes)
+		assert.Equal(t, http.StatusMethodNotAllowed, res.StatusCode)
+		assert.Equal(t, "POST", res.Header.Get("Allow"))
+	})
+
+	t.Run("case=get and list", func(t *testing.T) {
+		var p ladon.DefaultPolicy
+		res := do(t, ts, "GET", "/policies/1", ``, &p)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, []string{"peter"}, p.Subjects)
+
+		res = do(t, ts, "GET", "/policies/does-not-exist", ``, &errRes)
+		assert.Equal(t, http.StatusNotFound, res.StatusCode)
+		assert.Equal(t, http.StatusNotFound, errRes["error"].Code)
+
+		var ps []ladon.DefaultPolicy
+		res = do(t, ts, "GET", "/policies", ``, &ps)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Len(t, ps, 2)
+
+		res = do(t, ts, "GET", "/policies?limit=1&offset=1", ``, &ps)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Len(t, ps, 1)
+
+		res = do(t, ts, "GET", "/policies?limit=-1", ``, &errRes)
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	})
+
+	t.Run("case=update", func(t *testing.T) {
+		var p ladon.DefaultPolicy
+		res := do(t, ts, "PUT", "/policies/1", `{"subjects": ["max"], "actions": ["get"], "resources": ["articles:<.*>"], "effect": "allow"}`, &p)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, "1", p.ID)
+
+		var ar server.AllowedResponse
+		res = do(t, ts, "POST", "/allowed", `{"subject": "max", "action": "get", "resource": "articles:1"}`, &ar)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.True(t, ar.Allowed)
+
+		res = do(t, ts, "PUT", "/policies/1", `{"id": "2"}`, &errRes)
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+		res = do(t, ts, "PUT", "/policies/1", `{"effect": "permit"}`, &errRes)
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+		res = do(t, ts, "PUT", "/policies/does-not-exist", `{}`, &errRes)
+		assert.Equal(t, http.StatusNotFound, res.StatusCode)
+	})
+
+	t.Run("case=update if match", func(t *testing.T) {
+		put := func(ifMatch string) *http.Response {
+			req, err := http.NewRequest("PUT", ts.URL+"/policies/1", bytes.NewBufferString(`{"subjects": ["max"], "actions": ["get"], "resources": ["articles:<.*>"], "effect": "allow"}`))
+			require.NoError(t, err)
+			req.Header.Set("If-Match", ifMatch)
+
+			res, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			res.Body.Close()
+			return res
+		}
+
+		res := do(t, ts, "GET", "/policies/1", ``, nil)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		etag := res.Header.Get("ETag")
+		assert.Equal(t, `"2"`, etag)
+
+		res = put(etag)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, `"3"`, res.Header.Get("ETag"))
+
+		assert.Equal(t, http.StatusPreconditionFailed, put(etag).StatusCode)
+		assert.Equal(t, http.StatusBadRequest, put("*").StatusCode)
+	})
+
+	t.Run("case=delete", func(t *testing.T) {
+		res := do(t, ts, "DELETE", "/policies/1", ``, nil)
+		assert.Equal(t, http.StatusNoContent, res.StatusCode)
+
+		res = do(t, ts, "DELETE", "/policies/1", ``, &errRes)
+		assert.Equal(t, http.StatusNotFound, res.StatusCode)
+
+		res = do(t, ts, "PATCH", "/policies/2", ``, &errRes)
+		assert.Equal(t, http.StatusMethodNotAllowed, res.StatusCode)
+	})
+}
+
+type failingManager struct {
+	ladon.Manager
+}
+
+func (m *failingManager) GetAll(limit, offset int64) (ladon.Policies, error) {
+	return nil, errors.New("pq: password authentication failed for user ladon")
+}
+
+func TestHandlerInternalError(t *testing.T) {
+	var logged bytes.Buffer
+	h := server.NewHandler(nil, &failingManager{Manager: memory.NewMemoryManager()})
+	h.Logger = log.New(&logged, "", 0)
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+
+	var errRes map[string]*server.ErrorResponse
+	res := do(t, ts, "GET", "/policies", ``, &errRes)
+	assert.Equal(t, http.StatusInternalServerError, res.StatusCode)
+	assert.Equal(t, http.StatusText(http.StatusInternalServerError), errRes["error"].Message)
+	assert.Contains(t, logged.String(), "password authentication failed")
+}
+
+func TestHandlerWithoutManager(t *testing.T) {
+	ts := httptest.NewServer(server.NewHandler(&ladon.Ladon{Manager: memory.NewMemoryManager()}, nil))
+	defer ts.Close()
+
+	res := do(t, ts, "GET", "/policies", ``, nil)
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+}
@@ -20,6 +20,8 @@
 
 package ladon
 
+import "context"
+
 // Request is the warden's request object.
 type Request struct {
 	// Resource is the resource that access is requested to.
@@ -33,6 +35,11 @@ type Request struct {
 
 	// Context is the request's environmental context.
 	Context Context `json:"context"`
+
+	// CombiningAlgorithm is the name of the combining algorithm (see CombiningAlgorithms) which decides the request.
+	// If empty, the warden's combining algorithm is used. The warden rejects the request unless the algorithm is
+	// listed in Ladon.RequestCombiningAlgorithms.
+	CombiningAlgorithm string `json:"combining_algorithm,omitempty"`
 }
 
 // Warden is responsible for deciding if subject s can perform action a on resource r with context c.
@@ -43,3 +50,12 @@ type Warden interface {
 	//  }
 	IsAllowed(r *Request) error
 }
+
+// ContextWarden is a Warden which propagates a context.Context to the manager and to conditions implementing
+// ContextCondition.
+type ContextWarden interface {
+	Warden
+
+	// IsAllowedContext is like IsAllowed, but aborts as soon as ctx is done.
+	IsAllowedContext(ctx context.Context, r *Request) error
+}